@@ -0,0 +1,103 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package auth
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dfltEntitlementsClaim = "eduPersonEntitlement"
+	dfltMaxClockSkewSecs  = 60
+)
+
+// PublicKeyConf specifies a public key used to verify
+// signatures of tokens issued by an aggregator (or another
+// trusted party).
+type PublicKeyConf struct {
+
+	// KeyID is matched against the `kid` token header. In case
+	// a token does not specify `kid` (or there is no matching key),
+	// all the configured keys are tried.
+	KeyID string `json:"keyId"`
+
+	// Path is a path to a PEM encoded public key (PKIX, RSA, ECDSA or Ed25519)
+	Path string `json:"path"`
+}
+
+// Conf configures the FCS authentication profile where clients
+// send a signed JWT in the `Authorization: Bearer` HTTP header.
+type Conf struct {
+	PublicKeys []PublicKeyConf `json:"publicKeys"`
+
+	// Issuers (optional) is a list of accepted token issuers (the `iss` claim)
+	Issuers []string `json:"issuers"`
+
+	// Audience must be contained in the `aud` claim if set. It is
+	// required in case there are restricted resources (see
+	// ValidateRestrictedAccess).
+	Audience string `json:"audience"`
+
+	// EntitlementsClaim is a name of a claim containing user's
+	// entitlements (a string or a list of strings)
+	EntitlementsClaim string `json:"entitlementsClaim"`
+
+	// MaxClockSkewSecs is a tolerance applied when validating
+	// time-related claims (`exp`, `nbf`, `iat`)
+	MaxClockSkewSecs int `json:"maxClockSkewSecs"`
+}
+
+func (conf *Conf) ValidateAndDefaults(confContext string) error {
+	if len(conf.PublicKeys) == 0 {
+		return fmt.Errorf("`%s.publicKeys` must contain at least one key", confContext)
+	}
+	for i, pk := range conf.PublicKeys {
+		if pk.Path == "" {
+			return fmt.Errorf("missing `%s.publicKeys[%d].path`", confContext, i)
+		}
+	}
+	if conf.EntitlementsClaim == "" {
+		conf.EntitlementsClaim = dfltEntitlementsClaim
+		log.Warn().
+			Str("value", conf.EntitlementsClaim).
+			Msgf("%s.entitlementsClaim not specified, using default", confContext)
+	}
+	if conf.MaxClockSkewSecs == 0 {
+		conf.MaxClockSkewSecs = dfltMaxClockSkewSecs
+		log.Warn().
+			Int("value", conf.MaxClockSkewSecs).
+			Msgf("%s.maxClockSkewSecs not specified, using default", confContext)
+
+	} else if conf.MaxClockSkewSecs < 0 {
+		return fmt.Errorf("`%s.maxClockSkewSecs` must be a non-negative number", confContext)
+	}
+	return nil
+}
+
+// ValidateRestrictedAccess checks settings required to protect restricted
+// resources. Without an audience, tokens issued by a trusted party for
+// any other service would be accepted.
+func (conf *Conf) ValidateRestrictedAccess(confContext string) error {
+	if conf.Audience == "" {
+		return fmt.Errorf("missing `%s.audience` (required for restricted resources)", confContext)
+	}
+	return nil
+}
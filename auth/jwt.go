@@ -0,0 +1,312 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/czcorpus/cnc-gokit/collections"
+)
+
+var (
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrTokenExpired     = errors.New("token expired")
+	ErrTokenNotValidYet = errors.New("token not valid yet")
+)
+
+// Identity describes an authenticated user
+type Identity struct {
+	Subject      string
+	Issuer       string
+	Entitlements []string
+}
+
+// IsAuthenticated is nil-safe (nil identity means an anonymous user)
+func (ident *Identity) IsAuthenticated() bool {
+	return ident != nil
+}
+
+// GetEntitlements is nil-safe (an anonymous user has no entitlements)
+func (ident *Identity) GetEntitlements() []string {
+	if ident == nil {
+		return []string{}
+	}
+	return ident.Entitlements
+}
+
+type publicKey struct {
+	id  string
+	key crypto.PublicKey
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verifier validates signed JWTs against configured
+// public keys and extracts user identity from them.
+type Verifier struct {
+	conf *Conf
+	keys []publicKey
+	now  func() time.Time
+}
+
+// Authenticate extracts a bearer token from the `Authorization`
+// header and verifies it. For requests without the header,
+// nil identity and nil error are returned (i.e. an anonymous user).
+func (v *Verifier) Authenticate(req *http.Request) (*Identity, error) {
+	hdr := req.Header.Get("Authorization")
+	if hdr == "" {
+		return nil, nil
+	}
+	scheme, token, ok := strings.Cut(hdr, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, fmt.Errorf("%w: unsupported authorization scheme", ErrInvalidToken)
+	}
+	return v.Verify(strings.TrimSpace(token))
+}
+
+// Verify validates a compact serialized JWT (signature and
+// time/issuer/audience claims) and returns the user identity.
+func (v *Verifier) Verify(token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+	if err := v.verifySignature(header, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+	return v.validateClaims(claims)
+}
+
+func (v *Verifier) verifySignature(header tokenHeader, signed, signature []byte) error {
+	candidates := make([]publicKey, 0, len(v.keys))
+	for _, k := range v.keys {
+		if header.Kid != "" && k.id == header.Kid {
+			candidates = []publicKey{k}
+			break
+		}
+		candidates = append(candidates, k)
+	}
+	for _, k := range candidates {
+		ok, err := verifyWithKey(header.Alg, k.key, signed, signature)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidToken, err)
+		}
+		if ok {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func (v *Verifier) validateClaims(claims map[string]any) (*Identity, error) {
+	now := v.now()
+	skew := time.Duration(v.conf.MaxClockSkewSecs) * time.Second
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return nil, fmt.Errorf("%w: missing or invalid `exp` claim", ErrInvalidToken)
+	}
+	if now.After(exp.Add(skew)) {
+		return nil, ErrTokenExpired
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(skew).Before(nbf) {
+		return nil, ErrTokenNotValidYet
+	}
+	if iat, ok := numericDate(claims["iat"]); ok && now.Add(skew).Before(iat) {
+		return nil, ErrTokenNotValidYet
+	}
+	ans := &Identity{
+		Subject:      stringClaim(claims["sub"]),
+		Issuer:       stringClaim(claims["iss"]),
+		Entitlements: stringListClaim(claims[v.conf.EntitlementsClaim]),
+	}
+	if len(v.conf.Issuers) > 0 && !collections.SliceContains(v.conf.Issuers, ans.Issuer) {
+		return nil, fmt.Errorf("%w: untrusted issuer %s", ErrInvalidToken, ans.Issuer)
+	}
+	if v.conf.Audience != "" &&
+		!collections.SliceContains(stringListClaim(claims["aud"]), v.conf.Audience) {
+		return nil, fmt.Errorf("%w: token not intended for this endpoint", ErrInvalidToken)
+	}
+	return ans, nil
+}
+
+// ----
+
+// verifyWithKey tests a signature using a key compatible with the
+// specified algorithm. For an incompatible key, false is returned
+// without an error so other keys can be tried.
+func verifyWithKey(alg string, key crypto.PublicKey, signed, signature []byte) (bool, error) {
+	switch alg {
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false, nil
+		}
+		hash := hashForAlg(alg)
+		digest := hash.New()
+		digest.Write(signed)
+		if strings.HasPrefix(alg, "PS") {
+			opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+			return rsa.VerifyPSS(rsaKey, hash, digest.Sum(nil), signature, opts) == nil, nil
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, hash, digest.Sum(nil), signature) == nil, nil
+	case "ES256", "ES384", "ES512":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false, nil
+		}
+		keySize := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*keySize {
+			return false, nil
+		}
+		hash := hashForAlg(alg)
+		digest := hash.New()
+		digest.Write(signed)
+		r := new(big.Int).SetBytes(signature[:keySize])
+		s := new(big.Int).SetBytes(signature[keySize:])
+		return ecdsa.Verify(ecKey, digest.Sum(nil), r, s), nil
+	case "EdDSA":
+		edKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return false, nil
+		}
+		return ed25519.Verify(edKey, signed, signature), nil
+	}
+	return false, fmt.Errorf("unsupported signing algorithm `%s`", alg)
+}
+
+func hashForAlg(alg string) crypto.Hash {
+	switch alg[2:] {
+	case "384":
+		return crypto.SHA384
+	case "512":
+		return crypto.SHA512
+	}
+	return crypto.SHA256
+}
+
+func decodeSegment(seg string, target any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+func numericDate(v any) (time.Time, bool) {
+	tv, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(tv), 0), true
+}
+
+func stringClaim(v any) string {
+	tv, _ := v.(string)
+	return tv
+}
+
+// stringListClaim handles claims which can be either
+// a single string or a list of strings
+func stringListClaim(v any) []string {
+	switch tv := v.(type) {
+	case string:
+		return []string{tv}
+	case []any:
+		ans := make([]string, 0, len(tv))
+		for _, item := range tv {
+			if s, ok := item.(string); ok {
+				ans = append(ans, s)
+			}
+		}
+		return ans
+	}
+	return []string{}
+}
+
+// ----
+
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// NewVerifier creates a verifier with public keys loaded
+// from files specified in the configuration.
+func NewVerifier(conf *Conf) (*Verifier, error) {
+	keys := make([]publicKey, 0, len(conf.PublicKeys))
+	for _, pk := range conf.PublicKeys {
+		key, err := loadPublicKey(pk.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load public key %s: %w", pk.Path, err)
+		}
+		keys = append(keys, publicKey{id: pk.KeyID, key: key})
+	}
+	return &Verifier{
+		conf: conf,
+		keys: keys,
+		now:  time.Now,
+	}, nil
+}
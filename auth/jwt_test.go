@@ -0,0 +1,128 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mkToken(t *testing.T, alg string, key crypto.Signer, claims map[string]any) string {
+	hdr, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	assert.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	assert.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(hdr) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch tk := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, tk, crypto.SHA256, digest[:])
+		assert.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, tk, digest[:])
+		assert.NoError(t, err)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func mkVerifier(conf *Conf, keys ...crypto.PublicKey) *Verifier {
+	ans := &Verifier{
+		conf: conf,
+		now:  func() time.Time { return time.Unix(1700000000, 0) },
+	}
+	for _, k := range keys {
+		ans.keys = append(ans.keys, publicKey{key: k})
+	}
+	return ans
+}
+
+func TestVerifyValidToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	v := mkVerifier(
+		&Conf{EntitlementsClaim: "entitlements", Issuers: []string{"aggr"}, Audience: "fcs"},
+		&ecKey.PublicKey, &rsaKey.PublicKey,
+	)
+	claims := map[string]any{
+		"sub":          "user1",
+		"iss":          "aggr",
+		"aud":          []string{"fcs", "other"},
+		"exp":          1700000100,
+		"entitlements": "licence-a",
+	}
+	ident, err := v.Verify(mkToken(t, "RS256", rsaKey, claims))
+	assert.NoError(t, err)
+	if assert.NotNil(t, ident) {
+		assert.Equal(t, "user1", ident.Subject)
+		assert.Equal(t, []string{"licence-a"}, ident.Entitlements)
+	}
+	_, err = v.Verify(mkToken(t, "ES256", ecKey, claims))
+	assert.NoError(t, err)
+}
+
+func TestVerifyInvalidToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	v := mkVerifier(&Conf{Issuers: []string{"aggr"}}, &rsaKey.PublicKey)
+
+	_, err = v.Verify(mkToken(t, "RS256", otherKey, map[string]any{"iss": "aggr", "exp": 1700000100}))
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = v.Verify(mkToken(t, "RS256", rsaKey, map[string]any{"iss": "aggr", "exp": 1600000000}))
+	assert.ErrorIs(t, err, ErrTokenExpired)
+
+	_, err = v.Verify(mkToken(t, "RS256", rsaKey, map[string]any{"iss": "foo", "exp": 1700000100}))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = v.Verify(mkToken(t, "none", rsaKey, map[string]any{"iss": "aggr", "exp": 1700000100}))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestAuthenticateAnonymous(t *testing.T) {
+	v := mkVerifier(&Conf{})
+	req, err := http.NewRequest(http.MethodGet, "/", nil)
+	assert.NoError(t, err)
+	ident, err := v.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Nil(t, ident)
+
+	req.Header.Set("Authorization", "Basic Zm9vOmJhcg==")
+	_, err = v.Authenticate(req)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
@@ -19,6 +19,7 @@
 
 //go:generate pigeon -o ../../query/parser/fcsql/fcsql.go ../../query/parser/fcsql/fcsql.peg
 //go:generate pigeon -o ../../query/parser/basic/basic.go ../../query/parser/basic/basic.peg
+//go:generate pigeon -o ../../query/parser/lexcql/lexcql.go ../../query/parser/lexcql/lexcql.peg
 
 package main
 
@@ -32,6 +33,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -40,13 +42,17 @@ import (
 	"github.com/czcorpus/cnc-gokit/uniresp"
 	"github.com/czcorpus/mquery-common/concordance"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
 
+	"github.com/czcorpus/mquery-sru/auth"
 	"github.com/czcorpus/mquery-sru/cnf"
 	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/general"
 	"github.com/czcorpus/mquery-sru/handler"
 	"github.com/czcorpus/mquery-sru/handler/form"
+	"github.com/czcorpus/mquery-sru/health"
+	"github.com/czcorpus/mquery-sru/metrics"
 	"github.com/czcorpus/mquery-sru/monitoring"
 	"github.com/czcorpus/mquery-sru/rdb"
 	"github.com/czcorpus/mquery-sru/worker"
@@ -73,22 +79,49 @@ func init() {
 	gob.Register(&concordance.Struct{})
 	gob.Register(&concordance.CloseStruct{})
 	gob.Register(&rdb.TransmittedError{})
+	gob.Register(rdb.ConcQueryArgs{})
+	gob.Register(rdb.AttrValuesQueryArgs{})
+}
+
+func isWatchdogRequest(c *gin.Context, WatchdogReqFilterConf *cnf.WatchdogReqFilter) bool {
+	return WatchdogReqFilterConf != nil &&
+		c.GetHeader(WatchdogReqFilterConf.HTTPIdHeaderName) == WatchdogReqFilterConf.HTTPIdHeaderToken
 }
 
 func watchdogIdentificationMiddleware(WatchdogReqFilterConf *cnf.WatchdogReqFilter) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if WatchdogReqFilterConf != nil &&
-			c.GetHeader(WatchdogReqFilterConf.HTTPIdHeaderName) == WatchdogReqFilterConf.HTTPIdHeaderToken {
+		if isWatchdogRequest(c, WatchdogReqFilterConf) {
 			logging.AddCustomEntry(c, "isWatchdogQuery", true)
 		}
 		c.Next()
 	}
 }
 
+// queryOriginMiddleware assigns each request to a queue lane
+// and identifies its client so queries can be scheduled fairly
+// (see rdb.SchedulingConf)
+func queryOriginMiddleware(
+	schedConf *rdb.SchedulingConf,
+	WatchdogReqFilterConf *cnf.WatchdogReqFilter,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := schedConf.Classify(
+			c.GetHeader, c.ClientIP(), isWatchdogRequest(c, WatchdogReqFilterConf))
+		c.Request = c.Request.WithContext(rdb.WithQueryOrigin(c.Request.Context(), origin))
+		logging.AddCustomEntry(c, "queueLane", origin.Lane)
+		c.Next()
+	}
+}
+
+// runApiServer runs the HTTP API until the `ctx` is cancelled.
+// The `logger` provides workers load for the monitoring endpoints
+// (in the "combined" mode, it must be the logger used by embedded workers).
 func runApiServer(
 	ctx context.Context,
 	conf *cnf.Conf,
-	radapter *rdb.Adapter,
+	queue rdb.QueryPublisher,
+	cacheStats monitoring.ResultCacheStatsProvider,
+	logger *monitoring.WorkerJobLogger,
 ) {
 	log.Info().Msg("Starting MQuery-SRU server")
 	if !conf.Logging.Level.IsDebugMode() {
@@ -106,15 +139,26 @@ func runApiServer(
 	engine.Use(gin.Recovery())
 	engine.Use(logging.GinMiddleware())
 	engine.Use(watchdogIdentificationMiddleware(conf.WatchdogReqFilter))
+	engine.Use(queryOriginMiddleware(conf.QueueScheduling(), conf.WatchdogReqFilter))
 	engine.NoMethod(uniresp.NoMethodHandler)
 	engine.NoRoute(uniresp.NotFoundHandler)
 
-	FCSActions := handler.NewFCSHandler(conf.ServerInfo, conf.CorporaSetup, radapter)
-	engine.GET("/", FCSActions.FCSHandler)
-	engine.HEAD("/", FCSActions.FCSHandler)
+	var authVerifier *auth.Verifier
+	if conf.Auth != nil {
+		var err error
+		authVerifier, err = auth.NewVerifier(conf.Auth)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to initialize authentication")
+			return
+		}
+	}
+
+	FCSActions := handler.NewFCSHandler(conf.ServerInfo, conf.CorporaSetup, queue, authVerifier)
+	engine.GET("/", metrics.GinMiddleware(), FCSActions.FCSHandler)
+	engine.HEAD("/", metrics.GinMiddleware(), FCSActions.FCSHandler)
 
 	viewHandler := handler.NewViewHandler(FCSActions, conf.AssetsURLPath)
-	engine.GET("/ui/view", viewHandler.Handle)
+	engine.GET("/ui/view", metrics.GinMiddleware(), viewHandler.Handle)
 
 	engine.StaticFS(
 		"/ui/assets",
@@ -125,11 +169,28 @@ func runApiServer(
 		conf.ServerInfo, conf.CorporaSetup, conf.SourcesRootDir)
 	engine.GET("/ui/form", uIActions.Handle)
 
-	logger := monitoring.NewWorkerJobLogger(conf.TimezoneLocation())
 	logger.GoRunTimelineWriter()
 
-	monitoringActions := monitoring.NewActions(logger, conf.TimezoneLocation())
+	queueStats, _ := queue.(monitoring.QueueStatsProvider)
+	if queueStats != nil {
+		prometheus.MustRegister(monitoring.NewQueueCollector(queueStats))
+	}
+	engine.GET("/metrics", gin.WrapH(metrics.Handler()))
+	workersStatus, _ := queue.(monitoring.WorkersStatusProvider)
+	monitoringActions := monitoring.NewActions(
+		logger, cacheStats, queueStats, workersStatus, conf.TimezoneLocation())
 	engine.GET("/monitoring/workers-load", monitoringActions.WorkersLoad)
+	engine.GET("/monitoring/workers-load-total", monitoringActions.WorkersLoadTotal)
+	engine.GET("/monitoring/workers-load-timeline", monitoringActions.WorkersLoadTimeline)
+	engine.GET("/monitoring/result-cache", monitoringActions.ResultCache)
+	engine.GET("/monitoring/queue", monitoringActions.Queue)
+	engine.GET("/monitoring/workers", monitoringActions.Workers)
+
+	healthChecker := health.NewChecker(conf.Health, conf.CorporaSetup, queue)
+	healthChecker.GoRunCanaries(ctx)
+	healthActions := health.NewActions(healthChecker)
+	engine.GET("/health", healthActions.Health)
+	engine.GET("/ready", healthActions.Ready)
 
 	srv := &http.Server{
 		Handler:      engine,
@@ -160,20 +221,127 @@ func runApiServer(
 	}
 }
 
-func runWorker(ctx context.Context, conf *cnf.Conf, workerID string, radapter *rdb.Adapter) {
+func runWorker(
+	ctx context.Context,
+	conf *cnf.Conf,
+	workerID string,
+	version general.VersionInfo,
+	queue rdb.QueryConsumer,
+) {
 	log.Info().Msg("Starting MQuery-SRU worker")
-	ch := radapter.Subscribe()
-	logger := monitoring.NewWorkerJobLogger(conf.TimezoneLocation())
-	w := worker.NewWorker(ctx, workerID, radapter, ch, logger)
+	ch := queue.Subscribe()
+	logger := openWorkerJobLogger(conf)
+	defer logger.Close()
+	w := worker.NewWorker(
+		ctx, workerID, version, queue, ch, logger, conf.MaxNumConcurrentJobs)
+	if addr := getWorkerMetricsAddress(conf); addr != "" {
+		srv := runWorkerMetricsServer(addr)
+		defer srv.Close()
+	}
 	w.Listen()
 }
 
-func getWorkerID() (workerID string) {
-	workerID = getEnv("WORKER_ID")
-	if workerID == "" {
-		workerID = "0"
+// runWorkerMetricsServer starts an HTTP server providing
+// Prometheus metrics of a worker process
+func runWorkerMetricsServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	srv := &http.Server{Handler: mux, Addr: addr}
+	go func() {
+		log.Info().Str("address", addr).Msg("providing worker metrics")
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error().Err(err).Msg("worker metrics server error")
+		}
+	}()
+	return srv
+}
+
+// runEmbeddedWorkers starts workers within the current
+// process (the "combined" mode). Once the `ctx` is cancelled,
+// the workers stop accepting queries and the returned WaitGroup
+// is done after they finish their running jobs.
+func runEmbeddedWorkers(
+	ctx context.Context,
+	conf *cnf.Conf,
+	version general.VersionInfo,
+	queue rdb.QueryConsumer,
+	logger *monitoring.WorkerJobLogger,
+) *sync.WaitGroup {
+	log.Info().
+		Int("numWorkers", conf.EmbeddedWorkers).
+		Int("maxNumConcurrentJobs", conf.MaxNumConcurrentJobs).
+		Msg("Starting embedded MQuery-SRU workers")
+	var workers sync.WaitGroup
+	for i := 0; i < conf.EmbeddedWorkers; i++ {
+		w := worker.NewWorker(
+			ctx,
+			fmt.Sprintf("embedded-%d", i),
+			version,
+			queue,
+			queue.Subscribe(),
+			logger,
+			conf.MaxNumConcurrentJobs,
+		)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			w.Listen()
+		}()
+	}
+	return &workers
+}
+
+// openWorkerJobLogger opens the job logs database shared by workers
+// and the monitoring API
+func openWorkerJobLogger(conf *cnf.Conf) *monitoring.WorkerJobLogger {
+	logger, err := monitoring.NewWorkerJobLogger(conf.Monitoring, conf.TimezoneLocation())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize worker job logger")
+	}
+	return logger
+}
+
+func connectRedis(ctx context.Context, conf *cnf.Conf) *rdb.Adapter {
+	if conf.Redis == nil {
+		log.Fatal().Msg("missing `redis` configuration (required unless running in the combined mode)")
+	}
+	radapter := rdb.NewAdapter(ctx, conf.Redis)
+	err := radapter.TestConnection(50*time.Second, 10*time.Second)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to connect to Redis")
+	}
+	return radapter
+}
+
+// getWorkerMetricsAddress returns an address of the worker metrics
+// server. The WORKER_METRICS_ADDRESS environment variable allows for
+// distinct addresses of multiple workers sharing a configuration.
+func getWorkerMetricsAddress(conf *cnf.Conf) string {
+	if addr := getEnv("WORKER_METRICS_ADDRESS"); addr != "" {
+		return addr
+	}
+	return conf.WorkerMetricsListenAddress
+}
+
+// getWorkerID returns an ID of the worker as specified by the WORKER_ID
+// environment variable. If not set, an ID unique among hosts and processes
+// is used (see defaultWorkerID) because workers sharing an ID would
+// overwrite their heartbeats and they would act as a single
+// Redis Streams consumer.
+func getWorkerID() string {
+	if workerID := getEnv("WORKER_ID"); workerID != "" {
+		return workerID
+	}
+	return defaultWorkerID()
+}
+
+// defaultWorkerID creates a worker ID in the form `hostname-pid`
+func defaultWorkerID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "localhost"
 	}
-	return
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
 }
 
 func main() {
@@ -187,6 +355,7 @@ func main() {
 		fmt.Fprintf(os.Stderr, "MQuery-SRU - A Manatee-open based SRU endpoint.\n\n")
 		fmt.Fprintf(os.Stderr, "Usage:\n\t%s [options] server [config.json]\n\t", filepath.Base(os.Args[0]))
 		fmt.Fprintf(os.Stderr, "Usage:\n\t%s [options] worker [config.json]\n\t", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "Usage:\n\t%s [options] combined [config.json]\n\t", filepath.Base(os.Args[0]))
 		fmt.Fprintf(os.Stderr, "Usage:\n\t%s translate [basic/advanced]\n\t", filepath.Base(os.Args[0]))
 		fmt.Fprintf(os.Stderr, "%s [options] version\n", filepath.Base(os.Args[0]))
 		flag.PrintDefaults()
@@ -242,21 +411,31 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	radapter := rdb.NewAdapter(ctx, conf.Redis)
-
 	switch action {
 	case "server":
-		err := radapter.TestConnection(50*time.Second, 10*time.Second)
-		if err != nil {
-			log.Fatal().Err(err).Msg("failed to connect to Redis")
-		}
-		runApiServer(ctx, conf, radapter)
+		radapter := connectRedis(ctx, conf)
+		logger := openWorkerJobLogger(conf)
+		defer logger.Close()
+		runApiServer(ctx, conf, radapter, radapter, logger)
 	case "worker":
-		err := radapter.TestConnection(50*time.Second, 10*time.Second)
-		if err != nil {
-			log.Fatal().Err(err).Msg("failed to connect to Redis")
+		// the adapter must outlive the signal context so the worker
+		// can still publish results of its running jobs while draining
+		radapter := connectRedis(context.Background(), conf)
+		runWorker(ctx, conf, getWorkerID(), version, radapter)
+	case "combined":
+		queryAnswerTimeout := rdb.DefaultQueryAnswerTimeout
+		if conf.Redis != nil {
+			queryAnswerTimeout = time.Duration(conf.Redis.QueryAnswerTimeoutSecs) * time.Second
 		}
-		runWorker(ctx, conf, getWorkerID(), radapter)
+		// the queue must outlive the signal context so the workers
+		// can still publish results of their running jobs while draining
+		queue := rdb.NewInProcessQueue(context.Background(), queryAnswerTimeout, conf.QueueScheduling())
+		logger := openWorkerJobLogger(conf)
+		workers := runEmbeddedWorkers(ctx, conf, version, queue, logger)
+		runApiServer(ctx, conf, queue, nil, logger)
+		log.Info().Msg("waiting for embedded workers to finish running jobs")
+		workers.Wait()
+		logger.Close()
 	default:
 		log.Fatal().Msgf("Unknown action %s", action)
 	}
@@ -21,11 +21,13 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query/compiler"
 	"github.com/czcorpus/mquery-sru/query/parser/basic"
 	"github.com/czcorpus/mquery-sru/query/parser/fcsql"
 )
@@ -46,6 +48,27 @@ func repl(translate func(string) error) {
 	}
 }
 
+// parsingError creates a parsing error with a caret
+// marking the error position (if known)
+func parsingError(err error) error {
+	var synErr *compiler.SyntaxError
+	if errors.As(err, &synErr) {
+		return fmt.Errorf("%s\nparsing error: %w", synErr.Caret(), err)
+	}
+	return fmt.Errorf("parsing error: %w", err)
+}
+
+// semanticError creates a semantic error with a caret
+// marking the position of the invalid node (if known)
+func semanticError(input string, i int, err error) error {
+	var semErr *compiler.SemanticError
+	if errors.As(err, &semErr) {
+		return fmt.Errorf(
+			"%s\nsemantic error[%d]: %w", compiler.MarkPosition(input, semErr.Pos), i, err)
+	}
+	return fmt.Errorf("semantic error[%d]: %w", i, err)
+}
+
 func translateBasicQuery(input string) error {
 	ast, err := basic.ParseQuery(
 		input,
@@ -80,12 +103,16 @@ func translateBasicQuery(input string) error {
 	)
 
 	if err != nil {
-		return fmt.Errorf("parsing error: %w", err)
+		return parsingError(err)
+	}
+	for i, err := range ast.Validate() {
+		return semanticError(input, i, err)
 	}
 	outQuery := ast.Generate()
 	for i, err := range ast.Errors() {
 		return fmt.Errorf("semantic error[%d]: %w", i, err)
 	}
+	println("canonical: " + ast.String())
 	println(outQuery)
 	return nil
 }
@@ -122,12 +149,16 @@ func translateFCSQuery(input string) error {
 	)
 
 	if err != nil {
-		return fmt.Errorf("parsing error: %w", err)
+		return parsingError(err)
+	}
+	for i, err := range ast.Validate() {
+		return semanticError(input, i, err)
 	}
 	outQuery := ast.Generate()
 	for i, err := range ast.Errors() {
 		return fmt.Errorf("semantic error[%d]: %w", i, err)
 	}
+	println("canonical: " + ast.String())
 	println(outQuery)
 	return nil
 }
@@ -26,7 +26,10 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/czcorpus/mquery-sru/auth"
 	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/health"
+	"github.com/czcorpus/mquery-sru/monitoring"
 	"github.com/czcorpus/mquery-sru/rdb"
 
 	"github.com/czcorpus/cnc-gokit/logging"
@@ -42,6 +45,8 @@ const (
 	dfltTimeZone       = "Europe/Prague"
 	dfltSourcesRootDir = "."
 	dfltAssetsURLPath  = "/"
+
+	dfltEmbeddedWorkers = 1
 )
 
 type ServerInfo struct {
@@ -144,12 +149,38 @@ type Conf struct {
 	WatchdogReqFilter *WatchdogReqFilter   `json:"watchdogReqFilter"`
 	CorporaSetup      *corpus.CorporaSetup `json:"corpora"`
 	Redis             *rdb.Conf            `json:"redis"`
+	Auth              *auth.Conf           `json:"auth"`
+	Monitoring        *monitoring.Conf     `json:"monitoring"`
+	Health            *health.Conf         `json:"health"`
 	Logging           logging.LoggingConf  `json:"logging"`
 	TimeZone          string               `json:"timeZone"`
 
+	// EmbeddedWorkers specifies number of workers running within
+	// the server process in the "combined" mode
+	EmbeddedWorkers int `json:"embeddedWorkers"`
+
+	// MaxNumConcurrentJobs specifies how many queries a single worker
+	// process (the "worker" mode) can process concurrently
+	MaxNumConcurrentJobs int `json:"maxNumConcurrentJobs"`
+
+	// WorkerMetricsListenAddress is an address (host:port) where
+	// a worker process provides its Prometheus metrics. If empty,
+	// worker metrics are not exposed (in the "combined" mode,
+	// they are available via the server's /metrics endpoint).
+	WorkerMetricsListenAddress string `json:"workerMetricsListenAddress"`
+
 	srcPath string
 }
 
+// QueueScheduling returns configuration of query scheduling.
+// Without the `redis` section (the "combined" mode), defaults are used.
+func (conf *Conf) QueueScheduling() *rdb.SchedulingConf {
+	if conf.Redis != nil {
+		return &conf.Redis.Scheduling
+	}
+	return rdb.DefaultSchedulingConf()
+}
+
 func (conf *Conf) TimezoneLocation() *time.Location {
 	// we can ignore the error here as we always call c.Validate()
 	// first (which also tries to load the location and report possible
@@ -239,10 +270,63 @@ func ValidateAndDefaults(conf *Conf) {
 		log.Fatal().Err(err).Msg("invalid configuration")
 		return
 	}
-	if err := conf.Redis.Validate(); err != nil {
+	// Redis is not needed in the "combined" mode
+	if conf.Redis != nil {
+		if err := conf.Redis.Validate(); err != nil {
+			log.Fatal().Err(err).Msg("invalid configuration")
+			return
+		}
+	}
+	if conf.EmbeddedWorkers < 0 {
+		log.Fatal().Msg("invalid configuration: embeddedWorkers must be a positive number")
+		return
+
+	} else if conf.EmbeddedWorkers == 0 {
+		conf.EmbeddedWorkers = dfltEmbeddedWorkers
+	}
+	if conf.MaxNumConcurrentJobs < 0 {
+		log.Fatal().Msg("invalid configuration: maxNumConcurrentJobs must be a positive number")
+		return
+
+	} else if conf.MaxNumConcurrentJobs == 0 {
+		conf.MaxNumConcurrentJobs = dfltMaxNumConcurrentJobs
+		log.Warn().
+			Int("value", conf.MaxNumConcurrentJobs).
+			Msg("maxNumConcurrentJobs not specified, using default")
+	}
+	if conf.Monitoring != nil {
+		if err := conf.Monitoring.ValidateAndDefaults("monitoring"); err != nil {
+			log.Fatal().Err(err).Msg("invalid configuration")
+			return
+		}
+
+	} else {
+		log.Warn().Msg("no `monitoring` section, worker job logs will not be stored")
+	}
+	if conf.Health == nil {
+		conf.Health = &health.Conf{}
+	}
+	if err := conf.Health.ValidateAndDefaults("health"); err != nil {
 		log.Fatal().Err(err).Msg("invalid configuration")
 		return
 	}
+	conf.Health.WarnMissingCanaries("corpora", conf.CorporaSetup.Resources)
+	if conf.Auth != nil {
+		if err := conf.Auth.ValidateAndDefaults("auth"); err != nil {
+			log.Fatal().Err(err).Msg("invalid configuration")
+			return
+		}
+		if conf.CorporaSetup.Resources.HasRestrictedResources() {
+			if err := conf.Auth.ValidateRestrictedAccess("auth"); err != nil {
+				log.Fatal().Err(err).Msg("invalid configuration")
+				return
+			}
+		}
+
+	} else if conf.CorporaSetup.Resources.HasRestrictedResources() {
+		log.Fatal().Msg("invalid configuration: restricted resources require the `auth` section")
+		return
+	}
 	if conf.TimeZone == "" {
 		log.Warn().
 			Str("timeZone", dfltTimeZone).
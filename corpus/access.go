@@ -0,0 +1,95 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"fmt"
+
+	"github.com/czcorpus/cnc-gokit/collections"
+)
+
+const (
+	// AccessPublic resources can be searched by anyone
+	AccessPublic AccessType = "public"
+
+	// AccessAuthenticated resources can be searched by any
+	// authenticated user
+	AccessAuthenticated AccessType = "authenticated"
+
+	// AccessEntitled resources can be searched by authenticated
+	// users with at least one of required entitlements
+	AccessEntitled AccessType = "entitled"
+)
+
+type AccessType string
+
+func (at AccessType) Validate() error {
+	if at == AccessPublic || at == AccessAuthenticated || at == AccessEntitled {
+		return nil
+	}
+	return fmt.Errorf("invalid access type `%s`", at)
+}
+
+// AccessPolicy specifies who is allowed to search a resource
+type AccessPolicy struct {
+	Type AccessType `json:"type"`
+
+	// Entitlements is a list of entitlements where at least
+	// one of them is required to access a resource with
+	// the `entitled` access type
+	Entitlements []string `json:"entitlements"`
+}
+
+func (ap AccessPolicy) IsPublic() bool {
+	return ap.Type == "" || ap.Type == AccessPublic
+}
+
+// Allows tests whether a user can access a resource. For anonymous
+// users, the `authenticated` argument is false.
+func (ap AccessPolicy) Allows(authenticated bool, entitlements []string) bool {
+	switch ap.Type {
+	case "", AccessPublic:
+		return true
+	case AccessAuthenticated:
+		return authenticated
+	case AccessEntitled:
+		if !authenticated {
+			return false
+		}
+		for _, ent := range entitlements {
+			if collections.SliceContains(ap.Entitlements, ent) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (ap *AccessPolicy) ValidateAndDefaults(confContext string) error {
+	if ap.Type == "" {
+		ap.Type = AccessPublic
+	}
+	if err := ap.Type.Validate(); err != nil {
+		return fmt.Errorf("invalid `%s.type`: %w", confContext, err)
+	}
+	if ap.Type == AccessEntitled && len(ap.Entitlements) == 0 {
+		return fmt.Errorf("`%s.entitlements` must be defined for the `entitled` access type", confContext)
+	}
+	return nil
+}
@@ -23,11 +23,13 @@ import (
 	"fmt"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/czcorpus/cnc-gokit/collections"
 	"github.com/czcorpus/cnc-gokit/fs"
 	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/query"
 	"github.com/rs/zerolog/log"
 )
 
@@ -150,6 +152,33 @@ type CorpusSetup struct {
 	ViewContextStruct string `json:"viewContextStruct"`
 
 	KontextBacklinkRootURL string `json:"kontextBacklinkRootURL"`
+
+	// DataViews lists data views available for the resource along
+	// with their delivery policy. If omitted, the "hits" and "adv"
+	// views are sent by default.
+	DataViews []DataView `json:"dataViews"`
+
+	// CMDIMetadataURL is a URL of the resource's CMDI metadata record.
+	// It is required in case the "cmdi" data view is enabled.
+	CMDIMetadataURL string `json:"cmdiMetadataURL"`
+
+	// SubResources defines searchable parts of the corpus
+	// (e.g. subcorpora of specific text types)
+	SubResources []*SubResource `json:"subResources"`
+
+	// LexFields makes the corpus a lexical resource searchable
+	// via LexFCS (each token represents a lexical entry and
+	// its fields are provided by positional attributes)
+	LexFields []LexField `json:"lexFields"`
+
+	// Access specifies who is allowed to search the corpus
+	// (by default, the corpus is public)
+	Access AccessPolicy `json:"access"`
+
+	// CanaryQuery is a selective Manatee CQL query used to check
+	// searching in the corpus. It is required unless a common
+	// query is configured (see health.Conf.CanaryQuery).
+	CanaryQuery string `json:"canaryQuery"`
 }
 
 // GetBasicSearchAttrs provides all the basic search attrs
@@ -163,6 +192,33 @@ func (cs *CorpusSetup) GetBasicSearchAttrs() []string {
 	return searchAttrs
 }
 
+// HasStructure tests whether the corpus configuration refers
+// to a structure with the provided name (either via the structure
+// mapping or as the view context structure)
+func (cs *CorpusSetup) HasStructure(name string) bool {
+	sm := cs.StructureMapping
+	for _, item := range []string{
+		sm.SentenceStruct, sm.UtteranceStruct, sm.ParagraphStruct,
+		sm.TurnStruct, sm.TextStruct, sm.SessionStruct, cs.ViewContextStruct,
+	} {
+		if item != "" && item == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPosAttr tests whether the corpus defines
+// a positional attribute with the provided name
+func (cs *CorpusSetup) HasPosAttr(name string) bool {
+	for _, item := range cs.PosAttrs {
+		if item.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // GetLayerDefault provides default positional
 // attribute for a specified layer.
 func (cs *CorpusSetup) GetLayerDefault(ln LayerType) PosAttr {
@@ -183,6 +239,71 @@ func (cs *CorpusSetup) GetDefinedLayers() *collections.Set[LayerType] {
 	return ans
 }
 
+// IsLexical tests whether the corpus is a lexical resource
+// (i.e. whether it supports LexFCS search)
+func (cs *CorpusSetup) IsLexical() bool {
+	return len(cs.LexFields) > 0
+}
+
+// GetLexFieldAttr returns a positional attribute providing values
+// of a lexical field. An empty string is returned in case
+// the field is not available.
+func (cs *CorpusSetup) GetLexFieldAttr(lft LexFieldType) string {
+	for _, item := range cs.LexFields {
+		if item.Type == lft {
+			return item.Attr
+		}
+	}
+	return ""
+}
+
+// GetLexAttrs returns positional attributes of all the lexical fields
+// (each attribute is listed once). The lemma attribute always comes
+// first so it is used as the "word" of a found entry.
+func (cs *CorpusSetup) GetLexAttrs() []string {
+	ans := make([]string, 0, len(cs.LexFields))
+	if lemmaAttr := cs.GetLexFieldAttr(LexFieldTypeLemma); lemmaAttr != "" {
+		ans = append(ans, lemmaAttr)
+	}
+	for _, item := range cs.LexFields {
+		if !collections.SliceContains(ans, item.Attr) {
+			ans = append(ans, item.Attr)
+		}
+	}
+	return ans
+}
+
+// GetLexFieldsAsRefString provides IDs of all the lexical fields
+// formatted as a single string (this is required in SRU XML)
+func (cs *CorpusSetup) GetLexFieldsAsRefString() string {
+	return strings.Join(
+		collections.SliceMap(cs.LexFields, func(v LexField, i int) string { return v.Type.ID() }),
+		" ",
+	)
+}
+
+// GetDataView returns configuration of a data view of
+// a specified type. The second returned value is false
+// in case the resource does not support the view.
+func (cs *CorpusSetup) GetDataView(dvt DataViewType) (DataView, bool) {
+	for _, item := range cs.DataViews {
+		if item.Type == dvt {
+			return item, true
+		}
+	}
+	return DataView{}, false
+}
+
+// GetDataViewsAsRefString provides IDs of all the data views
+// available for the corpus formatted as a single string
+// (this is required in SRU XML)
+func (cs *CorpusSetup) GetDataViewsAsRefString() string {
+	return strings.Join(
+		collections.SliceMap(cs.DataViews, func(v DataView, i int) string { return v.ID() }),
+		" ",
+	)
+}
+
 // GetDefinedLayersAsRefString provides all the layers
 // defined for the corpus formatted as a single string
 // (this is required in SRU XML)
@@ -213,6 +334,10 @@ func (ls *CorpusSetup) Validate(confContext string) error {
 		return fmt.Errorf("missing required configuration for `%s.description.en`", confContext)
 	}
 
+	if err := ls.Access.ValidateAndDefaults(confContext + ".access"); err != nil {
+		return err
+	}
+
 	if ls.Languages == nil {
 		return fmt.Errorf("missing required configuration section `%s.languages`", confContext)
 	}
@@ -258,6 +383,74 @@ func (ls *CorpusSetup) Validate(confContext string) error {
 			Msg("viewContextStruct not defined, using default")
 	}
 
+	for i, lf := range ls.LexFields {
+		if err := lf.Type.Validate(); err != nil {
+			return fmt.Errorf("invalid `%s.lexFields[%d]`: %w", confContext, i, err)
+		}
+		if !ls.HasPosAttr(lf.Attr) {
+			return fmt.Errorf(
+				"`%s.lexFields[%d]` refers to an undefined positional attribute `%s`",
+				confContext, i, lf.Attr,
+			)
+		}
+	}
+	if ls.IsLexical() && ls.GetLexFieldAttr(LexFieldTypeLemma) == "" {
+		return fmt.Errorf("`%s.lexFields` must contain the `lemma` field", confContext)
+	}
+
+	if len(ls.DataViews) == 0 {
+		ls.DataViews = defaultDataViews()
+		log.Warn().
+			Str("corpus", ls.ID).
+			Msg("dataViews not defined, using default")
+	}
+	if _, ok := ls.GetDataView(DataViewTypeLex); ls.IsLexical() && !ok {
+		ls.DataViews = append(
+			ls.DataViews,
+			DataView{Type: DataViewTypeLex, DeliveryPolicy: DeliveryPolicySendByDefault},
+		)
+	}
+	usedViews := make(map[DataViewType]bool)
+	for i, dv := range ls.DataViews {
+		if err := dv.Type.Validate(); err != nil {
+			return fmt.Errorf("invalid `%s.dataViews[%d]`: %w", confContext, i, err)
+		}
+		if dv.DeliveryPolicy == "" {
+			ls.DataViews[i].DeliveryPolicy = DeliveryPolicySendByDefault
+			log.Warn().
+				Str("corpus", ls.ID).
+				Str("dataView", string(dv.Type)).
+				Str("value", string(DeliveryPolicySendByDefault)).
+				Msg("deliveryPolicy not defined, using default")
+
+		} else if err := dv.DeliveryPolicy.Validate(); err != nil {
+			return fmt.Errorf("invalid `%s.dataViews[%d]`: %w", confContext, i, err)
+		}
+		if usedViews[dv.Type] {
+			return fmt.Errorf("duplicate data view `%s` in `%s.dataViews`", dv.Type, confContext)
+		}
+		usedViews[dv.Type] = true
+	}
+	if hits, ok := ls.GetDataView(DataViewTypeHits); !ok ||
+		hits.DeliveryPolicy != DeliveryPolicySendByDefault {
+		return fmt.Errorf(
+			"`%s.dataViews` must contain the `hits` view with the `send-by-default` policy",
+			confContext,
+		)
+	}
+	if usedViews[DataViewTypeCMDI] && ls.CMDIMetadataURL == "" {
+		return fmt.Errorf(
+			"`%s.cmdiMetadataURL` must be set when the `cmdi` data view is enabled",
+			confContext,
+		)
+	}
+
+	for i, sub := range ls.SubResources {
+		if err := sub.Validate(fmt.Sprintf("%s.subResources[%d]", confContext, i), ls); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -292,6 +485,95 @@ func (sr SrchResources) GetResource(ID string) (*CorpusSetup, error) {
 	return sr[resIndex], nil
 }
 
+// GetResourcesWithPosAttr returns all the resources defining
+// a positional attribute with the provided name
+func (sr SrchResources) GetResourcesWithPosAttr(name string) SrchResources {
+	ans := make(SrchResources, 0, len(sr))
+	for _, res := range sr {
+		if res.HasPosAttr(name) {
+			ans = append(ans, res)
+		}
+	}
+	return ans
+}
+
+// FilterByAccess returns the resources a user is allowed to access.
+// For anonymous users, the `authenticated` argument is false.
+func (sr SrchResources) FilterByAccess(authenticated bool, entitlements []string) SrchResources {
+	ans := make(SrchResources, 0, len(sr))
+	for _, res := range sr {
+		if res.Access.Allows(authenticated, entitlements) {
+			ans = append(ans, res)
+		}
+	}
+	return ans
+}
+
+// GetAllPosAttrNames returns names of all the positional attributes
+// defined in at least one of the resources. The names are sorted
+// alphabetically.
+func (sr SrchResources) GetAllPosAttrNames() []string {
+	ans := collections.NewSet[string]()
+	for _, res := range sr {
+		for _, pa := range res.PosAttrs {
+			ans.Add(pa.Name)
+		}
+	}
+	return ans.ToOrderedSlice()
+}
+
+// GetAllDataViews returns all the distinct data views (i.e. with
+// distinct IDs) available in at least one of the resources.
+func (sr SrchResources) GetAllDataViews() []DataView {
+	ans := make([]DataView, 0, 4)
+	used := collections.NewSet[string]()
+	for _, res := range sr {
+		for _, dv := range res.DataViews {
+			if !used.Contains(dv.ID()) {
+				used.Add(dv.ID())
+				ans = append(ans, dv)
+			}
+		}
+	}
+	return ans
+}
+
+// GetAllLexFieldTypes returns all the lexical field types
+// available in at least one of the resources
+func (sr SrchResources) GetAllLexFieldTypes() []LexFieldType {
+	ans := make([]LexFieldType, 0, 10)
+	for _, res := range sr {
+		for _, lf := range res.LexFields {
+			if !collections.SliceContains(ans, lf.Type) {
+				ans = append(ans, lf.Type)
+			}
+		}
+	}
+	return ans
+}
+
+// HasLexicalResources tests whether at least one of the resources
+// is a lexical one
+func (sr SrchResources) HasLexicalResources() bool {
+	for _, res := range sr {
+		if res.IsLexical() {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRestrictedResources tests whether at least one of the resources
+// requires authentication
+func (sr SrchResources) HasRestrictedResources() bool {
+	for _, res := range sr {
+		if !res.Access.IsPublic() {
+			return true
+		}
+	}
+	return false
+}
+
 // GetCommonPosAttrs returns positional attributes common
 // to provided corpora. The attribute of the text layer which
 // is set as default will be listed always first, the rest
@@ -383,14 +665,53 @@ func (sr SrchResources) GetCommonPosAttrNames(corpusName ...string) ([]string, e
 // Validate validates all the corpora configurations.
 // This should be run during server startup.
 func (sr SrchResources) Validate(confContext string) error {
+	usedPIDs := collections.NewSet[string]()
 	for _, corp := range sr {
 		if err := corp.Validate(fmt.Sprintf("%s[%s]", confContext, corp.ID)); err != nil {
 			return err
 		}
+		for _, sub := range corp.SubResources {
+			if sub.PID == corp.PID || usedPIDs.Contains(sub.PID) {
+				return fmt.Errorf(
+					"duplicate PID `%s` in `%s[%s].subResources`", sub.PID, confContext, corp.ID)
+			}
+			usedPIDs.Add(sub.PID)
+		}
+	}
+	for _, corp := range sr {
+		if usedPIDs.Contains(corp.PID) {
+			return fmt.Errorf("PID `%s` of `%s[%s]` used also by a sub-resource", corp.PID, confContext, corp.ID)
+		}
 	}
 	return nil
 }
 
+// SelectAll returns a selection of all the configured
+// corpora (without their sub-resources)
+func (sr SrchResources) SelectAll() ResourceSelections {
+	return collections.SliceMap(
+		sr,
+		func(v *CorpusSetup, i int) ResourceSelection { return ResourceSelection{Corpus: v} },
+	)
+}
+
+// SelectByPID returns a selection of a corpus or a sub-resource
+// matching the provided PID. In case nothing matches, ErrResourceNotFound
+// is returned.
+func (sr SrchResources) SelectByPID(PID string) (ResourceSelection, error) {
+	for _, res := range sr {
+		if res.PID == PID {
+			return ResourceSelection{Corpus: res}, nil
+		}
+		for _, sub := range res.SubResources {
+			if sub.PID == PID {
+				return ResourceSelection{Corpus: res, Sub: sub}, nil
+			}
+		}
+	}
+	return ResourceSelection{}, ErrResourceNotFound
+}
+
 // GetResourceByPID
 // in case a resource with PID does not exist, ErrResourceNotFound is returned
 func (sr SrchResources) GetResourceByPID(PID string) (*CorpusSetup, error) {
@@ -421,6 +742,24 @@ type CorporaSetup struct {
 	// MaximumContext specifies max. number of tokens left/right from hit
 	MaximumContext int `json:"maximumContext"`
 
+	// MergeStrategy specifies how lines from multiple resources are
+	// merged into a single result (can be overridden by a request
+	// via the `x-mqsru-merge-strategy` argument)
+	MergeStrategy query.MergeStrategy `json:"mergeStrategy"`
+
+	// RandomSampleSize, if greater than zero, makes searches return
+	// lines of a random sample of the size instead of the whole concordance
+	// (can be overridden by a request via the `x-mqsru-random-sample`
+	// argument where zero disables sampling)
+	RandomSampleSize int `json:"randomSampleSize"`
+
+	// RandomSampleSeed is used to select random samples. The same seed
+	// always produces the same samples so paging through results is stable.
+	RandomSampleSeed int64 `json:"randomSampleSeed"`
+
+	// QueryLimits specifies limits of query complexity
+	QueryLimits *QueryLimits `json:"queryLimits"`
+
 	// Resources is a description of configured corpora/resources
 	Resources SrchResources `json:"resources"`
 
@@ -436,6 +775,28 @@ func (cs *CorporaSetup) GetRegistryPath(corpusID string) string {
 	return filepath.Join(cs.RegistryDir, corpusID)
 }
 
+// SampleArgs returns random sample arguments for a search. In case
+// `requestedSize` is empty, the configured sample size is used. Otherwise,
+// it must be a number between zero (sampling disabled) and
+// mango.MaxSampleSizeInternalLimit. As the seed is always the configured
+// one, all the pages of a result are taken from the same sample.
+func (cs *CorporaSetup) SampleArgs(requestedSize string) (mango.SampleArgs, error) {
+	ans := mango.SampleArgs{Size: cs.RandomSampleSize, Seed: cs.RandomSampleSeed}
+	if requestedSize == "" {
+		return ans, nil
+	}
+	size, err := strconv.Atoi(requestedSize)
+	if err != nil {
+		return ans, fmt.Errorf("invalid random sample size: %w", err)
+	}
+	if size < 0 || size > mango.MaxSampleSizeInternalLimit {
+		return ans, fmt.Errorf(
+			"random sample size must be between 0 and %d", mango.MaxSampleSizeInternalLimit)
+	}
+	ans.Size = size
+	return ans, nil
+}
+
 func (cs *CorporaSetup) ValidateAndDefaults(confContext string) error {
 	if cs == nil {
 		return fmt.Errorf("missing configuration section `%s`", confContext)
@@ -471,5 +832,30 @@ func (cs *CorporaSetup) ValidateAndDefaults(confContext string) error {
 			Msgf("%s.maximumContext not set, using default", confContext)
 	}
 
+	if cs.MergeStrategy == "" {
+		cs.MergeStrategy = query.DefaultMergeStrategy
+		log.Warn().
+			Str("value", cs.MergeStrategy.String()).
+			Msgf("%s.mergeStrategy not set, using default", confContext)
+
+	} else if err := cs.MergeStrategy.Validate(); err != nil {
+		return fmt.Errorf("invalid `%s.mergeStrategy`: %w", confContext, err)
+	}
+
+	if cs.RandomSampleSize < 0 {
+		return fmt.Errorf("`%s.randomSampleSize` invalid value; has to be positive", confContext)
+
+	} else if cs.RandomSampleSize > mango.MaxSampleSizeInternalLimit {
+		return fmt.Errorf(
+			"`%s.randomSampleSize` must be at most %d", confContext, mango.MaxSampleSizeInternalLimit)
+	}
+
+	if cs.QueryLimits == nil {
+		cs.QueryLimits = &QueryLimits{}
+	}
+	if err := cs.QueryLimits.ValidateAndDefaults(confContext + ".queryLimits"); err != nil {
+		return err
+	}
+
 	return cs.Resources.Validate("resources")
 }
@@ -0,0 +1,47 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleArgs(t *testing.T) {
+	conf := &CorporaSetup{RandomSampleSize: 100, RandomSampleSeed: 7}
+
+	args, err := conf.SampleArgs("")
+	assert.NoError(t, err)
+	assert.Equal(t, mango.SampleArgs{Size: 100, Seed: 7}, args)
+
+	args, err = conf.SampleArgs("0")
+	assert.NoError(t, err)
+	assert.Equal(t, mango.SampleArgs{Size: 0, Seed: 7}, args)
+
+	args, err = conf.SampleArgs("2000")
+	assert.NoError(t, err)
+	assert.Equal(t, mango.SampleArgs{Size: 2000, Seed: 7}, args)
+
+	for _, v := range []string{"-1", "x", "1.5", "100000000"} {
+		_, err = conf.SampleArgs(v)
+		assert.Error(t, err, v)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	DataViewTypeHits     DataViewType = "hits"
+	DataViewTypeAdvanced DataViewType = "adv"
+	DataViewTypeCMDI     DataViewType = "cmdi"
+	DataViewTypeKWIC     DataViewType = "kwic"
+	DataViewTypeLex      DataViewType = "lex"
+
+	DeliveryPolicySendByDefault DeliveryPolicy = "send-by-default"
+	DeliveryPolicyNeedToRequest DeliveryPolicy = "need-to-request"
+
+	// needToRequestIDSuffix is attached to IDs of data views
+	// with the "need-to-request" policy so we can advertise
+	// one data view type with different policies for different
+	// resources
+	needToRequestIDSuffix = "-req"
+)
+
+// DataViewType represents one of the supported
+// FCS data views
+type DataViewType string
+
+func (dvt DataViewType) Validate() error {
+	if dvt == DataViewTypeHits ||
+		dvt == DataViewTypeAdvanced ||
+		dvt == DataViewTypeCMDI ||
+		dvt == DataViewTypeKWIC ||
+		dvt == DataViewTypeLex {
+		return nil
+	}
+	return fmt.Errorf("invalid data view type `%s`", dvt)
+}
+
+// MimeType returns MIME type identifying the data view
+// in SRU XML
+func (dvt DataViewType) MimeType() string {
+	switch dvt {
+	case DataViewTypeHits:
+		return "application/x-clarin-fcs-hits+xml"
+	case DataViewTypeAdvanced:
+		return "application/x-clarin-fcs-adv+xml"
+	case DataViewTypeCMDI:
+		return "application/x-cmdi+xml"
+	case DataViewTypeKWIC:
+		return "application/x-clarin-fcs-kwic+xml"
+	case DataViewTypeLex:
+		return "application/x-clarin-fcs-lex+xml"
+	}
+	return ""
+}
+
+// ----
+
+// DeliveryPolicy specifies whether a data view is sent
+// automatically or only if a client requests it
+// (via the `x-fcs-dataviews` argument)
+type DeliveryPolicy string
+
+func (dp DeliveryPolicy) Validate() error {
+	if dp == DeliveryPolicySendByDefault || dp == DeliveryPolicyNeedToRequest {
+		return nil
+	}
+	return fmt.Errorf("invalid data view delivery policy `%s`", dp)
+}
+
+// ----
+
+// DataView is a resource-specific configuration
+// of a data view
+type DataView struct {
+	Type           DataViewType   `json:"type"`
+	DeliveryPolicy DeliveryPolicy `json:"deliveryPolicy"`
+}
+
+// ID returns an identifier of the data view as advertised
+// in the endpoint description. As the policy may vary between
+// resources, the "need-to-request" variants have their own IDs.
+func (dv DataView) ID() string {
+	if dv.DeliveryPolicy == DeliveryPolicyNeedToRequest {
+		return string(dv.Type) + needToRequestIDSuffix
+	}
+	return string(dv.Type)
+}
+
+// DataViewTypeFromID converts an ID as produced by DataView.ID()
+// (or just a plain data view type) back to the data view type.
+func DataViewTypeFromID(id string) DataViewType {
+	return DataViewType(strings.TrimSuffix(id, needToRequestIDSuffix))
+}
+
+func defaultDataViews() []DataView {
+	return []DataView{
+		{Type: DataViewTypeHits, DeliveryPolicy: DeliveryPolicySendByDefault},
+		{Type: DataViewTypeAdvanced, DeliveryPolicy: DeliveryPolicySendByDefault},
+	}
+}
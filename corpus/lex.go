@@ -0,0 +1,76 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"fmt"
+)
+
+const (
+	LexFieldTypeEntryID       LexFieldType = "entryId"
+	LexFieldTypeLemma         LexFieldType = "lemma"
+	LexFieldTypePOS           LexFieldType = "pos"
+	LexFieldTypeDefinition    LexFieldType = "definition"
+	LexFieldTypeTranslation   LexFieldType = "translation"
+	LexFieldTypePhonetic      LexFieldType = "phonetic"
+	LexFieldTypeBaseform      LexFieldType = "baseform"
+	LexFieldTypeSegmentation  LexFieldType = "segmentation"
+	LexFieldTypeFrequency     LexFieldType = "frequency"
+	LexFieldTypeSynonym       LexFieldType = "synonym"
+	LexFieldTypeAntonym       LexFieldType = "antonym"
+	LexFieldTypeRelated       LexFieldType = "related"
+	LexFieldTypeCitation      LexFieldType = "citation"
+	LexFieldTypeEtymology     LexFieldType = "etymology"
+	LexFieldTypeTransliterate LexFieldType = "transliteration"
+
+	// DefaultLexFieldType is a field searched in case
+	// a LexCQL query does not specify any index
+	DefaultLexFieldType = LexFieldTypeLemma
+)
+
+// LexFieldType is a type of a lexical entry field
+// as defined by the LexFCS specification
+type LexFieldType string
+
+func (lft LexFieldType) Validate() error {
+	switch lft {
+	case LexFieldTypeEntryID, LexFieldTypeLemma, LexFieldTypePOS, LexFieldTypeDefinition,
+		LexFieldTypeTranslation, LexFieldTypePhonetic, LexFieldTypeBaseform,
+		LexFieldTypeSegmentation, LexFieldTypeFrequency, LexFieldTypeSynonym,
+		LexFieldTypeAntonym, LexFieldTypeRelated, LexFieldTypeCitation,
+		LexFieldTypeEtymology, LexFieldTypeTransliterate:
+		return nil
+	}
+	return fmt.Errorf("invalid lexical field type `%s`", lft)
+}
+
+// ID returns an identifier of the field as used
+// in the endpoint description
+func (lft LexFieldType) ID() string {
+	return "lex-" + string(lft)
+}
+
+// LexField maps a lexical entry field to a positional attribute.
+// A lexical resource (e.g. a lemma list) is expected to be a corpus
+// where each token represents a single lexical entry and individual
+// positional attributes provide the entry's fields.
+type LexField struct {
+	Type LexFieldType `json:"type"`
+	Attr string       `json:"attr"`
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"fmt"
+)
+
+// QueryLimits specifies limits of query complexity to protect
+// workers from queries occupying them for a long time
+// (e.g. `[]{0,50}` style patterns or regexps like `.*`).
+// For all the numeric limits, zero means "no limit".
+type QueryLimits struct {
+
+	// MaxSequenceLength specifies max. number of tokens
+	// in a sequence
+	MaxSequenceLength int `json:"maxSequenceLength"`
+
+	// MaxQuantifierBound specifies max. value of an explicit
+	// quantifier bound (e.g. `{0,50}`)
+	MaxQuantifierBound int `json:"maxQuantifierBound"`
+
+	// DisallowUnboundedQuantifiers rejects quantifiers without
+	// an upper bound (`*`, `+`, `{n,}`)
+	DisallowUnboundedQuantifiers bool `json:"disallowUnboundedQuantifiers"`
+
+	// DisallowLeadingWildcards rejects regular expressions starting
+	// with a wildcard (e.g. `.*ing`) which cannot use an index
+	DisallowLeadingWildcards bool `json:"disallowLeadingWildcards"`
+
+	// MaxAlternations specifies max. number of alternations
+	// (i.e. `|` in FCS-QL, `OR` in CQL) in a query
+	MaxAlternations int `json:"maxAlternations"`
+}
+
+func (ql *QueryLimits) ValidateAndDefaults(confContext string) error {
+	if ql.MaxSequenceLength < 0 {
+		return fmt.Errorf("`%s.maxSequenceLength` invalid value; has to be positive or zero", confContext)
+	}
+	if ql.MaxQuantifierBound < 0 {
+		return fmt.Errorf("`%s.maxQuantifierBound` invalid value; has to be positive or zero", confContext)
+	}
+	if ql.MaxAlternations < 0 {
+		return fmt.Errorf("`%s.maxAlternations` invalid value; has to be positive or zero", confContext)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/czcorpus/cnc-gokit/collections"
+)
+
+var structNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// SubResource is a part of a corpus (e.g. a subcorpus of fiction texts)
+// defined by a restriction on a structural attribute (e.g. `<doc genre="fiction" />`).
+// In FCS, it is exposed as a nested resource of its corpus.
+type SubResource struct {
+	PID string `json:"pid"`
+
+	// language mappings
+	FullName    map[string]string `json:"fullName"`    // section required, "en" required
+	Description map[string]string `json:"description"` // section optional, "en" required
+
+	// URI is a landing page of the sub-resource. If omitted,
+	// the parent corpus URI is used.
+	URI string `json:"uri"`
+
+	// Structure is a name of a structure used to define the sub-resource
+	// (e.g. `doc`)
+	Structure string `json:"structure"`
+
+	// Attrs maps the structure's attributes to their required values.
+	// Please note that the values are treated as regular expressions
+	// by Manatee.
+	Attrs map[string]string `json:"attrs"`
+}
+
+// WithinExpr returns a Manatee CQL `within` expression
+// restricting a search to the sub-resource
+func (sr *SubResource) WithinExpr() string {
+	attrs := make([]string, 0, len(sr.Attrs))
+	for k := range sr.Attrs {
+		attrs = append(attrs, k)
+	}
+	sort.Strings(attrs)
+	var ans strings.Builder
+	ans.WriteString("within <" + sr.Structure)
+	for _, attr := range attrs {
+		ans.WriteString(
+			fmt.Sprintf(` %s="%s"`, attr, strings.ReplaceAll(sr.Attrs[attr], `"`, `\"`)))
+	}
+	ans.WriteString(" />")
+	return ans.String()
+}
+
+// Validate validates sub-resource setup against the configuration
+// of its corpus. This should be run as part of server startup
+// (i.e. before any requests start)
+func (sr *SubResource) Validate(confContext string, corp *CorpusSetup) error {
+	if sr.PID == "" {
+		return fmt.Errorf("missing `%s.pid`", confContext)
+	}
+	if sr.FullName == nil {
+		return fmt.Errorf("missing configuration section `%s.fullName`", confContext)
+	}
+	if _, ok := sr.FullName["en"]; !ok {
+		return fmt.Errorf("missing required configuration for `%s.fullName.en`", confContext)
+	}
+	if sr.Description != nil {
+		if _, ok := sr.Description["en"]; !ok {
+			return fmt.Errorf("missing required configuration for `%s.description.en`", confContext)
+		}
+	}
+	if sr.Structure == "" {
+		return fmt.Errorf("missing `%s.structure`", confContext)
+	}
+	if !corp.HasStructure(sr.Structure) {
+		return fmt.Errorf(
+			"`%s.structure` refers to a structure `%s` not configured for the corpus "+
+				"(see `structureMapping` and `viewContextStruct`)",
+			confContext, sr.Structure,
+		)
+	}
+	if len(sr.Attrs) == 0 {
+		return fmt.Errorf("missing `%s.attrs` (at least one attribute is required)", confContext)
+	}
+	for attr := range sr.Attrs {
+		if !structNameRegexp.MatchString(attr) {
+			return fmt.Errorf("invalid attribute name `%s` in `%s.attrs`", attr, confContext)
+		}
+	}
+	return nil
+}
+
+// ----
+
+// ResourceSelection represents a searchable unit - either a whole
+// corpus or one of its sub-resources
+type ResourceSelection struct {
+	Corpus *CorpusSetup
+
+	// Sub is nil in case the whole corpus is selected
+	Sub *SubResource
+}
+
+// Key returns a unique identifier of the selection which can be
+// used to identify individual partial results
+func (rs ResourceSelection) Key() string {
+	if rs.Sub != nil {
+		return rs.Corpus.ID + "/" + rs.Sub.PID
+	}
+	return rs.Corpus.ID
+}
+
+// PID returns a PID of the selected (sub-)resource
+func (rs ResourceSelection) PID() string {
+	if rs.Sub != nil {
+		return rs.Sub.PID
+	}
+	return rs.Corpus.PID
+}
+
+// ApplyRestriction attaches the sub-resource restriction (if any)
+// to a Manatee CQL query
+func (rs ResourceSelection) ApplyRestriction(cql string) string {
+	if rs.Sub != nil {
+		return cql + " " + rs.Sub.WithinExpr()
+	}
+	return cql
+}
+
+// ResourceSelections is a list of selected searchable units
+type ResourceSelections []ResourceSelection
+
+// Keys returns keys (see ResourceSelection.Key()) of all the selections
+func (rss ResourceSelections) Keys() []string {
+	return collections.SliceMap(rss, func(v ResourceSelection, i int) string { return v.Key() })
+}
+
+// CorpusIDs returns IDs of all the corpora involved in the selection
+// (each ID is listed once)
+func (rss ResourceSelections) CorpusIDs() []string {
+	ans := make([]string, 0, len(rss))
+	for _, v := range rss {
+		if !collections.SliceContains(ans, v.Corpus.ID) {
+			ans = append(ans, v.Corpus.ID)
+		}
+	}
+	return ans
+}
+
+// Get returns a selection with the specified key
+func (rss ResourceSelections) Get(key string) (ResourceSelection, error) {
+	for _, v := range rss {
+		if v.Key() == key {
+			return v, nil
+		}
+	}
+	return ResourceSelection{}, ErrResourceNotFound
+}
+
+// SplitByAccess splits the selections into the ones a user is allowed
+// to search and the ones which must be omitted. For anonymous users,
+// the `authenticated` argument is false.
+func (rss ResourceSelections) SplitByAccess(
+	authenticated bool,
+	entitlements []string,
+) (allowed ResourceSelections, denied ResourceSelections) {
+	allowed = make(ResourceSelections, 0, len(rss))
+	denied = make(ResourceSelections, 0, len(rss))
+	for _, v := range rss {
+		if v.Corpus.Access.Allows(authenticated, entitlements) {
+			allowed = append(allowed, v)
+
+		} else {
+			denied = append(denied, v)
+		}
+	}
+	return
+}
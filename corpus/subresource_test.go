@@ -0,0 +1,153 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCorpus(id, pid string, subs ...*SubResource) *CorpusSetup {
+	return &CorpusSetup{
+		ID:          id,
+		PID:         pid,
+		FullName:    map[string]string{"en": id},
+		Description: map[string]string{"en": id},
+		Languages:   []string{"ces"},
+		PosAttrs: []PosAttr{
+			{Name: "word", Layer: LayerTypeText, IsBasicSearchAttr: true, IsLayerDefault: true},
+		},
+		StructureMapping: StructureMapping{TextStruct: "doc"},
+		DataViews: []DataView{
+			{Type: DataViewTypeHits, DeliveryPolicy: DeliveryPolicySendByDefault},
+		},
+		SubResources: subs,
+	}
+}
+
+func newTestSubResource(pid string) *SubResource {
+	return &SubResource{
+		PID:       pid,
+		FullName:  map[string]string{"en": pid},
+		Structure: "doc",
+		Attrs:     map[string]string{"genre": "fiction"},
+	}
+}
+
+func TestWithinExpr(t *testing.T) {
+	sub := &SubResource{
+		Structure: "doc",
+		Attrs:     map[string]string{"txtype": "NOV.*", "genre": `say "hi"`},
+	}
+	assert.Equal(t, `within <doc genre="say \"hi\"" txtype="NOV.*" />`, sub.WithinExpr())
+}
+
+func TestApplyRestriction(t *testing.T) {
+	corp := newTestCorpus("corp1", "pid1")
+	sel := ResourceSelection{Corpus: corp}
+	assert.Equal(t, `[word="x"]`, sel.ApplyRestriction(`[word="x"]`))
+	assert.Equal(t, "corp1", sel.Key())
+	assert.Equal(t, "pid1", sel.PID())
+
+	sel.Sub = newTestSubResource("pid1-fiction")
+	assert.Equal(
+		t,
+		`[word="x"] within <doc genre="fiction" />`,
+		sel.ApplyRestriction(`[word="x"]`),
+	)
+	assert.Equal(t, "corp1/pid1-fiction", sel.Key())
+	assert.Equal(t, "pid1-fiction", sel.PID())
+}
+
+func TestSubResourceValidate(t *testing.T) {
+	corp := newTestCorpus("corp1", "pid1")
+	corp.ViewContextStruct = "s"
+	assert.NoError(t, newTestSubResource("sub1").Validate("sub", corp))
+
+	sub := newTestSubResource("sub1")
+	sub.Structure = "s"
+	assert.NoError(t, sub.Validate("sub", corp))
+
+	sub = newTestSubResource("sub1")
+	sub.Structure = "text"
+	assert.ErrorContains(t, sub.Validate("sub", corp), "structure `text` not configured")
+
+	sub = newTestSubResource("sub1")
+	sub.Structure = ""
+	assert.ErrorContains(t, sub.Validate("sub", corp), "missing `sub.structure`")
+
+	sub = newTestSubResource("sub1")
+	sub.Attrs = map[string]string{}
+	assert.ErrorContains(t, sub.Validate("sub", corp), "missing `sub.attrs`")
+
+	for _, attr := range []string{"", "doc.genre", `genre="x"`, "1genre", "gen re"} {
+		sub = newTestSubResource("sub1")
+		sub.Attrs = map[string]string{attr: "fiction"}
+		assert.ErrorContains(t, sub.Validate("sub", corp), "invalid attribute name", attr)
+	}
+
+	sub = newTestSubResource("")
+	assert.ErrorContains(t, sub.Validate("sub", corp), "missing `sub.pid`")
+}
+
+func TestSrchResourcesValidatePIDs(t *testing.T) {
+	resources := SrchResources{
+		newTestCorpus("corp1", "pid1", newTestSubResource("pid1-a"), newTestSubResource("pid1-b")),
+		newTestCorpus("corp2", "pid2", newTestSubResource("pid2-a")),
+	}
+	assert.NoError(t, resources.Validate("corpora"))
+
+	// a sub-resource PID equal to its corpus PID
+	resources = SrchResources{
+		newTestCorpus("corp1", "pid1", newTestSubResource("pid1")),
+	}
+	assert.ErrorContains(t, resources.Validate("corpora"), "duplicate PID `pid1`")
+
+	// duplicate sub-resource PIDs within different corpora
+	resources = SrchResources{
+		newTestCorpus("corp1", "pid1", newTestSubResource("sub")),
+		newTestCorpus("corp2", "pid2", newTestSubResource("sub")),
+	}
+	assert.ErrorContains(t, resources.Validate("corpora"), "duplicate PID `sub`")
+
+	// a sub-resource PID equal to a PID of another corpus
+	// (both preceding and following)
+	resources = SrchResources{
+		newTestCorpus("corp1", "pid1", newTestSubResource("pid2")),
+		newTestCorpus("corp2", "pid2"),
+	}
+	assert.ErrorContains(t, resources.Validate("corpora"), "PID `pid2` of `corpora[corp2]`")
+	resources = SrchResources{
+		newTestCorpus("corp1", "pid1"),
+		newTestCorpus("corp2", "pid2", newTestSubResource("pid1")),
+	}
+	assert.ErrorContains(t, resources.Validate("corpora"), "PID `pid1`")
+}
+
+func TestSelectByPID(t *testing.T) {
+	sub := newTestSubResource("pid1-a")
+	resources := SrchResources{newTestCorpus("corp1", "pid1", sub)}
+	sel, err := resources.SelectByPID("pid1-a")
+	assert.NoError(t, err)
+	assert.Equal(t, sub, sel.Sub)
+	assert.Equal(t, "corp1", sel.Corpus.ID)
+	_, err = resources.SelectByPID("pid2")
+	assert.ErrorIs(t, err, ErrResourceNotFound)
+}
@@ -26,6 +26,28 @@ type DiagnosticType int
 
 type DiagnosticCode int
 
+func (dt DiagnosticType) AsMessage() string {
+	switch dt {
+	case DTPersistent:
+		return "Persistent identifier for resource is invalid"
+	case DTResourceSetTooLarge:
+		return "Resource set too large. Query context automatically adjusted"
+	case DTResourceSetTooLargeCannotPerformQuery:
+		return "Resource set too large. Cannot perform query"
+	case DTRequestedDataViewNotValid:
+		return "Requested data view not valid for this resource"
+	case DTGeneralQuerySyntaxError:
+		return "General query syntax error"
+	case DTQueryTooComplex:
+		return "Query too complex. Cannot perform query"
+	case DTQueryWasRewritten:
+		return "Query was rewritten"
+	case DTGeneralProcessingHint:
+		return "General processing hint"
+	}
+	return "??"
+}
+
 func (dc DiagnosticCode) AsMessage() string {
 	switch dc {
 	case DCGeneralSystemError:
@@ -0,0 +1,46 @@
+// Copyright 2024 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package general
+
+import "encoding/xml"
+
+// XMLRecordData wraps a record payload which can be serialized
+// either as a nested XML (the default) or as an escaped string
+// (for clients requesting string record packing). It is shared
+// by all the supported versions of the protocol.
+type XMLRecordData[T any] struct {
+	AsString bool
+	Value    T
+}
+
+func (rd XMLRecordData[T]) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if !rd.AsString {
+		// note: the element name of the payload is defined by its XMLName
+		return e.EncodeElement(struct{ Value T }{Value: rd.Value}, start)
+	}
+	data, err := xml.Marshal(rd.Value)
+	if err != nil {
+		return err
+	}
+	return e.EncodeElement(string(data), start)
+}
+
+func NewXMLRecordData[T any](value T, asString bool) XMLRecordData[T] {
+	return XMLRecordData[T]{AsString: asString, Value: value}
+}
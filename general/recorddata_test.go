@@ -0,0 +1,89 @@
+// Copyright 2024 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package general
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testPayload struct {
+	XMLName xml.Name `xml:"fcs:Resource"`
+	PID     string   `xml:"pid,attr"`
+	Text    string   `xml:"fcs:Text"`
+}
+
+type testRecord struct {
+	XMLName xml.Name                   `xml:"sru:record"`
+	Data    XMLRecordData[testPayload] `xml:"sru:recordData"`
+}
+
+func TestXMLRecordDataNested(t *testing.T) {
+	rec := testRecord{
+		Data: NewXMLRecordData(testPayload{PID: "corp1", Text: "a < b"}, false),
+	}
+	data, err := xml.Marshal(rec)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		`<sru:record><sru:recordData><fcs:Resource pid="corp1">`+
+			`<fcs:Text>a &lt; b</fcs:Text></fcs:Resource></sru:recordData></sru:record>`,
+		string(data),
+	)
+}
+
+func TestXMLRecordDataAsString(t *testing.T) {
+	rec := testRecord{
+		Data: NewXMLRecordData(testPayload{PID: "corp1", Text: "a < b"}, true),
+	}
+	data, err := xml.Marshal(rec)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		`<sru:record><sru:recordData>&lt;fcs:Resource pid=&#34;corp1&#34;&gt;`+
+			`&lt;fcs:Text&gt;a &amp;lt; b&lt;/fcs:Text&gt;&lt;/fcs:Resource&gt;`+
+			`</sru:recordData></sru:record>`,
+		string(data),
+	)
+
+	// the string form is the escaped nested form
+	var unpacked struct {
+		Data string `xml:"recordData"`
+	}
+	assert.NoError(t, xml.Unmarshal(data, &unpacked))
+	nested, err := xml.Marshal(rec.Data.Value)
+	assert.NoError(t, err)
+	assert.Equal(t, string(nested), unpacked.Data)
+}
+
+func TestXMLRecordDataIndented(t *testing.T) {
+	rec := testRecord{
+		Data: NewXMLRecordData(testPayload{PID: "corp1", Text: "x"}, false),
+	}
+	data, err := xml.MarshalIndent(rec, "", "  ")
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"<sru:record>\n  <sru:recordData>\n    <fcs:Resource pid=\"corp1\">\n"+
+			"      <fcs:Text>x</fcs:Text>\n    </fcs:Resource>\n  </sru:recordData>\n</sru:record>",
+		string(data),
+	)
+}
@@ -20,11 +20,13 @@ package handler
 
 import (
 	"github.com/czcorpus/cnc-gokit/logging"
+	"github.com/czcorpus/mquery-sru/auth"
 	"github.com/czcorpus/mquery-sru/cnf"
 	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/general"
 	v12 "github.com/czcorpus/mquery-sru/handler/v12"
 	v20 "github.com/czcorpus/mquery-sru/handler/v20"
+	"github.com/czcorpus/mquery-sru/metrics"
 	"github.com/czcorpus/mquery-sru/rdb"
 
 	"github.com/gin-gonic/gin"
@@ -48,7 +50,7 @@ type FCSSubHandler interface {
 
 type FCSHandler struct {
 	conf     *corpus.CorporaSetup
-	radapter *rdb.Adapter
+	radapter rdb.QueryPublisher
 
 	versions map[string]FCSSubHandler
 }
@@ -77,22 +79,24 @@ func (a *FCSHandler) handleWithXSLT(ctx *gin.Context, xslt map[string]string) {
 		})
 	}
 	logging.AddLogEvent(ctx, "version", req.Version)
+	metrics.SetRequestLabel(ctx, metrics.LabelVersion, req.Version)
 	handler.Handle(ctx, req, xslt)
 }
 
 func NewFCSHandler(
 	serverInfo *cnf.ServerInfo,
 	corporaConf *corpus.CorporaSetup,
-	radapter *rdb.Adapter,
+	radapter rdb.QueryPublisher,
+	authVerifier *auth.Verifier,
 ) *FCSHandler {
 	return &FCSHandler{
 		conf:     corporaConf,
 		radapter: radapter,
 		versions: map[string]FCSSubHandler{
 			Version12: v12.NewFCSSubHandlerV12(
-				serverInfo, corporaConf, radapter),
+				serverInfo, corporaConf, radapter, authVerifier),
 			Version20: v20.NewFCSSubHandlerV20(
-				serverInfo, corporaConf, radapter),
+				serverInfo, corporaConf, radapter, authVerifier),
 		},
 	}
 }
@@ -31,7 +31,7 @@ const (
 	OperationScan          Operation     = "scan"
 	OperationSearchRetrive Operation     = "searchRetrieve"
 	RecordPackingXML       RecordPacking = "xml"
-	RecordPackingString    RecordPacking = "string" // TODO for now unsupported
+	RecordPackingString    RecordPacking = "string"
 
 	SearchRetrArgVersion       SearchRetrArg = "version"
 	SearchRetrStartRecord      SearchRetrArg = "startRecord"
@@ -42,6 +42,8 @@ const (
 	SearchRetrArgFCSContext    SearchRetrArg = "x-fcs-context"
 	SearchRetrArgFCSDataViews  SearchRetrArg = "x-fcs-dataviews"
 	SearchRetrArgRecordSchema  SearchRetrArg = "recordSchema"
+	SearchRetrArgMergeStrategy SearchRetrArg = "x-mqsru-merge-strategy"
+	SearchRetrArgRandomSample  SearchRetrArg = "x-mqsru-random-sample"
 
 	ScanArgVersion          ScanArg = "version"
 	ScanArgOperation        ScanArg = "operation"
@@ -75,7 +77,7 @@ func (op Operation) Validate() error {
 type RecordPacking string
 
 func (rp RecordPacking) Validate() error {
-	if rp == RecordPackingXML {
+	if rp == RecordPackingXML || rp == RecordPackingString {
 		return nil
 	}
 	return fmt.Errorf("unsupported record packing: %s", rp)
@@ -94,7 +96,9 @@ func (sra SearchRetrArg) Validate() error {
 		sra == SearchRetrArgQuery ||
 		sra == SearchRetrArgFCSContext ||
 		sra == SearchRetrArgRecordSchema ||
-		sra == SearchRetrArgFCSDataViews {
+		sra == SearchRetrArgFCSDataViews ||
+		sra == SearchRetrArgMergeStrategy ||
+		sra == SearchRetrArgRandomSample {
 		return nil
 	}
 	return fmt.Errorf("unknown searchRetrieve argument: %s", sra)
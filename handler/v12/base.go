@@ -25,10 +25,12 @@ import (
 	"net/http"
 
 	"github.com/czcorpus/cnc-gokit/logging"
+	"github.com/czcorpus/mquery-sru/auth"
 	"github.com/czcorpus/mquery-sru/cnf"
 	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/general"
 	"github.com/czcorpus/mquery-sru/handler/v12/schema"
+	"github.com/czcorpus/mquery-sru/metrics"
 	"github.com/czcorpus/mquery-sru/rdb"
 	"github.com/rs/zerolog/log"
 
@@ -38,7 +40,10 @@ import (
 type FCSSubHandlerV12 struct {
 	serverInfo  *cnf.ServerInfo
 	corporaConf *corpus.CorporaSetup
-	radapter    *rdb.Adapter
+	radapter    rdb.QueryPublisher
+
+	// authVerifier is nil in case authentication is not configured
+	authVerifier *auth.Verifier
 }
 
 func (a *FCSSubHandlerV12) produceXMLResponse(ctx *gin.Context, code int, xslt string, data any) {
@@ -122,6 +127,7 @@ func (a *FCSSubHandlerV12) Handle(
 	fcsResponse.Operation = operation
 	fcsResponse.General.XSLT = xslt[operation.String()]
 	logging.AddLogEvent(ctx, "operation", operation)
+	metrics.SetRequestLabel(ctx, metrics.LabelOperation, operation.String())
 
 	recordPacking := getTypedArg(ctx, "recordPacking", fcsResponse.RecordPacking)
 	if err := recordPacking.Validate(); err != nil {
@@ -159,11 +165,30 @@ func (a *FCSSubHandlerV12) Handle(
 func NewFCSSubHandlerV12(
 	generalConf *cnf.ServerInfo,
 	corporaConf *corpus.CorporaSetup,
-	radapter *rdb.Adapter,
+	radapter rdb.QueryPublisher,
+	authVerifier *auth.Verifier,
 ) *FCSSubHandlerV12 {
 	return &FCSSubHandlerV12{
-		serverInfo:  generalConf,
-		corporaConf: corporaConf,
-		radapter:    radapter,
+		serverInfo:   generalConf,
+		corporaConf:  corporaConf,
+		radapter:     radapter,
+		authVerifier: authVerifier,
+	}
+}
+
+// authenticate obtains user identity from a request. For anonymous
+// users (or in case authentication is not configured), nil is returned.
+func (a *FCSSubHandlerV12) authenticate(ctx *gin.Context) (*auth.Identity, *general.FCSError) {
+	if a.authVerifier == nil {
+		return nil, nil
+	}
+	ident, err := a.authVerifier.Authenticate(ctx.Request)
+	if err != nil {
+		return nil, &general.FCSError{
+			Code:    general.DCAuthenticationError,
+			Ident:   "Authorization",
+			Message: fmt.Sprintf("Failed to authenticate user, continuing as anonymous: %s", err),
+		}
 	}
+	return ident, nil
 }
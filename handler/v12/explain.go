@@ -38,58 +38,61 @@ func (a *FCSSubHandlerV12) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 		ExplainRecord: &schema.XMLExplainRecord{
 			Schema:        "http://explain.z3950.org/dtd/2.0/",
 			RecordPacking: string(fcsResponse.RecordPacking),
-			Data: schema.XMLExplainData{
-				XMLNSZR: "http://explain.z3950.org/dtd/2.0/",
-				ServerInfo: schema.XMLExplainServerInfo{
-					Protocol:  "SRU",
-					Version:   "2.0",
-					Transport: "http",
-					Host:      a.serverInfo.ServerHost,
-					Port:      a.serverInfo.ServerPort,
-					Database:  a.serverInfo.Database,
-				},
-				DatabaseInfo: schema.XMLExplainDatabaseInfo{
-					Titles: general.MapItems(
-						a.serverInfo.DatabaseTitle,
-						func(k string, v string) schema.XMLMultilingual {
-							return schema.XMLMultilingual{Language: k, Primary: a.serverInfo.PrimaryLanguage == k, Value: v}
-						},
-					),
-					Descriptions: general.MapItems(
-						a.serverInfo.DatabaseDescription,
-						func(k string, v string) schema.XMLMultilingual {
-							return schema.XMLMultilingual{Language: k, Primary: a.serverInfo.PrimaryLanguage == k, Value: v}
+			Data: general.NewXMLRecordData(
+				schema.XMLExplainData{
+					XMLNSZR: "http://explain.z3950.org/dtd/2.0/",
+					ServerInfo: schema.XMLExplainServerInfo{
+						Protocol:  "SRU",
+						Version:   "2.0",
+						Transport: "http",
+						Host:      a.serverInfo.ServerHost,
+						Port:      a.serverInfo.ServerPort,
+						Database:  a.serverInfo.Database,
+					},
+					DatabaseInfo: schema.XMLExplainDatabaseInfo{
+						Titles: general.MapItems(
+							a.serverInfo.DatabaseTitle,
+							func(k string, v string) schema.XMLMultilingual {
+								return schema.XMLMultilingual{Language: k, Primary: a.serverInfo.PrimaryLanguage == k, Value: v}
+							},
+						),
+						Descriptions: general.MapItems(
+							a.serverInfo.DatabaseDescription,
+							func(k string, v string) schema.XMLMultilingual {
+								return schema.XMLMultilingual{Language: k, Primary: a.serverInfo.PrimaryLanguage == k, Value: v}
+							},
+						),
+						Authors: general.MapItems(
+							a.serverInfo.DatabaseAuthor,
+							func(k string, v string) schema.XMLMultilingual {
+								return schema.XMLMultilingual{Language: k, Primary: a.serverInfo.PrimaryLanguage == k, Value: v}
+							},
+						),
+					},
+					SchemaInfo: schema.XMLExplainSchemaInfo{
+						Schema: schema.XMLExplainDefinition{
+							Identifier: "http://clarin.eu/fcs/resource",
+							Name:       "fcs",
+							Titles: []schema.XMLMultilingual{
+								{Language: "en", Value: "CLARIN Federated Content Search", Primary: true},
+							},
 						},
-					),
-					Authors: general.MapItems(
-						a.serverInfo.DatabaseAuthor,
-						func(k string, v string) schema.XMLMultilingual {
-							return schema.XMLMultilingual{Language: k, Primary: a.serverInfo.PrimaryLanguage == k, Value: v}
+					},
+					ConfigInfo: schema.XMLExplainConfigInfo{Values: []schema.XMLExplainConfig{
+						schema.XMLExplainConfig{
+							XMLName: xml.Name{Local: "zr:default"},
+							Type:    "numberOfRecords",
+							Value:   corpus.ExplainOpNumberOfRecords,
 						},
-					),
-				},
-				SchemaInfo: schema.XMLExplainSchemaInfo{
-					Schema: schema.XMLExplainDefinition{
-						Identifier: "http://clarin.eu/fcs/resource",
-						Name:       "fcs",
-						Titles: []schema.XMLMultilingual{
-							{Language: "en", Value: "CLARIN Federated Content Search", Primary: true},
+						schema.XMLExplainConfig{
+							XMLName: xml.Name{Local: "zr:setting"},
+							Type:    "maximumRecords",
+							Value:   a.corporaConf.MaximumRecords,
 						},
-					},
+					}},
 				},
-				ConfigInfo: schema.XMLExplainConfigInfo{Values: []schema.XMLExplainConfig{
-					schema.XMLExplainConfig{
-						XMLName: xml.Name{Local: "zr:default"},
-						Type:    "numberOfRecords",
-						Value:   corpus.ExplainOpNumberOfRecords,
-					},
-					schema.XMLExplainConfig{
-						XMLName: xml.Name{Local: "zr:setting"},
-						Type:    "maximumRecords",
-						Value:   a.corporaConf.MaximumRecords,
-					},
-				}},
-			},
+				fcsResponse.RecordPacking == RecordPackingString,
+			),
 		},
 		EchoedRequest: &schema.XMLExplainEchoedRequest{
 			Version: "1.2",
@@ -149,6 +152,28 @@ func (a *FCSSubHandlerV12) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 								return schema.XMLMultilingual2{Language: lang, Value: title}
 							},
 						),
+						SubResources: collections.SliceMap(
+							corpusConf.SubResources,
+							func(subConf *corpus.SubResource, i int) schema.XMLExplainResource {
+								return schema.XMLExplainResource{
+									PID:                subConf.PID,
+									LandingPage:        general.ReturnIf(subConf.URI != "", subConf.URI, corpusConf.URI),
+									Languages:          corpusConf.Languages,
+									AvailableLayers:    schema.XMLExplainAvailableValues{Values: corpusConf.GetDefinedLayersAsRefString()},
+									AvailableDataViews: schema.XMLExplainAvailableValues{Values: "hits adv"},
+									Titles: general.MapItems(
+										subConf.FullName, func(lang, title string) schema.XMLMultilingual2 {
+											return schema.XMLMultilingual2{Language: lang, Value: title}
+										},
+									),
+									Descriptions: general.MapItems(
+										subConf.Description, func(lang, title string) schema.XMLMultilingual2 {
+											return schema.XMLMultilingual2{Language: lang, Value: title}
+										},
+									),
+								}
+							},
+						),
 					}
 				},
 			),
@@ -23,6 +23,7 @@ import (
 
 	"github.com/czcorpus/cnc-gokit/strutil"
 	"github.com/czcorpus/mquery-sru/general"
+	"github.com/czcorpus/mquery-sru/metrics"
 )
 
 type XMLDiagnostic struct {
@@ -60,6 +61,7 @@ func (d *XMLDiagnostics) AddDiagnostic(
 	if typ > 0 {
 		uri = append(uri, fmt.Sprintf("info:srw/diagnostic/%d", typ))
 	}
+	metrics.ObserveDiagnostic("1.2", int(code))
 	d.Diagnostics = append(d.Diagnostics, XMLDiagnostic{
 		URI:     uri,
 		Details: ident,
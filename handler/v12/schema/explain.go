@@ -18,7 +18,11 @@
 
 package schema
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+
+	"github.com/czcorpus/mquery-sru/general"
+)
 
 type XMLExplainResponse struct {
 	XMLName  xml.Name `xml:"sru:explainResponse"`
@@ -34,13 +38,14 @@ type XMLExplainResponse struct {
 // --------------------- Explain Record ---------------------
 
 type XMLExplainRecord struct {
-	Schema        string         `xml:"sru:recordSchema"`
-	RecordPacking string         `xml:"sru:recordPacking"`
-	Data          XMLExplainData `xml:"sru:recordData>zr:explain"`
+	Schema        string                                `xml:"sru:recordSchema"`
+	RecordPacking string                                `xml:"sru:recordPacking"`
+	Data          general.XMLRecordData[XMLExplainData] `xml:"sru:recordData"`
 }
 
 type XMLExplainData struct {
-	XMLNSZR string `xml:"xmlns:zr,attr"`
+	XMLName xml.Name `xml:"zr:explain"`
+	XMLNSZR string   `xml:"xmlns:zr,attr"`
 
 	ServerInfo   XMLExplainServerInfo   `xml:"zr:serverInfo"`
 	DatabaseInfo XMLExplainDatabaseInfo `xml:"zr:databaseInfo"`
@@ -142,6 +147,9 @@ type XMLExplainResource struct {
 	Languages          []string                  `xml:"ed:Languages>ed:Language"`
 	AvailableDataViews XMLExplainAvailableValues `xml:"ed:AvailableDataViews"`
 	AvailableLayers    XMLExplainAvailableValues `xml:"ed:AvailableLayers"`
+
+	// SubResources are nested resources (e.g. parts of a corpus)
+	SubResources []XMLExplainResource `xml:"ed:Resources>ed:Resource,omitempty"`
 }
 
 type XMLExplainAvailableValues struct {
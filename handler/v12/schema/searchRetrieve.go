@@ -18,7 +18,11 @@
 
 package schema
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+
+	"github.com/czcorpus/mquery-sru/general"
+)
 
 type XMLSRResponse struct {
 	XMLName          xml.Name `xml:"sru:searchRetrieveResponse"`
@@ -46,13 +50,14 @@ func NewXMLSRResponse() XMLSRResponse {
 // --------------------- Search Retrieve Record ---------------------
 
 type XMLSRRecord struct {
-	Schema         string        `xml:"sru:recordSchema"`
-	RecordPacking  string        `xml:"sru:recordPacking"`
-	Data           XMLSRResource `xml:"sru:recordData>fcs:Resource"`
-	RecordPosition int           `xml:"sru:recordPosition"`
+	Schema         string                               `xml:"sru:recordSchema"`
+	RecordPacking  string                               `xml:"sru:recordPacking"`
+	Data           general.XMLRecordData[XMLSRResource] `xml:"sru:recordData"`
+	RecordPosition int                                  `xml:"sru:recordPosition"`
 }
 
 type XMLSRResource struct {
+	XMLName          xml.Name              `xml:"fcs:Resource"`
 	XMLNSFCS         string                `xml:"xmlns:fcs,attr"`
 	PID              string                `xml:"pid,attr"`
 	ResourceFragment XMLSRResourceFragment `xml:"fcs:ResourceFragment"`
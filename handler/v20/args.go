@@ -32,8 +32,9 @@ const (
 	OperationSearchRetrive  Operation         = "searchRetrieve"
 	QueryTypeCQL            QueryType         = "cql"
 	QueryTypeFCS            QueryType         = "fcs"
+	QueryTypeLex            QueryType         = "lex"
 	RecordXMLEscapingXML    RecordXMLEscaping = "xml"
-	RecordXMLEscapingString RecordXMLEscaping = "string" // TODO for now unsupported
+	RecordXMLEscapingString RecordXMLEscaping = "string"
 
 	SearchRetrArgVersion            SearchRetrArg = "version"
 	SearchRetrStartRecord           SearchRetrArg = "startRecord"
@@ -46,6 +47,8 @@ const (
 	SearchRetrArgFCSContext         SearchRetrArg = "x-fcs-context"
 	SearchRetrArgFCSDataViews       SearchRetrArg = "x-fcs-dataviews"
 	SearchRetrArgFCSRewritesAllowed SearchRetrArg = "x-fcs-rewrites-allowed"
+	SearchRetrArgMergeStrategy      SearchRetrArg = "x-mqsru-merge-strategy"
+	SearchRetrArgRandomSample       SearchRetrArg = "x-mqsru-random-sample"
 
 	ScanArgVersion           ScanArg = "version"
 	ScanArgOperation         ScanArg = "operation"
@@ -60,6 +63,10 @@ const (
 	ExplainArgFCSEndpointDescription ExplainArg = "x-fcs-endpoint-description"
 
 	DefaultQueryType QueryType = QueryTypeCQL
+
+	CapabilityBasicSearch    = "http://clarin.eu/fcs/capability/basic-search"
+	CapabilityAdvancedSearch = "http://clarin.eu/fcs/capability/advanced-search"
+	CapabilityLexSearch      = "http://clarin.eu/fcs/capability/lex-search"
 )
 
 type Operation string
@@ -81,7 +88,7 @@ func (op Operation) Validate() error {
 type QueryType string
 
 func (qt QueryType) Validate() error {
-	if qt == QueryTypeCQL || qt == QueryTypeFCS {
+	if qt == QueryTypeCQL || qt == QueryTypeFCS || qt == QueryTypeLex {
 		return nil
 	}
 	return fmt.Errorf("unknown query type: %s", qt)
@@ -96,7 +103,7 @@ func (qt QueryType) String() string {
 type RecordXMLEscaping string
 
 func (rp RecordXMLEscaping) Validate() error {
-	if rp == RecordXMLEscapingXML {
+	if rp == RecordXMLEscapingXML || rp == RecordXMLEscapingString {
 		return nil
 	}
 	return fmt.Errorf("unsupported record XML escaping: %s", rp)
@@ -117,7 +124,9 @@ func (sra SearchRetrArg) Validate() error {
 		sra == SearchRetrArgRecordSchema ||
 		sra == SearchRetrArgFCSContext ||
 		sra == SearchRetrArgFCSDataViews ||
-		sra == SearchRetrArgFCSRewritesAllowed {
+		sra == SearchRetrArgFCSRewritesAllowed ||
+		sra == SearchRetrArgMergeStrategy ||
+		sra == SearchRetrArgRandomSample {
 		return nil
 	}
 	return fmt.Errorf("unknown searchRetrieve argument: %s", sra)
@@ -181,3 +190,16 @@ func fetchContext(ctx *gin.Context) []string {
 	}
 	return tmp
 }
+
+// fetchDataViews returns data view IDs requested
+// via the `x-fcs-dataviews` argument
+func fetchDataViews(ctx *gin.Context) []string {
+	tmp := strings.Split(ctx.DefaultQuery(SearchRetrArgFCSDataViews.String(), ""), ",")
+	ans := make([]string, 0, len(tmp))
+	for _, v := range tmp {
+		if v = strings.TrimSpace(v); v != "" {
+			ans = append(ans, v)
+		}
+	}
+	return ans
+}
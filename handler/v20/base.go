@@ -25,10 +25,12 @@ import (
 	"net/http"
 
 	"github.com/czcorpus/cnc-gokit/logging"
+	"github.com/czcorpus/mquery-sru/auth"
 	"github.com/czcorpus/mquery-sru/cnf"
 	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/general"
 	"github.com/czcorpus/mquery-sru/handler/v20/schema"
+	"github.com/czcorpus/mquery-sru/metrics"
 	"github.com/czcorpus/mquery-sru/rdb"
 	"github.com/rs/zerolog/log"
 
@@ -38,7 +40,10 @@ import (
 type FCSSubHandlerV20 struct {
 	serverInfo  *cnf.ServerInfo
 	corporaConf *corpus.CorporaSetup
-	radapter    *rdb.Adapter
+	radapter    rdb.QueryPublisher
+
+	// authVerifier is nil in case authentication is not configured
+	authVerifier *auth.Verifier
 }
 
 func (a *FCSSubHandlerV20) produceXMLResponse(ctx *gin.Context, code int, xslt string, data any) {
@@ -118,6 +123,7 @@ func (a *FCSSubHandlerV20) Handle(
 	fcsRequest.Operation = operation
 	fcsRequest.General.XSLT = xslt[operation.String()]
 	logging.AddLogEvent(ctx, "operation", operation)
+	metrics.SetRequestLabel(ctx, metrics.LabelOperation, operation.String())
 
 	recordXMLEscaping := getTypedArg(ctx, "recordXMLEscaping", fcsRequest.RecordXMLEscaping)
 	if err := recordXMLEscaping.Validate(); err != nil {
@@ -156,11 +162,30 @@ func (a *FCSSubHandlerV20) Handle(
 func NewFCSSubHandlerV20(
 	generalConf *cnf.ServerInfo,
 	corporaConf *corpus.CorporaSetup,
-	radapter *rdb.Adapter,
+	radapter rdb.QueryPublisher,
+	authVerifier *auth.Verifier,
 ) *FCSSubHandlerV20 {
 	return &FCSSubHandlerV20{
-		serverInfo:  generalConf,
-		corporaConf: corporaConf,
-		radapter:    radapter,
+		serverInfo:   generalConf,
+		corporaConf:  corporaConf,
+		radapter:     radapter,
+		authVerifier: authVerifier,
+	}
+}
+
+// authenticate obtains user identity from a request. For anonymous
+// users (or in case authentication is not configured), nil is returned.
+func (a *FCSSubHandlerV20) authenticate(ctx *gin.Context) (*auth.Identity, *general.FCSError) {
+	if a.authVerifier == nil {
+		return nil, nil
+	}
+	ident, err := a.authVerifier.Authenticate(ctx.Request)
+	if err != nil {
+		return nil, &general.FCSError{
+			Code:    general.DCAuthenticationError,
+			Ident:   "Authorization",
+			Message: fmt.Sprintf("Failed to authenticate user, continuing as anonymous: %s", err),
+		}
 	}
+	return ident, nil
 }
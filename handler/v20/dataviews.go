@@ -0,0 +1,252 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package v20
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/czcorpus/cnc-gokit/collections"
+	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/czcorpus/mquery-sru/handler/v20/schema"
+)
+
+// validateRequestedDataViews checks data views requested via `x-fcs-dataviews`
+// against the data views configured for the searched resources. It returns
+// all the recognized view types along with non-fatal errors describing
+// views which are unknown or unavailable for some of the resources.
+func (a *FCSSubHandlerV20) validateRequestedDataViews(
+	requested []string,
+	corpora []string,
+) (*collections.Set[corpus.DataViewType], []general.FCSError) {
+	ans := collections.NewSet[corpus.DataViewType]()
+	errs := make([]general.FCSError, 0, len(requested))
+	for _, viewID := range requested {
+		dvt := corpus.DataViewTypeFromID(viewID)
+		if err := dvt.Validate(); err != nil {
+			errs = append(errs, general.FCSError{
+				Type:    general.DTRequestedDataViewNotValid,
+				Ident:   viewID,
+				Message: fmt.Sprintf("Unknown data view `%s`", viewID),
+			})
+			continue
+		}
+		ans.Add(dvt)
+		for _, corp := range corpora {
+			res, err := a.corporaConf.Resources.GetResource(corp)
+			if err != nil {
+				continue
+			}
+			if _, ok := res.GetDataView(dvt); !ok {
+				errs = append(errs, general.FCSError{
+					Type:  general.DTRequestedDataViewNotValid,
+					Ident: viewID,
+					Message: fmt.Sprintf(
+						"Data view `%s` not available for resource %s", viewID, res.PID),
+				})
+			}
+		}
+	}
+	return ans, errs
+}
+
+// shouldSendDataView decides whether a data view is attached
+// to a record. Views with the "need-to-request" policy are
+// sent only if requested. The advanced view is sent by default
+// only for FCS-QL queries (for CQL, it must be requested).
+// The lexical entry view is available only for LexCQL queries
+// as other queries do not retrieve lexical fields.
+func shouldSendDataView(
+	dv corpus.DataView,
+	requested *collections.Set[corpus.DataViewType],
+	queryType QueryType,
+) bool {
+	if dv.Type == corpus.DataViewTypeLex && queryType != QueryTypeLex {
+		return false
+	}
+	if requested.Contains(dv.Type) {
+		return true
+	}
+	if dv.DeliveryPolicy != corpus.DeliveryPolicySendByDefault {
+		return false
+	}
+	return dv.Type != corpus.DataViewTypeAdvanced || queryType == QueryTypeFCS
+}
+
+func mkHitsDataView(item *concordance.Line) *schema.XMLSRDataView {
+	return &schema.XMLSRDataView{
+		Type: corpus.DataViewTypeHits.MimeType(),
+		Result: schema.XMLSRBasicDataViewResult{
+			XMLNSHits: "http://clarin.eu/fcs/dataview/hits",
+			Data: strings.Join(
+				collections.SliceMap(
+					item.Text.Tokens(),
+					func(token *concordance.Token, i int) string {
+						if token.Strong {
+							return "<hits:Hit>" + token.Word + "</hits:Hit>"
+						}
+						return token.Word
+					},
+				),
+				" ",
+			),
+		},
+	}
+}
+
+func (a *FCSSubHandlerV20) mkAdvDataView(
+	item *concordance.Line,
+	commonLayers []corpus.LayerType,
+	commonPosAttrs []corpus.PosAttr,
+) *schema.XMLSRDataView {
+	segmentPos := 1
+	return &schema.XMLSRDataView{
+		Type: corpus.DataViewTypeAdvanced.MimeType(),
+		Result: schema.XMLSRAdvancedDataViewResult{
+			Unit:     "item",
+			XMLNSAdv: "http://clarin.eu/fcs/dataview/advanced",
+			Segments: collections.SliceMap(
+				item.Text.Tokens(),
+				func(token *concordance.Token, i int) schema.XMLSRAdvSegment {
+					segment := schema.XMLSRAdvSegment{
+						ID:    fmt.Sprintf("s%d", i),
+						Start: segmentPos,
+						End:   segmentPos + len(token.Word) - 1,
+					}
+					segmentPos += len(token.Word) + 1 // with space between words
+					return segment
+				},
+			),
+			Layers: collections.SliceMap(
+				commonLayers,
+				func(layer corpus.LayerType, j int) schema.XMLSRAdvLayer {
+					return schema.XMLSRAdvLayer{
+						ID: layer.GetResultID(),
+						Values: collections.SliceMap(
+							item.Text.Tokens(),
+							func(token *concordance.Token, i int) schema.XMLSRAdvValue {
+								return schema.XMLSRAdvValue{
+									Ref:       fmt.Sprintf("s%d", i),
+									Highlight: general.ReturnIf(token.Strong, fmt.Sprintf("s%d", i), ""),
+									Value:     a.getAttrByLayers(commonPosAttrs, layer, *token),
+								}
+							},
+						),
+					}
+				},
+			),
+		},
+	}
+}
+
+// mkKWICDataView creates the legacy (FCS 0.9) KWIC view where
+// the hit is split into the left context, the keyword
+// and the right context
+func mkKWICDataView(item *concordance.Line) *schema.XMLSRDataView {
+	left := make([]string, 0, 20)
+	kw := make([]string, 0, 5)
+	right := make([]string, 0, 20)
+	for _, token := range item.Text.Tokens() {
+		if token.Strong {
+			kw = append(kw, token.Word)
+
+		} else if len(kw) == 0 {
+			left = append(left, token.Word)
+
+		} else {
+			right = append(right, token.Word)
+		}
+	}
+	return &schema.XMLSRDataView{
+		Type: corpus.DataViewTypeKWIC.MimeType(),
+		Result: schema.XMLSRKWICDataViewResult{
+			XMLNSKWIC: "http://clarin.eu/fcs/1.0/kwic",
+			Parts: []schema.XMLSRKWICPart{
+				{
+					XMLName: xml.Name{Local: "kwic:c"},
+					Type:    "left",
+					Value:   strings.Join(left, " "),
+				},
+				{
+					XMLName: xml.Name{Local: "kwic:kw"},
+					Value:   strings.Join(kw, " "),
+				},
+				{
+					XMLName: xml.Name{Local: "kwic:c"},
+					Type:    "right",
+					Value:   strings.Join(right, " "),
+				},
+			},
+		},
+	}
+}
+
+// mkCMDIDataView creates a view referring to the resource's
+// CMDI metadata record
+func mkCMDIDataView(res *corpus.CorpusSetup) *schema.XMLSRDataView {
+	return &schema.XMLSRDataView{
+		Type: corpus.DataViewTypeCMDI.MimeType(),
+		Ref:  res.CMDIMetadataURL,
+	}
+}
+
+// mkLexDataView creates a LexFCS view describing a found
+// lexical entry. Values of the entry fields are taken from
+// the positional attributes of the matching token.
+func mkLexDataView(item *concordance.Line, res *corpus.CorpusSetup) *schema.XMLSRDataView {
+	fields := make([]schema.XMLSRLexField, 0, len(res.LexFields))
+	tokens := item.Text.Tokens()
+	var entryToken *concordance.Token
+	if len(tokens) > 0 {
+		entryToken = tokens[0]
+	}
+	for _, token := range tokens {
+		if token.Strong {
+			entryToken = token
+			break
+		}
+	}
+	lexAttrs := res.GetLexAttrs()
+	for _, lf := range res.LexFields {
+		if entryToken == nil {
+			break
+		}
+		value := entryToken.Attrs[lf.Attr]
+		if lf.Attr == lexAttrs[0] {
+			value = entryToken.Word
+		}
+		if value == "" {
+			continue
+		}
+		fields = append(fields, schema.XMLSRLexField{
+			Type:   string(lf.Type),
+			Values: []string{value},
+		})
+	}
+	return &schema.XMLSRDataView{
+		Type: corpus.DataViewTypeLex.MimeType(),
+		Result: schema.XMLSRLexDataViewResult{
+			XMLNSLex: "http://clarin.eu/fcs/dataview/lex",
+			Fields:   fields,
+		},
+	}
+}
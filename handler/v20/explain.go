@@ -22,6 +22,7 @@ package v20
 import (
 	"encoding/xml"
 	"net/http"
+	"strings"
 
 	"github.com/czcorpus/cnc-gokit/collections"
 	"github.com/czcorpus/mquery-sru/corpus"
@@ -38,77 +39,107 @@ func (a *FCSSubHandlerV20) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 		ExplainRecord: &schema.XMLExplainRecord{
 			Schema:      "http://explain.z3950.org/dtd/2.0/",
 			XMLEscaping: string(fcsResponse.RecordXMLEscaping),
-			Data: schema.XMLExplainData{
-				XMLNSZR: "http://explain.z3950.org/dtd/2.0/",
-				ServerInfo: schema.XMLExplainServerInfo{
-					Protocol:  "SRU",
-					Version:   "2.0",
-					Transport: "http",
-					Host:      a.serverInfo.ServerHost,
-					Port:      a.serverInfo.ServerPort,
-					Database:  a.serverInfo.Database,
-				},
-				DatabaseInfo: schema.XMLExplainDatabaseInfo{
-					Titles: general.MapItems(
-						a.serverInfo.DatabaseTitle,
-						func(k string, v string) schema.XMLMultilingual {
-							return schema.XMLMultilingual{Language: k, Primary: a.serverInfo.PrimaryLanguage == k, Value: v}
-						},
-					),
-					Descriptions: general.MapItems(
-						a.serverInfo.DatabaseDescription,
-						func(k string, v string) schema.XMLMultilingual {
-							return schema.XMLMultilingual{Language: k, Primary: a.serverInfo.PrimaryLanguage == k, Value: v}
-						},
-					),
-					Authors: general.MapItems(
-						a.serverInfo.DatabaseAuthor,
-						func(k string, v string) schema.XMLMultilingual {
-							return schema.XMLMultilingual{Language: k, Primary: a.serverInfo.PrimaryLanguage == k, Value: v}
-						},
-					),
-				},
-				IndexInfo: schema.XMLExplainIndexInfo{
-					Set: schema.XMLExplainDefinition{
-						Identifier: "http://clarin.eu/fcs/resource",
-						Name:       "fcs",
-						Titles: []schema.XMLMultilingual{
-							{Language: "se", Value: "Clarins innehållssökning"},
-							{Language: "en", Value: "CLARIN Content Search", Primary: true},
-						},
+			Data: general.NewXMLRecordData(
+				schema.XMLExplainData{
+					XMLNSZR: "http://explain.z3950.org/dtd/2.0/",
+					ServerInfo: schema.XMLExplainServerInfo{
+						Protocol:  "SRU",
+						Version:   "2.0",
+						Transport: "http",
+						Host:      a.serverInfo.ServerHost,
+						Port:      a.serverInfo.ServerPort,
+						Database:  a.serverInfo.Database,
 					},
-					Index: schema.XMLExplainIndexInfoIndex{
-						Search: true, Scan: false, Sort: false,
-						Titles: []schema.XMLMultilingual{
-							{Language: "en", Value: "Words", Primary: true},
-						},
-						Maps: []schema.XMLExplainIndexInfoIndexMap{
-							{Primary: true, Name: schema.XMLExplainIndexInfoIndexMapName{Set: "fcs", Value: "words"}},
+					DatabaseInfo: schema.XMLExplainDatabaseInfo{
+						Titles: general.MapItems(
+							a.serverInfo.DatabaseTitle,
+							func(k string, v string) schema.XMLMultilingual {
+								return schema.XMLMultilingual{Language: k, Primary: a.serverInfo.PrimaryLanguage == k, Value: v}
+							},
+						),
+						Descriptions: general.MapItems(
+							a.serverInfo.DatabaseDescription,
+							func(k string, v string) schema.XMLMultilingual {
+								return schema.XMLMultilingual{Language: k, Primary: a.serverInfo.PrimaryLanguage == k, Value: v}
+							},
+						),
+						Authors: general.MapItems(
+							a.serverInfo.DatabaseAuthor,
+							func(k string, v string) schema.XMLMultilingual {
+								return schema.XMLMultilingual{Language: k, Primary: a.serverInfo.PrimaryLanguage == k, Value: v}
+							},
+						),
+					},
+					IndexInfo: schema.XMLExplainIndexInfo{
+						Set: schema.XMLExplainDefinition{
+							Identifier: "http://clarin.eu/fcs/resource",
+							Name:       "fcs",
+							Titles: []schema.XMLMultilingual{
+								{Language: "se", Value: "Clarins innehållssökning"},
+								{Language: "en", Value: "CLARIN Content Search", Primary: true},
+							},
 						},
+						Indexes: append(
+							[]schema.XMLExplainIndexInfoIndex{
+								{
+									Search: true, Scan: false, Sort: false,
+									Titles: []schema.XMLMultilingual{
+										{Language: "en", Value: "Words", Primary: true},
+									},
+									Maps: []schema.XMLExplainIndexInfoIndexMap{
+										{Primary: true, Name: schema.XMLExplainIndexInfoIndexMapName{Set: "fcs", Value: "words"}},
+									},
+								},
+								{
+									Search: false, Scan: true, Sort: false,
+									Titles: []schema.XMLMultilingual{
+										{Language: "en", Value: "Resources", Primary: true},
+									},
+									Maps: []schema.XMLExplainIndexInfoIndexMap{
+										{Primary: true, Name: schema.XMLExplainIndexInfoIndexMapName{Set: "fcs", Value: "resource"}},
+									},
+								},
+							},
+							collections.SliceMap(
+								a.corporaConf.Resources.GetAllPosAttrNames(),
+								func(name string, i int) schema.XMLExplainIndexInfoIndex {
+									return schema.XMLExplainIndexInfoIndex{
+										Search: false, Scan: true, Sort: false,
+										Titles: []schema.XMLMultilingual{
+											{Language: "en", Value: name, Primary: true},
+										},
+										Maps: []schema.XMLExplainIndexInfoIndexMap{
+											{Primary: true, Name: schema.XMLExplainIndexInfoIndexMapName{Value: name}},
+										},
+									}
+								},
+							)...,
+						),
 					},
-				},
-				SchemaInfo: schema.XMLExplainSchemaInfo{
-					Schema: schema.XMLExplainDefinition{
-						Identifier: "http://clarin.eu/fcs/resource",
-						Name:       "fcs",
-						Titles: []schema.XMLMultilingual{
-							{Language: "en", Value: "CLARIN Federated Content Search", Primary: true},
+					SchemaInfo: schema.XMLExplainSchemaInfo{
+						Schema: schema.XMLExplainDefinition{
+							Identifier: "http://clarin.eu/fcs/resource",
+							Name:       "fcs",
+							Titles: []schema.XMLMultilingual{
+								{Language: "en", Value: "CLARIN Federated Content Search", Primary: true},
+							},
 						},
 					},
+					ConfigInfo: schema.XMLExplainConfigInfo{Values: []schema.XMLExplainConfig{
+						schema.XMLExplainConfig{
+							XMLName: xml.Name{Local: "zr:default"},
+							Type:    "numberOfRecords",
+							Value:   corpus.ExplainOpNumberOfRecords,
+						},
+						schema.XMLExplainConfig{
+							XMLName: xml.Name{Local: "zr:setting"},
+							Type:    "maximumRecords",
+							Value:   a.corporaConf.MaximumRecords,
+						},
+					}},
 				},
-				ConfigInfo: schema.XMLExplainConfigInfo{Values: []schema.XMLExplainConfig{
-					schema.XMLExplainConfig{
-						XMLName: xml.Name{Local: "zr:default"},
-						Type:    "numberOfRecords",
-						Value:   corpus.ExplainOpNumberOfRecords,
-					},
-					schema.XMLExplainConfig{
-						XMLName: xml.Name{Local: "zr:setting"},
-						Type:    "maximumRecords",
-						Value:   a.corporaConf.MaximumRecords,
-					},
-				}},
-			},
+				fcsResponse.RecordXMLEscaping == RecordXMLEscapingString,
+			),
 		},
 		EchoedRequest: &schema.XMLExplainEchoedRequest{
 			Version: "2.0",
@@ -130,14 +161,17 @@ func (a *FCSSubHandlerV20) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 			XMLNSED: "http://clarin.eu/fcs/endpoint-description",
 			Version: "2",
 
-			Capabilities: []string{
-				"http://clarin.eu/fcs/capability/basic-search",
-				"http://clarin.eu/fcs/capability/advanced-search",
-			},
-			SupportedDataViews: []schema.XMLExplainSupportedDataView{
-				{ID: "hits", DeliveryPolicy: "send-by-default", Value: "application/x-clarin-fcs-hits+xml"},
-				{ID: "adv", DeliveryPolicy: "send-by-default", Value: "application/x-clarin-fcs-adv+xml"},
-			},
+			Capabilities: a.getCapabilities(),
+			SupportedDataViews: collections.SliceMap(
+				a.corporaConf.Resources.GetAllDataViews(),
+				func(dv corpus.DataView, i int) schema.XMLExplainSupportedDataView {
+					return schema.XMLExplainSupportedDataView{
+						ID:             dv.ID(),
+						DeliveryPolicy: string(dv.DeliveryPolicy),
+						Value:          dv.Type.MimeType(),
+					}
+				},
+			),
 			SupportedLayers: collections.SliceMap(
 				a.corporaConf.Resources.GetCommonPosAttrs2(),
 				func(posAttr corpus.PosAttr, i int) schema.XMLExplainSupportedLayer {
@@ -149,15 +183,27 @@ func (a *FCSSubHandlerV20) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 					}
 				},
 			),
+			SupportedLexFields: collections.SliceMap(
+				a.corporaConf.Resources.GetAllLexFieldTypes(),
+				func(lft corpus.LexFieldType, i int) schema.XMLExplainSupportedLexField {
+					return schema.XMLExplainSupportedLexField{
+						ID:    lft.ID(),
+						Value: string(lft),
+					}
+				},
+			),
 			Resources: collections.SliceMap(
 				a.corporaConf.Resources,
 				func(corpusConf *corpus.CorpusSetup, i int) schema.XMLExplainResource {
 					return schema.XMLExplainResource{
-						PID:                corpusConf.PID,
-						LandingPage:        corpusConf.URI,
-						Languages:          corpusConf.Languages,
-						AvailableLayers:    schema.XMLExplainAvailableValues{Values: corpusConf.GetDefinedLayersAsRefString()},
-						AvailableDataViews: schema.XMLExplainAvailableValues{Values: "hits adv"},
+						PID:                     corpusConf.PID,
+						LandingPage:             corpusConf.URI,
+						Languages:               corpusConf.Languages,
+						AvailableLayers:         schema.XMLExplainAvailableValues{Values: corpusConf.GetDefinedLayersAsRefString()},
+						AvailableDataViews:      schema.XMLExplainAvailableValues{Values: corpusConf.GetDataViewsAsRefString()},
+						AvailableLexFields:      mkAvailableLexFields(corpusConf),
+						AvailableCapabilities:   mkAvailableCapabilities(corpusConf),
+						AvailabilityRestriction: general.ReturnIf(corpusConf.Access.IsPublic(), "", "authOnly"),
 						Titles: general.MapItems(
 							corpusConf.FullName, func(lang, title string) schema.XMLMultilingual2 {
 								return schema.XMLMultilingual2{Language: lang, Value: title}
@@ -168,6 +214,31 @@ func (a *FCSSubHandlerV20) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 								return schema.XMLMultilingual2{Language: lang, Value: title}
 							},
 						),
+						SubResources: collections.SliceMap(
+							corpusConf.SubResources,
+							func(subConf *corpus.SubResource, i int) schema.XMLExplainResource {
+								return schema.XMLExplainResource{
+									PID:                     subConf.PID,
+									LandingPage:             general.ReturnIf(subConf.URI != "", subConf.URI, corpusConf.URI),
+									Languages:               corpusConf.Languages,
+									AvailableLayers:         schema.XMLExplainAvailableValues{Values: corpusConf.GetDefinedLayersAsRefString()},
+									AvailableDataViews:      schema.XMLExplainAvailableValues{Values: corpusConf.GetDataViewsAsRefString()},
+									AvailableLexFields:      mkAvailableLexFields(corpusConf),
+									AvailableCapabilities:   mkAvailableCapabilities(corpusConf),
+									AvailabilityRestriction: general.ReturnIf(corpusConf.Access.IsPublic(), "", "authOnly"),
+									Titles: general.MapItems(
+										subConf.FullName, func(lang, title string) schema.XMLMultilingual2 {
+											return schema.XMLMultilingual2{Language: lang, Value: title}
+										},
+									),
+									Descriptions: general.MapItems(
+										subConf.Description, func(lang, title string) schema.XMLMultilingual2 {
+											return schema.XMLMultilingual2{Language: lang, Value: title}
+										},
+									),
+								}
+							},
+						),
 					}
 				},
 			),
@@ -175,3 +246,32 @@ func (a *FCSSubHandlerV20) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 	}
 	return ans, http.StatusOK
 }
+
+// getCapabilities returns endpoint capabilities. The lexical search
+// is advertised only if there is at least one lexical resource.
+func (a *FCSSubHandlerV20) getCapabilities() []string {
+	ans := []string{CapabilityBasicSearch, CapabilityAdvancedSearch}
+	if a.corporaConf.Resources.HasLexicalResources() {
+		ans = append(ans, CapabilityLexSearch)
+	}
+	return ans
+}
+
+func mkAvailableLexFields(corpusConf *corpus.CorpusSetup) *schema.XMLExplainAvailableValues {
+	if !corpusConf.IsLexical() {
+		return nil
+	}
+	return &schema.XMLExplainAvailableValues{Values: corpusConf.GetLexFieldsAsRefString()}
+}
+
+// mkAvailableCapabilities lists capabilities of a lexical resource
+// (for other resources, the endpoint's capabilities apply)
+func mkAvailableCapabilities(corpusConf *corpus.CorpusSetup) *schema.XMLExplainAvailableValues {
+	if !corpusConf.IsLexical() {
+		return nil
+	}
+	return &schema.XMLExplainAvailableValues{
+		Values: strings.Join(
+			[]string{CapabilityBasicSearch, CapabilityAdvancedSearch, CapabilityLexSearch}, " "),
+	}
+}
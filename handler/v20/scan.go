@@ -19,16 +19,143 @@
 package v20
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 
+	"github.com/czcorpus/cnc-gokit/collections"
+	"github.com/czcorpus/cnc-gokit/logging"
+	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/general"
 	"github.com/czcorpus/mquery-sru/handler/v20/schema"
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/czcorpus/mquery-sru/result"
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	ScanIndexFCSResource = "fcs.resource"
+	ScanTermRoot         = "root"
+
+	dfltScanMaximumTerms = 100
+)
+
+var (
+	scanClauseRegexp = regexp.MustCompile(`^\s*([\w.:-]+)\s*(?:(==|=|exact)\s*(.*?))?\s*$`)
+)
+
+// scanClause is a parsed `scanClause` argument of the scan operation
+// (e.g. `fcs.resource = root`, `lemma = "walk"`)
+type scanClause struct {
+	index string
+	term  string
+}
+
+func parseScanClause(v string) (scanClause, error) {
+	srch := scanClauseRegexp.FindStringSubmatch(v)
+	if len(srch) == 0 {
+		return scanClause{}, fmt.Errorf("invalid scan clause: %s", v)
+	}
+	term := srch[3]
+	if len(term) >= 2 && strings.HasPrefix(term, `"`) && strings.HasSuffix(term, `"`) {
+		term = strings.ReplaceAll(term[1:len(term)-1], `\"`, `"`)
+	}
+	return scanClause{index: srch[1], term: term}, nil
+}
+
+// scanWindow calculates how many terms should be listed before
+// and after a scan term based on `responsePosition` and `maximumTerms`
+func scanWindow(responsePosition, maximumTerms int) (numBefore, numAfter int) {
+	numBefore = min(max(0, responsePosition-1), maximumTerms)
+	numAfter = maximumTerms - numBefore
+	return
+}
+
+// scanResources lists PIDs of the provided resources
+// (i.e. the ones a user is allowed to access)
+func (a *FCSSubHandlerV20) scanResources(
+	accessible corpus.SrchResources,
+	clause scanClause,
+	responsePosition, maximumTerms int,
+) []schema.XMLScanTerm {
+	resources := make(corpus.SrchResources, len(accessible))
+	copy(resources, accessible)
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].PID < resources[j].PID
+	})
+	var termIdx int
+	if clause.term != "" && clause.term != ScanTermRoot {
+		termIdx = sort.Search(len(resources), func(i int) bool {
+			return resources[i].PID >= clause.term
+		})
+	}
+	numBefore, numAfter := scanWindow(responsePosition, maximumTerms)
+	ans := make([]schema.XMLScanTerm, 0, maximumTerms)
+	for _, res := range resources[max(0, termIdx-numBefore):min(len(resources), termIdx+numAfter)] {
+		ans = append(ans, schema.XMLScanTerm{
+			Value:       res.PID,
+			DisplayTerm: res.FullName["en"],
+		})
+	}
+	return ans
+}
+
+// scanPosAttr lists values of a positional attribute found
+// in the provided resources (i.e. the ones a user is allowed to access)
+func (a *FCSSubHandlerV20) scanPosAttr(
+	ctx context.Context,
+	accessible corpus.SrchResources,
+	clause scanClause,
+	responsePosition, maximumTerms int,
+) ([]schema.XMLScanTerm, error) {
+	numBefore, numAfter := scanWindow(responsePosition, maximumTerms)
+	resources := accessible.GetResourcesWithPosAttr(clause.index)
+	if len(resources) == 0 {
+		return []schema.XMLScanTerm{}, nil
+	}
+	waits := make([]<-chan result.AttrValuesResult, len(resources))
+	for i, res := range resources {
+		wait, err := a.radapter.PublishAttrValuesQuery(ctx, rdb.Query{
+			Func: rdb.FuncAttrValues,
+			Args: rdb.AttrValuesQueryArgs{
+				CorpusPath: a.corporaConf.GetRegistryPath(res.ID),
+				Attr:       clause.index,
+				FromValue:  clause.term,
+				NumBefore:  numBefore,
+				NumAfter:   numAfter,
+			},
+		})
+		if err != nil {
+			return []schema.XMLScanTerm{}, err
+		}
+		waits[i] = wait
+	}
+	values := make([][]mango.GoAttrValue, len(waits))
+	for i, wait := range waits {
+		res := <-wait
+		if res.Error != nil {
+			return []schema.XMLScanTerm{}, res.Error
+		}
+		values[i] = res.Values
+	}
+	return collections.SliceMap(
+		result.MergeAttrValues(clause.term, numBefore, numAfter, values...),
+		func(v mango.GoAttrValue, i int) schema.XMLScanTerm {
+			return schema.XMLScanTerm{Value: v.Value, NumberOfRecords: v.Freq}
+		},
+	), nil
+}
+
 func (a *FCSSubHandlerV20) scan(ctx *gin.Context, _ *FCSRequest) (schema.XMLScanResponse, int) {
+	logArgs := make(map[string]interface{})
+	logging.AddLogEvent(ctx, "args", logArgs)
 	ans := schema.NewXMLScanResponse()
-	for key, _ := range ctx.Request.URL.Query() {
+	for key := range ctx.Request.URL.Query() {
 		if err := ScanArg(key).Validate(); err != nil {
 			ans.Diagnostics = schema.NewXMLDiagnostics()
 			ans.Diagnostics.AddDiagnostic(
@@ -37,34 +164,80 @@ func (a *FCSSubHandlerV20) scan(ctx *gin.Context, _ *FCSRequest) (schema.XMLScan
 		}
 	}
 
-	xMaxTerms := ctx.DefaultQuery(ScanArgMaximumTerms.String(), "1000")
-	_, err := strconv.Atoi(xMaxTerms)
-	if err != nil {
+	xMaxTerms := ctx.DefaultQuery(ScanArgMaximumTerms.String(), strconv.Itoa(dfltScanMaximumTerms))
+	maximumTerms, err := strconv.Atoi(xMaxTerms)
+	if err != nil || maximumTerms < 1 || maximumTerms > mango.MaxAttrValuesInternalLimit {
 		ans.Diagnostics = schema.NewXMLDiagnostics()
 		ans.Diagnostics.AddDfltMsgDiagnostic(
 			general.DCUnsupportedParameterValue, 0, ScanArgMaximumTerms.String())
 		return ans, general.ConformantUnprocessableEntity
 	}
+	logArgs[ScanArgMaximumTerms.String()] = maximumTerms
 
 	xResponsePos := ctx.DefaultQuery(ScanArgResponsePosition.String(), "1")
-	_, err = strconv.Atoi(xResponsePos)
-	if err != nil {
+	responsePosition, err := strconv.Atoi(xResponsePos)
+	if err != nil || responsePosition < 0 {
 		ans.Diagnostics = schema.NewXMLDiagnostics()
 		ans.Diagnostics.AddDfltMsgDiagnostic(
 			general.DCUnsupportedParameterValue, 0, ScanArgResponsePosition.String())
 		return ans, general.ConformantUnprocessableEntity
 	}
+	logArgs[ScanArgResponsePosition.String()] = responsePosition
 
-	scanClause := ctx.Query(ScanArgScanClause.String())
-	if scanClause == "" {
+	xScanClause := ctx.Query(ScanArgScanClause.String())
+	if xScanClause == "" {
 		ans.Diagnostics = schema.NewXMLDiagnostics()
 		ans.Diagnostics.AddDfltMsgDiagnostic(
 			general.DCMandatoryParameterNotSupplied, 0, ScanArgScanClause.String())
 		return ans, general.ConformantUnprocessableEntity
 	}
+	logArgs[ScanArgScanClause.String()] = xScanClause
+	ans.EchoedRequest = &schema.XMLScanEchoedRequest{
+		Version:          "2.0",
+		ScanClause:       xScanClause,
+		ResponsePosition: responsePosition,
+		MaximumTerms:     maximumTerms,
+	}
+	clause, err := parseScanClause(xScanClause)
+	if err != nil {
+		ans.Diagnostics = schema.NewXMLDiagnostics()
+		ans.Diagnostics.AddDiagnostic(
+			general.DCQuerySyntaxError, 0, ScanArgScanClause.String(), err.Error())
+		return ans, general.ConformantUnprocessableEntity
+	}
 
-	ans.Diagnostics = schema.NewXMLDiagnostics()
-	ans.Diagnostics.AddDfltMsgDiagnostic(
-		general.DCUnsupportedIndex, 0, ScanArgScanClause.String())
-	return ans, general.ConformantUnprocessableEntity
+	// omit resources the user is not allowed to access
+	identity, authErr := a.authenticate(ctx)
+	if authErr != nil {
+		ans.Diagnostics = schema.NewXMLDiagnostics()
+		ans.Diagnostics.AddDiagnostic(authErr.Code, authErr.Type, authErr.Ident, authErr.Message)
+	}
+	logArgs["authenticated"] = identity.IsAuthenticated()
+	accessible := a.corporaConf.Resources.FilterByAccess(
+		identity.IsAuthenticated(), identity.GetEntitlements())
+
+	var terms []schema.XMLScanTerm
+	if clause.index == ScanIndexFCSResource {
+		terms = a.scanResources(accessible, clause, responsePosition, maximumTerms)
+
+	} else if len(a.corporaConf.Resources.GetResourcesWithPosAttr(clause.index)) > 0 {
+		terms, err = a.scanPosAttr(
+			ctx.Request.Context(), accessible, clause, responsePosition, maximumTerms)
+		if err != nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics()
+			ans.Diagnostics.AddDfltMsgDiagnostic(
+				general.DCGeneralSystemError, 0, err.Error())
+			return ans, http.StatusInternalServerError
+		}
+
+	} else {
+		ans.Diagnostics = schema.NewXMLDiagnostics()
+		ans.Diagnostics.AddDfltMsgDiagnostic(
+			general.DCUnsupportedIndex, 0, clause.index)
+		return ans, general.ConformantUnprocessableEntity
+	}
+	if len(terms) > 0 {
+		ans.Terms = &terms
+	}
+	return ans, http.StatusOK
 }
@@ -0,0 +1,117 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package v20
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePublisher answers attribute values queries with fixed values,
+// concordance queries with empty results of the `concSize` size
+// and records all the published queries
+type fakePublisher struct {
+	published []rdb.Query
+	concSize  int
+}
+
+func (fp *fakePublisher) PublishQuery(ctx context.Context, query rdb.Query) (<-chan result.ConcResult, error) {
+	fp.published = append(fp.published, query)
+	ans := make(chan result.ConcResult, 1)
+	ans <- result.ConcResult{ConcSize: fp.concSize}
+	return ans, nil
+}
+
+func (fp *fakePublisher) PublishAttrValuesQuery(ctx context.Context, query rdb.Query) (<-chan result.AttrValuesResult, error) {
+	fp.published = append(fp.published, query)
+	ans := make(chan result.AttrValuesResult, 1)
+	ans <- result.AttrValuesResult{Values: []mango.GoAttrValue{{Value: "walk", Freq: 10}}}
+	return ans, nil
+}
+
+func newScanTestHandler(publisher rdb.QueryPublisher) *FCSSubHandlerV20 {
+	return NewFCSSubHandlerV20(
+		nil,
+		&corpus.CorporaSetup{
+			RegistryDir: "/tmp",
+			Resources: corpus.SrchResources{
+				{
+					ID:       "restricted",
+					PID:      "restricted-pid",
+					FullName: map[string]string{"en": "Restricted corpus"},
+					PosAttrs: []corpus.PosAttr{{ID: "a1", Name: "lemma", Layer: corpus.LayerTypeLemma}},
+					Access:   corpus.AccessPolicy{Type: corpus.AccessAuthenticated},
+				},
+			},
+		},
+		publisher,
+		nil,
+	)
+}
+
+func runScan(h *FCSSubHandlerV20, scanClause string) ([]string, int) {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(
+		http.MethodGet, "/?scanClause="+url.QueryEscape(scanClause), nil)
+	resp, code := h.scan(ctx, nil)
+	var ans []string
+	if resp.Terms != nil {
+		for _, t := range *resp.Terms {
+			ans = append(ans, t.Value)
+		}
+	}
+	return ans, code
+}
+
+func TestAnonymousScanOmitsRestrictedResources(t *testing.T) {
+	publisher := &fakePublisher{}
+	h := newScanTestHandler(publisher)
+
+	terms, code := runScan(h, "fcs.resource = root")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, terms)
+
+	terms, code = runScan(h, `lemma = "walk"`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, terms)
+	assert.Empty(t, publisher.published)
+}
+
+func TestScanPublicResource(t *testing.T) {
+	publisher := &fakePublisher{}
+	h := newScanTestHandler(publisher)
+	h.corporaConf.Resources[0].Access = corpus.AccessPolicy{Type: corpus.AccessPublic}
+
+	terms, _ := runScan(h, "fcs.resource = root")
+	assert.Equal(t, []string{"restricted-pid"}, terms)
+
+	terms, _ = runScan(h, `lemma = "walk"`)
+	assert.Equal(t, []string{"walk"}, terms)
+	assert.Len(t, publisher.published, 1)
+}
@@ -18,7 +18,11 @@
 
 package schema
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+
+	"github.com/czcorpus/mquery-sru/general"
+)
 
 type XMLExplainResponse struct {
 	XMLName          xml.Name `xml:"sruResponse:explainResponse"`
@@ -34,13 +38,14 @@ type XMLExplainResponse struct {
 // --------------------- Explain Record ---------------------
 
 type XMLExplainRecord struct {
-	Schema      string         `xml:"sruResponse:recordSchema"`
-	XMLEscaping string         `xml:"sruResponse:recordXMLEscaping"`
-	Data        XMLExplainData `xml:"sruResponse:recordData>zr:explain"`
+	Schema      string                                `xml:"sruResponse:recordSchema"`
+	XMLEscaping string                                `xml:"sruResponse:recordXMLEscaping"`
+	Data        general.XMLRecordData[XMLExplainData] `xml:"sruResponse:recordData"`
 }
 
 type XMLExplainData struct {
-	XMLNSZR string `xml:"xmlns:zr,attr"`
+	XMLName xml.Name `xml:"zr:explain"`
+	XMLNSZR string   `xml:"xmlns:zr,attr"`
 
 	ServerInfo   XMLExplainServerInfo   `xml:"zr:serverInfo"`
 	DatabaseInfo XMLExplainDatabaseInfo `xml:"zr:databaseInfo"`
@@ -66,8 +71,8 @@ type XMLExplainDatabaseInfo struct {
 }
 
 type XMLExplainIndexInfo struct {
-	Set   XMLExplainDefinition     `xml:"zr:set"`
-	Index XMLExplainIndexInfoIndex `xml:"zr:index"`
+	Set     XMLExplainDefinition       `xml:"zr:set"`
+	Indexes []XMLExplainIndexInfoIndex `xml:"zr:index"`
 }
 
 type XMLExplainDefinition struct {
@@ -92,7 +97,7 @@ type XMLExplainIndexInfoIndexMap struct {
 }
 
 type XMLExplainIndexInfoIndexMapName struct {
-	Set   string `xml:"set,attr"`
+	Set   string `xml:"set,attr,omitempty"`
 	Value string `xml:",chardata"`
 }
 
@@ -141,6 +146,7 @@ type XMLExplainEndpointDescription struct {
 	Capabilities       []string                      `xml:"ed:Capabilities>ed:Capability"`
 	SupportedDataViews []XMLExplainSupportedDataView `xml:"ed:SupportedDataViews>ed:SupportedDataView"`
 	SupportedLayers    []XMLExplainSupportedLayer    `xml:"ed:SupportedLayers>ed:SupportedLayer"`
+	SupportedLexFields []XMLExplainSupportedLexField `xml:"ed:SupportedLexFields>ed:SupportedLexField,omitempty"`
 	Resources          []XMLExplainResource          `xml:"ed:Resources>ed:Resource"`
 }
 
@@ -157,6 +163,11 @@ type XMLExplainSupportedLayer struct {
 	Value     string `xml:",chardata"`
 }
 
+type XMLExplainSupportedLexField struct {
+	ID    string `xml:"id,attr"`
+	Value string `xml:",chardata"`
+}
+
 type XMLExplainResource struct {
 	PID                string                    `xml:"pid,attr"`
 	Titles             []XMLMultilingual2        `xml:"ed:Title"`
@@ -165,6 +176,18 @@ type XMLExplainResource struct {
 	Languages          []string                  `xml:"ed:Languages>ed:Language"`
 	AvailableDataViews XMLExplainAvailableValues `xml:"ed:AvailableDataViews"`
 	AvailableLayers    XMLExplainAvailableValues `xml:"ed:AvailableLayers"`
+
+	// AvailableLexFields and AvailableCapabilities are defined
+	// only for lexical resources (LexFCS)
+	AvailableLexFields    *XMLExplainAvailableValues `xml:"ed:AvailableLexFields,omitempty"`
+	AvailableCapabilities *XMLExplainAvailableValues `xml:"ed:AvailableCapabilities,omitempty"`
+
+	// AvailabilityRestriction signals that the resource can be
+	// searched only by authenticated users (`authOnly`)
+	AvailabilityRestriction string `xml:"ed:AvailabilityRestriction,omitempty"`
+
+	// SubResources are nested resources (e.g. parts of a corpus)
+	SubResources []XMLExplainResource `xml:"ed:Resources>ed:Resource,omitempty"`
 }
 
 type XMLExplainAvailableValues struct {
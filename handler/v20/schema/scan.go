@@ -21,10 +21,16 @@ package schema
 import "encoding/xml"
 
 type XMLScanResponse struct {
-	XMLName           xml.Name        `xml:"scan:scanResponse"`
-	XMLNSScanResponse string          `xml:"xmlns:scan,attr"`
-	Version           string          `xml:"scan:version"`
-	Diagnostics       *XMLDiagnostics `xml:"scan:diagnostics,omitempty"`
+	XMLName           xml.Name `xml:"scan:scanResponse"`
+	XMLNSScanResponse string   `xml:"xmlns:scan,attr"`
+	Version           string   `xml:"scan:version"`
+
+	// Terms
+	// note: we need a pointer here to allow the marshaler skip the 'terms' parent
+	// in case there are no 'term' children
+	Terms         *[]XMLScanTerm        `xml:"scan:terms>scan:term,omitempty"`
+	EchoedRequest *XMLScanEchoedRequest `xml:"scan:echoedScanRequest,omitempty"`
+	Diagnostics   *XMLDiagnostics       `xml:"scan:diagnostics,omitempty"`
 }
 
 func NewXMLScanResponse() XMLScanResponse {
@@ -33,3 +39,20 @@ func NewXMLScanResponse() XMLScanResponse {
 		Version:           "2.0",
 	}
 }
+
+// --------------------- Scan Term ---------------------
+
+type XMLScanTerm struct {
+	Value           string `xml:"scan:value"`
+	NumberOfRecords int64  `xml:"scan:numberOfRecords,omitempty"`
+	DisplayTerm     string `xml:"scan:displayTerm,omitempty"`
+}
+
+// --------------------- Echoed Scan Request ---------------------
+
+type XMLScanEchoedRequest struct {
+	Version          string `xml:"scan:version"`
+	ScanClause       string `xml:"scan:scanClause"`
+	ResponsePosition int    `xml:"scan:responsePosition"`
+	MaximumTerms     int    `xml:"scan:maximumTerms"`
+}
@@ -18,7 +18,11 @@
 
 package schema
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+
+	"github.com/czcorpus/mquery-sru/general"
+)
 
 type XMLSRResponse struct {
 	XMLName          xml.Name `xml:"sruResponse:searchRetrieveResponse"`
@@ -30,11 +34,12 @@ type XMLSRResponse struct {
 	// Records
 	// note: we need a pointer here to allow the marshaler skip the 'records' parent
 	// in case there are no 'record' children
-	Records              *[]XMLSRRecord      `xml:"sruResponse:records>sruResponse:record,omitempty"`
-	NextRecordPosition   int                 `xml:"sruResponse:nextRecordPosition,omitempty"`
-	EchoedRequest        *XMLSREchoedRequest `xml:"sruResponse:echoedSearchRetrieveRequest,omitempty"`
-	Diagnostics          *XMLDiagnostics     `xml:"sruResponse:diagnostics,omitempty"`
-	ResultCountPrecision string              `xml:"sruResponse:resultCountPrecision"`
+	Records              *[]XMLSRRecord          `xml:"sruResponse:records>sruResponse:record,omitempty"`
+	NextRecordPosition   int                     `xml:"sruResponse:nextRecordPosition,omitempty"`
+	EchoedRequest        *XMLSREchoedRequest     `xml:"sruResponse:echoedSearchRetrieveRequest,omitempty"`
+	Diagnostics          *XMLDiagnostics         `xml:"sruResponse:diagnostics,omitempty"`
+	ExtraResponseData    *XMLSRExtraResponseData `xml:"sruResponse:extraResponseData,omitempty"`
+	ResultCountPrecision string                  `xml:"sruResponse:resultCountPrecision"`
 }
 
 func NewXMLSRResponse() XMLSRResponse {
@@ -57,13 +62,14 @@ func NewMinimalXMLSRResponse() XMLSRResponse {
 // --------------------- Search Retrieve Record ---------------------
 
 type XMLSRRecord struct {
-	Schema         string        `xml:"sruResponse:recordSchema"`
-	XMLEscaping    string        `xml:"sruResponse:recordXMLEscaping"`
-	Data           XMLSRResource `xml:"sruResponse:recordData>fcs:Resource"`
-	RecordPosition int           `xml:"sruResponse:recordPosition"`
+	Schema         string                               `xml:"sruResponse:recordSchema"`
+	XMLEscaping    string                               `xml:"sruResponse:recordXMLEscaping"`
+	Data           general.XMLRecordData[XMLSRResource] `xml:"sruResponse:recordData"`
+	RecordPosition int                                  `xml:"sruResponse:recordPosition"`
 }
 
 type XMLSRResource struct {
+	XMLName          xml.Name              `xml:"fcs:Resource"`
 	XMLNSFCS         string                `xml:"xmlns:fcs,attr"`
 	PID              string                `xml:"pid,attr"`
 	ResourceFragment XMLSRResourceFragment `xml:"fcs:ResourceFragment"`
@@ -75,7 +81,11 @@ type XMLSRResourceFragment struct {
 }
 
 type XMLSRDataView struct {
-	Type   string `xml:"type,attr"`
+	Type string `xml:"type,attr"`
+
+	// Ref is used by data views referring to an external
+	// content (e.g. a CMDI record) instead of embedding it
+	Ref    string `xml:"ref,attr,omitempty"`
 	Result any
 }
 
@@ -93,6 +103,34 @@ type XMLSRAdvancedDataViewResult struct {
 	Layers   []XMLSRAdvLayer   `xml:"adv:Layers>adv:Layer"`
 }
 
+type XMLSRKWICDataViewResult struct {
+	XMLName   xml.Name `xml:"kwic:kwic"`
+	XMLNSKWIC string   `xml:"xmlns:kwic,attr"`
+	Parts     []XMLSRKWICPart
+}
+
+// XMLSRKWICPart is either a context (`kwic:c`) or
+// a keyword (`kwic:kw`) - the element name must be
+// specified via XMLName
+type XMLSRKWICPart struct {
+	XMLName xml.Name
+	Type    string `xml:"type,attr,omitempty"`
+	Value   string `xml:",chardata"`
+}
+
+// XMLSRLexDataViewResult is a LexFCS view representing
+// a single lexical entry
+type XMLSRLexDataViewResult struct {
+	XMLName  xml.Name        `xml:"lex:Entry"`
+	XMLNSLex string          `xml:"xmlns:lex,attr"`
+	Fields   []XMLSRLexField `xml:"lex:Field"`
+}
+
+type XMLSRLexField struct {
+	Type   string   `xml:"type,attr"`
+	Values []string `xml:"lex:Value"`
+}
+
 type XMLSRAdvSegment struct {
 	ID    string `xml:"id,attr"`
 	Start int    `xml:"start,attr"`
@@ -110,6 +148,35 @@ type XMLSRAdvValue struct {
 	Value     string `xml:",chardata"`
 }
 
+// --------------------- Extra Response Data ---------------------
+
+type XMLSRExtraResponseData struct {
+	ResourceHits *XMLSRResourceHits `xml:"x-mqsru:ResourceHits,omitempty"`
+}
+
+// XMLSRResourceHits is an MQuery-SRU specific extension providing
+// numbers of hits for individual searched resources
+type XMLSRResourceHits struct {
+	XMLNSMQSRU string                  `xml:"xmlns:x-mqsru,attr"`
+	Resources  []XMLSRResourceHitsItem `xml:"x-mqsru:Resource"`
+}
+
+type XMLSRResourceHitsItem struct {
+	PID             string `xml:"pid,attr"`
+	NumberOfRecords int    `xml:"numberOfRecords,attr"`
+
+	// Failed is true in case the resource could not be searched
+	// (in such case, a diagnostic is also attached to the response)
+	Failed bool `xml:"failed,attr,omitempty"`
+}
+
+func NewXMLSRResourceHits() *XMLSRResourceHits {
+	return &XMLSRResourceHits{
+		XMLNSMQSRU: "http://github.com/czcorpus/mquery-sru/ns/resource-hits",
+		Resources:  make([]XMLSRResourceHitsItem, 0, 10),
+	}
+}
+
 // --------------------- Echoed Search Retrieve Request ---------------------
 
 type XMLSREchoedRequest struct {
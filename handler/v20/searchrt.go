@@ -25,7 +25,6 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/czcorpus/cnc-gokit/collections"
 	"github.com/czcorpus/cnc-gokit/logging"
 	"github.com/czcorpus/mquery-common/concordance"
 	"github.com/czcorpus/mquery-sru/backlink"
@@ -33,10 +32,11 @@ import (
 	"github.com/czcorpus/mquery-sru/general"
 	"github.com/czcorpus/mquery-sru/handler/v20/schema"
 	"github.com/czcorpus/mquery-sru/mango"
-	"github.com/czcorpus/mquery-sru/query"
+	"github.com/czcorpus/mquery-sru/metrics"
 	"github.com/czcorpus/mquery-sru/query/compiler"
 	"github.com/czcorpus/mquery-sru/query/parser/basic"
 	"github.com/czcorpus/mquery-sru/query/parser/fcsql"
+	"github.com/czcorpus/mquery-sru/query/parser/lexcql"
 	"github.com/czcorpus/mquery-sru/rdb"
 	"github.com/czcorpus/mquery-sru/result"
 	"github.com/rs/zerolog/log"
@@ -47,6 +47,7 @@ import (
 func (a *FCSSubHandlerV20) translateQuery(
 	corpusName, query string,
 	queryType QueryType,
+	rewritesAllowed bool,
 ) (compiler.AST, *general.FCSError) {
 	var ast compiler.AST
 	var fcsErr *general.FCSError
@@ -75,12 +76,25 @@ func (a *FCSSubHandlerV20) translateQuery(
 			}
 		}
 	case QueryTypeFCS:
-		var err error
-		ast, err = fcsql.ParseQuery(
+		fcsAST, err := fcsql.ParseQuery(
 			query,
 			res.PosAttrs,
 			res.StructureMapping,
 		)
+		if err == nil {
+			fcsAST.SetRewritesAllowed(rewritesAllowed)
+			ast = fcsAST
+		}
+		if err != nil {
+			fcsErr = &general.FCSError{
+				Code:    general.DCQuerySyntaxError,
+				Ident:   query,
+				Message: fmt.Sprintf("Invalid query syntax: %s", err),
+			}
+		}
+	case QueryTypeLex:
+		var err error
+		ast, err = lexcql.ParseQuery(query, res.LexFields)
 		if err != nil {
 			fcsErr = &general.FCSError{
 				Code:    general.DCQuerySyntaxError,
@@ -193,22 +207,81 @@ func (a *FCSSubHandlerV20) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequ
 	}
 	logArgs[SearchMaximumRecords.String()] = maximumRecords
 
+	// handle random sample parameter
+	sample, err := a.corporaConf.SampleArgs(ctx.Query(SearchRetrArgRandomSample.String()))
+	if err != nil {
+		ans.Diagnostics = schema.NewXMLDiagnostics()
+		ans.Diagnostics.AddDfltMsgDiagnostic(
+			general.DCUnsupportedParameterValue, 0, SearchRetrArgRandomSample.String())
+		return ans, general.ConformantUnprocessableEntity
+	}
+	logArgs[SearchRetrArgRandomSample.String()] = sample.Size
+
+	queryType := getTypedArg[QueryType](ctx, SearchRetrArgQueryType.String(), DefaultQueryType)
+	logArgs[SearchRetrArgQueryType.String()] = queryType
+	if queryType.Validate() == nil {
+		metrics.SetRequestLabel(ctx, metrics.LabelQueryType, queryType.String())
+	}
+
 	// handle requested sources
+	// (a resource can be either a corpus or its sub-resource)
 	corporaPids := fetchContext(ctx)
-	corpora := make([]string, 0, len(corporaPids))
+	selections := make(corpus.ResourceSelections, 0, len(corporaPids))
 	if len(corporaPids) > 0 {
 		for _, pid := range corporaPids {
-			res, err := a.corporaConf.Resources.GetResourceByPID(pid)
+			sel, err := a.corporaConf.Resources.SelectByPID(pid)
 			if err == corpus.ErrResourceNotFound {
 				ans.Records = nil
 				return ans, http.StatusOK
 			}
-			corpora = append(corpora, res.ID)
+			selections = append(selections, sel)
 		}
 
 	} else {
-		corpora = a.corporaConf.Resources.GetCorpora()
+		selections = a.corporaConf.Resources.SelectAll()
+	}
+	// lexical search is possible only within lexical resources
+	if queryType == QueryTypeLex {
+		lexSelections := make(corpus.ResourceSelections, 0, len(selections))
+		for _, sel := range selections {
+			if sel.Corpus.IsLexical() {
+				lexSelections = append(lexSelections, sel)
+
+			} else if len(corporaPids) > 0 {
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+				ans.Diagnostics.AddDiagnostic(
+					general.DCUnsupportedContextSet, 0, sel.PID(),
+					fmt.Sprintf("Resource %s does not support lexical search", sel.PID()),
+				)
+				return ans, general.ConformantStatusBadRequest
+			}
+		}
+		selections = lexSelections
+	}
+	// omit resources the user is not allowed to search
+	identity, authErr := a.authenticate(ctx)
+	if authErr != nil {
+		if ans.Diagnostics == nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics()
+		}
+		ans.Diagnostics.AddDiagnostic(authErr.Code, authErr.Type, authErr.Ident, authErr.Message)
+	}
+	logArgs["authenticated"] = identity.IsAuthenticated()
+	selections, deniedSelections := selections.SplitByAccess(
+		identity.IsAuthenticated(), identity.GetEntitlements())
+	for _, sel := range deniedSelections {
+		if ans.Diagnostics == nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics()
+		}
+		ans.Diagnostics.AddDiagnostic(
+			general.DCAuthenticationError, 0, sel.PID(),
+			fmt.Sprintf("Access to resource %s denied, the resource is omitted", sel.PID()),
+		)
+	}
+	if len(selections) == 0 && len(deniedSelections) > 0 {
+		return ans, http.StatusOK
 	}
+	corpora := selections.CorpusIDs()
 
 	// get searchable corpora and attrs
 	if len(corpora) == 0 {
@@ -228,94 +301,188 @@ func (a *FCSSubHandlerV20) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequ
 	retrieveAttrs = append(retrieveAttrs, retrieveAttrs[0])
 
 	logArgs["corpus"] = a.serverInfo.Database
-	logArgs["sources"] = corpora
+	logArgs["sources"] = selections.Keys()
 	logArgs[SearchRetrArgFCSContext.String()] = ctx.Query(SearchRetrArgFCSContext.String())
-	log.Warn().Msg("Data views are not implemented yet!")
 	logArgs[SearchRetrArgFCSDataViews.String()] = ctx.Query(SearchRetrArgFCSDataViews.String())
 
-	queryType := getTypedArg[QueryType](ctx, SearchRetrArgQueryType.String(), DefaultQueryType)
-	logArgs[SearchRetrArgQueryType.String()] = queryType
+	rewritesAllowed := ctx.Query(SearchRetrArgFCSRewritesAllowed.String()) == "true"
+	logArgs[SearchRetrArgFCSRewritesAllowed.String()] = rewritesAllowed
+
+	requestedViews, viewErrs := a.validateRequestedDataViews(fetchDataViews(ctx), corpora)
+	for _, viewErr := range viewErrs {
+		if ans.Diagnostics == nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics()
+		}
+		ans.Diagnostics.AddDiagnostic(viewErr.Code, viewErr.Type, viewErr.Ident, viewErr.Message)
+	}
 
-	ranges := query.CalculatePartialRanges(corpora, startRecord-1, maximumRecords)
+	mergeStrategy := getTypedArg(
+		ctx, SearchRetrArgMergeStrategy.String(), a.corporaConf.MergeStrategy)
+	if err := mergeStrategy.Validate(); err != nil {
+		ans.Diagnostics = schema.NewXMLDiagnostics()
+		ans.Diagnostics.AddDiagnostic(
+			general.DCUnsupportedParameterValue, 0, SearchRetrArgMergeStrategy.String(), err.Error())
+		return ans, general.ConformantUnprocessableEntity
+	}
+	logArgs[SearchRetrArgMergeStrategy.String()] = mergeStrategy
 
-	// make searches
-	waits := make([]<-chan result.ConcResult, len(ranges))
-	for i, rng := range ranges {
+	// prepare searches
+	concArgs := make(map[string]rdb.ConcQueryArgs) // maps resource selection key to search args
+	for _, sel := range selections {
+		rscConf := sel.Corpus
 
-		ast, fcsErr := a.translateQuery(rng.Rsc, fcsQuery, queryType)
+		ast, fcsErr := a.translateQuery(rscConf.ID, fcsQuery, queryType, rewritesAllowed)
 		if fcsErr != nil {
 			ans.Diagnostics = schema.NewXMLDiagnostics()
 			ans.Diagnostics.AddDiagnostic(fcsErr.Code, fcsErr.Type, fcsErr.Ident, fcsErr.Message)
 			return ans, general.ConformantUnprocessableEntity
 		}
+		// the canonical form does not depend on a resource so it
+		// is the same for all the selections
+		canonicalQuery := compiler.CanonicalQuery(ast, fcsQuery)
+		ans.EchoedRequest.Query = canonicalQuery
+		logArgs["canonicalQuery"] = canonicalQuery
 
-		query := ast.Generate()
-		if len(ast.Errors()) > 0 {
+		// semantic errors are reported before the query is generated
+		// (and published) so the generated CQL is always valid
+		var query string
+		queryErrs := compiler.ValidateAST(ast)
+		if len(queryErrs) == 0 {
+			if err := compiler.CheckComplexity(ast, a.corporaConf.QueryLimits); err != nil {
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+				ans.Diagnostics.AddDiagnostic(
+					0, general.DTQueryTooComplex, SearchRetrArgQuery.String(), err.Error())
+				return ans, general.ConformantUnprocessableEntity
+			}
+			query = sel.ApplyRestriction(ast.Generate())
+			queryErrs = ast.Errors()
+		}
+		if len(queryErrs) > 0 {
 			ans.Diagnostics = schema.NewXMLDiagnostics()
-			ans.Diagnostics.AddDiagnostic(
-				general.DCQueryCannotProcess, 0, SearchRetrArgQuery.String(), ast.Errors()[0].Error())
+			if featErr, ok := compiler.AsUnsupportedFeature(queryErrs[0]); ok {
+				ans.Diagnostics.AddDiagnostic(
+					general.DCQueryFeatureUnsupported, 0, featErr.Feature, queryErrs[0].Error())
+
+			} else {
+				ans.Diagnostics.AddDiagnostic(
+					general.DCQueryCannotProcess, 0, SearchRetrArgQuery.String(), queryErrs[0].Error())
+			}
 			return ans, general.ConformantUnprocessableEntity
 		}
-		rscConf, err := a.corporaConf.Resources.GetResource(rng.Rsc)
+		if rwAST, ok := ast.(compiler.RewritableAST); ok && len(rwAST.Rewrites()) > 0 {
+			if ans.Diagnostics == nil {
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+			}
+			ans.Diagnostics.AddDiagnostic(
+				0,
+				general.DTQueryWasRewritten,
+				sel.PID(),
+				fmt.Sprintf(
+					"Query was rewritten for resource %s: %s",
+					sel.PID(), strings.Join(rwAST.Rewrites(), "; "),
+				),
+			)
+		}
+		args := rdb.ConcQueryArgs{
+			CorpusPath:        a.corporaConf.GetRegistryPath(rscConf.ID),
+			Query:             query,
+			Attrs:             retrieveAttrs,
+			MaxContext:        a.corporaConf.MaximumContext,
+			ViewContextStruct: rscConf.ViewContextStruct,
+			SampleSize:        sample.Size,
+			SampleSeed:        sample.Seed,
+		}
+		if queryType == QueryTypeLex {
+			// a lexical entry is a single token without any context
+			// and its fields are in resource-specific attributes
+			args.Attrs = rscConf.GetLexAttrs()
+			args.Attrs = append(args.Attrs, args.Attrs[0])
+			args.MaxContext = 0
+			args.ViewContextStruct = ""
+		}
+		concArgs[sel.Key()] = args
+	}
+
+	// make searches
+	merged, err := result.FetchMergedConc(
+		mergeStrategy,
+		selections.Keys(),
+		startRecord-1,
+		maximumRecords,
+		func(rsc string, fromLine, maxItems int) (<-chan result.ConcResult, error) {
+			args := concArgs[rsc]
+			args.StartLine = fromLine
+			args.MaxItems = maxItems
+			return a.radapter.PublishQuery(ctx.Request.Context(), rdb.Query{
+				Func: rdb.FuncConcExample,
+				Args: args,
+			})
+		},
+	)
+	if err != nil {
+		ans.Diagnostics = schema.NewXMLDiagnostics()
+		ans.Diagnostics.AddDfltMsgDiagnostic(
+			general.DCGeneralSystemError, 0, err.Error())
+		return ans, http.StatusInternalServerError
+	}
+	usedQueries := make(map[string]string) // maps resource selection key to Manatee CQL query
+	// a failing resource does not stop the whole search - it is just
+	// reported via a non-fatal diagnostic
+	rscErrors := make([]general.FCSError, 0, len(merged.Resources))
+	resourceHits := schema.NewXMLSRResourceHits()
+	for _, rscInfo := range merged.Resources {
+		sel, err := selections.Get(rscInfo.Rsc)
 		if err != nil {
 			ans.Diagnostics = schema.NewXMLDiagnostics()
 			ans.Diagnostics.AddDfltMsgDiagnostic(
 				general.DCGeneralSystemError, 0, err.Error())
 			return ans, general.ConformandGeneralServerError
 		}
-		wait, err := a.radapter.PublishQuery(rdb.Query{
-			Func: "concExample",
-			Args: rdb.ConcQueryArgs{
-				CorpusPath:        a.corporaConf.GetRegistryPath(rng.Rsc),
-				Query:             query,
-				Attrs:             retrieveAttrs,
-				StartLine:         rng.From,
-				MaxItems:          maximumRecords,
-				MaxContext:        a.corporaConf.MaximumContext,
-				ViewContextStruct: rscConf.ViewContextStruct,
-			},
-		})
-		if err != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
-			ans.Diagnostics.AddDfltMsgDiagnostic(
-				general.DCGeneralSystemError, 0, err.Error())
-			return ans, http.StatusInternalServerError
+		if rscInfo.Err != nil {
+			log.Error().
+				Err(rscInfo.Err).
+				Str("resource", rscInfo.Rsc).
+				Msg("failed to search resource")
+			rscErrors = append(rscErrors, general.FCSError{
+				Code:    general.DCQueryCannotProcess,
+				Ident:   sel.PID(),
+				Message: fmt.Sprintf("Failed to search resource %s: %s", sel.PID(), rscInfo.Err),
+			})
+			resourceHits.Resources = append(
+				resourceHits.Resources,
+				schema.XMLSRResourceHitsItem{PID: sel.PID(), Failed: true},
+			)
+			continue
 		}
-		waits[i] = wait
+		usedQueries[rscInfo.Rsc] = rscInfo.Query
+		metrics.ObserveConcSize(sel.Corpus.ID, rscInfo.ConcSize)
+		resourceHits.Resources = append(
+			resourceHits.Resources,
+			schema.XMLSRResourceHitsItem{PID: sel.PID(), NumberOfRecords: rscInfo.ConcSize},
+		)
 	}
-	// using fromResource, we will cycle through available resources' results and their lines
-	fromResource := result.NewRoundRobinLineSel(maximumRecords, ranges.PIDList()...)
-	usedQueries := make(map[string]string) // maps resource ID to Manatee CQL query
-	var totalConcSize int
-	for i, wait := range waits {
-		result := <-wait
-		if result.Error == mango.ErrRowsRangeOutOfConc {
-			fromResource.RscSetErrorAt(i, err)
 
-		} else if result.Error != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
-			ans.Diagnostics.AddDfltMsgDiagnostic(
-				general.DCQueryCannotProcess, 0, result.Error.Error())
-			return ans, http.StatusInternalServerError
+	ans.NumberOfRecords = merged.TotalSize
+	if merged.HasFatalError() {
+		ans.Diagnostics = schema.NewXMLDiagnostics()
+		for _, rscErr := range rscErrors {
+			ans.Diagnostics.AddDiagnostic(rscErr.Code, rscErr.Type, rscErr.Ident, rscErr.Message)
 		}
-		fromResource.SetRscLines(ranges[i].Rsc, result)
-		usedQueries[ranges[i].Rsc] = result.Query
-		totalConcSize += result.ConcSize
-	}
+		return ans, general.ConformandGeneralServerError
 
-	ans.NumberOfRecords = totalConcSize
-	if fromResource.AllHasOutOfRangeError() {
+	} else if startRecord > 1 && startRecord > merged.TotalSize {
 		ans.Diagnostics = schema.NewXMLDiagnostics()
 		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCFirstRecordPosOutOfRange, 0, fromResource.GetFirstError().Error())
+			general.DCFirstRecordPosOutOfRange, 0, SearchRetrStartRecord.String())
 		return ans, general.ConformantUnprocessableEntity
-
-	} else if fromResource.HasFatalError() {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCQueryCannotProcess, 0, fromResource.GetFirstError().Error())
-		return ans, general.ConformandGeneralServerError
 	}
+	for _, rscErr := range rscErrors {
+		if ans.Diagnostics == nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics()
+		}
+		ans.Diagnostics.AddDiagnostic(rscErr.Code, rscErr.Type, rscErr.Ident, rscErr.Message)
+	}
+	ans.ExtraResponseData = &schema.XMLSRExtraResponseData{ResourceHits: resourceHits}
 
 	// transform results
 	commonLayers := a.corporaConf.Resources.GetCommonLayers()
@@ -328,98 +495,57 @@ func (a *FCSSubHandlerV20) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequ
 	}
 
 	records := make([]schema.XMLSRRecord, 0, maximumRecords)
-	for len(records) < maximumRecords && fromResource.Next() {
-		res, err := a.corporaConf.Resources.GetResource(fromResource.CurrRscName())
+	for _, mergedLine := range merged.Lines {
+		sel, err := selections.Get(mergedLine.Rsc)
 		if err != nil {
 			ans.Diagnostics = schema.NewXMLDiagnostics()
 			ans.Diagnostics.AddDfltMsgDiagnostic(
 				general.DCGeneralSystemError, 0, err.Error())
 			return ans, http.StatusInternalServerError
 		}
-		item := fromResource.CurrLine()
+		res := sel.Corpus
+		item := mergedLine.Line
 		var refURL string
 		if res.KontextBacklinkRootURL != "" {
 			var err error
 			refURL, err = backlink.GenerateForKonText(
-				res.KontextBacklinkRootURL, res.ID, usedQueries[res.ID], item.Ref)
+				res.KontextBacklinkRootURL, res.ID, usedQueries[sel.Key()], item.Ref)
 			if err != nil {
 				log.Error().Err(err).Msg("failed to generate ResourceFragment URL")
 			}
 		}
-		segmentPos := 1
+		dataViews := make([]*schema.XMLSRDataView, 0, len(res.DataViews))
+		for _, dv := range res.DataViews {
+			if !shouldSendDataView(dv, requestedViews, queryType) {
+				continue
+			}
+			switch dv.Type {
+			case corpus.DataViewTypeHits:
+				dataViews = append(dataViews, mkHitsDataView(item))
+			case corpus.DataViewTypeAdvanced:
+				dataViews = append(dataViews, a.mkAdvDataView(item, commonLayers, commonPosAttrs))
+			case corpus.DataViewTypeKWIC:
+				dataViews = append(dataViews, mkKWICDataView(item))
+			case corpus.DataViewTypeCMDI:
+				dataViews = append(dataViews, mkCMDIDataView(res))
+			case corpus.DataViewTypeLex:
+				dataViews = append(dataViews, mkLexDataView(item, res))
+			}
+		}
 		records = append(records, schema.XMLSRRecord{
 			Schema:      "http://clarin.eu/fcs/resource",
 			XMLEscaping: string(fcsResponse.RecordXMLEscaping),
-			Data: schema.XMLSRResource{
-				XMLNSFCS: "http://clarin.eu/fcs/resource",
-				PID:      res.PID,
-				ResourceFragment: schema.XMLSRResourceFragment{
-					Ref: refURL,
-					DataViews: []*schema.XMLSRDataView{
-						// basic data view
-						{
-							Type: "application/x-clarin-fcs-hits+xml",
-							Result: schema.XMLSRBasicDataViewResult{
-								XMLNSHits: "http://clarin.eu/fcs/dataview/hits",
-								Data: strings.Join(
-									collections.SliceMap(
-										item.Text.Tokens(),
-										func(token *concordance.Token, i int) string {
-											if token.Strong {
-												return "<hits:Hit>" + token.Word + "</hits:Hit>"
-											}
-											return token.Word
-										},
-									),
-									" ",
-								),
-							},
-						},
-						// advanced data view if requested
-						general.ReturnIf(
-							queryType == QueryTypeFCS,
-							&schema.XMLSRDataView{
-								Type: "application/x-clarin-fcs-adv+xml",
-								Result: schema.XMLSRAdvancedDataViewResult{
-									Unit:     "item",
-									XMLNSAdv: "http://clarin.eu/fcs/dataview/advanced",
-									Segments: collections.SliceMap(
-										item.Text.Tokens(),
-										func(token *concordance.Token, i int) schema.XMLSRAdvSegment {
-											segment := schema.XMLSRAdvSegment{
-												ID:    fmt.Sprintf("s%d", i),
-												Start: segmentPos,
-												End:   segmentPos + len(token.Word) - 1,
-											}
-											segmentPos += len(token.Word) + 1 // with space between words
-											return segment
-										},
-									),
-									Layers: collections.SliceMap(
-										commonLayers,
-										func(layer corpus.LayerType, j int) schema.XMLSRAdvLayer {
-											return schema.XMLSRAdvLayer{
-												ID: layer.GetResultID(),
-												Values: collections.SliceMap(
-													item.Text.Tokens(),
-													func(token *concordance.Token, i int) schema.XMLSRAdvValue {
-														return schema.XMLSRAdvValue{
-															Ref:       fmt.Sprintf("s%d", i),
-															Highlight: general.ReturnIf(token.Strong, fmt.Sprintf("s%d", i), ""),
-															Value:     a.getAttrByLayers(commonPosAttrs, layer, *token),
-														}
-													},
-												),
-											}
-										},
-									),
-								},
-							},
-							nil,
-						),
+			Data: general.NewXMLRecordData(
+				schema.XMLSRResource{
+					XMLNSFCS: "http://clarin.eu/fcs/resource",
+					PID:      sel.PID(),
+					ResourceFragment: schema.XMLSRResourceFragment{
+						Ref:       refURL,
+						DataViews: dataViews,
 					},
 				},
-			},
+				fcsResponse.RecordXMLEscaping == RecordXMLEscapingString,
+			),
 			RecordPosition: len(records) + startRecord,
 		})
 	}
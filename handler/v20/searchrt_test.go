@@ -0,0 +1,155 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package v20
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/query"
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSearchTestHandler(publisher rdb.QueryPublisher) *FCSSubHandlerV20 {
+	corporaConf := &corpus.CorporaSetup{
+		RegistryDir:      "/tmp",
+		MaximumRecords:   10,
+		RandomSampleSize: 100,
+		RandomSampleSeed: 42,
+		MergeStrategy:    query.MergeRoundRobin,
+		QueryLimits:      &corpus.QueryLimits{},
+		Resources: corpus.SrchResources{
+			{
+				ID:       "corp1",
+				PID:      "corp1-pid",
+				FullName: map[string]string{"en": "Corpus"},
+				PosAttrs: []corpus.PosAttr{
+					{
+						Name:              "word",
+						Layer:             corpus.LayerTypeText,
+						IsBasicSearchAttr: true,
+						IsLayerDefault:    true,
+					},
+				},
+				ViewContextStruct: "s",
+			},
+		},
+	}
+	if err := corporaConf.QueryLimits.ValidateAndDefaults("queryLimits"); err != nil {
+		panic(err)
+	}
+	return NewFCSSubHandlerV20(&cnf.ServerInfo{}, corporaConf, publisher, nil)
+}
+
+// runSearch performs a search and returns details of all the diagnostics
+func runSearch(h *FCSSubHandlerV20, args url.Values) []string {
+	args.Set(SearchRetrArgQuery.String(), "walk")
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/?"+args.Encode(), nil)
+	resp, _ := h.searchRetrieve(ctx, &FCSRequest{})
+	ans := []string{}
+	if resp.Diagnostics != nil {
+		for _, d := range resp.Diagnostics.Diagnostics {
+			ans = append(ans, d.Details)
+		}
+	}
+	return ans
+}
+
+func publishedConcArgs(t *testing.T, publisher *fakePublisher) []rdb.ConcQueryArgs {
+	ans := make([]rdb.ConcQueryArgs, 0, len(publisher.published))
+	for _, q := range publisher.published {
+		args, ok := q.Args.(rdb.ConcQueryArgs)
+		if !assert.True(t, ok, "unexpected query args %T", q.Args) {
+			continue
+		}
+		ans = append(ans, args)
+	}
+	return ans
+}
+
+func TestSearchRandomSampleArg(t *testing.T) {
+	for _, tc := range []struct {
+		value        string
+		invalid      bool
+		expectedSize int
+	}{
+		{value: "", expectedSize: 100},
+		{value: "0", expectedSize: 0},
+		{value: "500", expectedSize: 500},
+		{
+			value:        strconv.Itoa(mango.MaxSampleSizeInternalLimit),
+			expectedSize: mango.MaxSampleSizeInternalLimit,
+		},
+		{value: strconv.Itoa(mango.MaxSampleSizeInternalLimit + 1), invalid: true},
+		{value: "-1", invalid: true},
+		{value: "foo", invalid: true},
+	} {
+		publisher := &fakePublisher{}
+		h := newSearchTestHandler(publisher)
+		args := url.Values{}
+		if tc.value != "" {
+			args.Set(SearchRetrArgRandomSample.String(), tc.value)
+		}
+		diagnostics := runSearch(h, args)
+		concArgs := publishedConcArgs(t, publisher)
+		if tc.invalid {
+			assert.Equal(t, []string{SearchRetrArgRandomSample.String()}, diagnostics, tc.value)
+			assert.Empty(t, concArgs, tc.value)
+			continue
+		}
+		assert.Empty(t, diagnostics, tc.value)
+		if assert.NotEmpty(t, concArgs, tc.value) {
+			assert.Equal(t, tc.expectedSize, concArgs[0].SampleSize, tc.value)
+			assert.Equal(t, int64(42), concArgs[0].SampleSeed, tc.value)
+		}
+	}
+}
+
+func TestSearchRandomSampleStableAcrossPages(t *testing.T) {
+	publisher := &fakePublisher{concSize: 50}
+	h := newSearchTestHandler(publisher)
+	for _, startRecord := range []string{"1", "11", "21"} {
+		args := url.Values{}
+		args.Set(SearchRetrArgRandomSample.String(), "50")
+		args.Set(SearchRetrStartRecord.String(), startRecord)
+		assert.Empty(t, runSearch(h, args))
+	}
+	concArgs := publishedConcArgs(t, publisher)
+	if !assert.NotEmpty(t, concArgs) {
+		return
+	}
+	// all the pages are taken from the same sample - i.e. the requests
+	// differ only in the requested range of lines
+	first := concArgs[0]
+	for _, args := range concArgs {
+		assert.Equal(t, 50, args.SampleSize)
+		assert.Equal(t, first.SampleSeed, args.SampleSeed)
+		args.StartLine, args.MaxItems = first.StartLine, first.MaxItems
+		assert.Equal(t, first, args)
+	}
+}
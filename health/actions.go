@@ -0,0 +1,53 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package health
+
+import (
+	"net/http"
+
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/gin-gonic/gin"
+)
+
+type Actions struct {
+	checker *Checker
+}
+
+// Health reports results of all the health checks. As long as
+// the API server runs, the response status is 200 (liveness).
+func (a *Actions) Health(ctx *gin.Context) {
+	report := a.checker.Check(ctx.Request.Context())
+	uniresp.WriteJSONResponse(ctx.Writer, report)
+}
+
+// Ready reports results of all the health checks. The response
+// status is 200 only if searches are expected to work (readiness),
+// otherwise 503 is returned.
+func (a *Actions) Ready(ctx *gin.Context) {
+	report := a.checker.Check(ctx.Request.Context())
+	if !report.Ready {
+		uniresp.WriteJSONResponseWithStatus(ctx.Writer, http.StatusServiceUnavailable, report)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, report)
+}
+
+func NewActions(checker *Checker) *Actions {
+	return &Actions{checker: checker}
+}
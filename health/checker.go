@@ -0,0 +1,316 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	pingTimeout = 5 * time.Second
+
+	canaryClientID = "health-canary"
+)
+
+var errNotCheckedYet = errors.New("not checked yet")
+
+// Pinger is implemented by queue backends using a remote service
+// (see rdb.Adapter)
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// CheckResult is a result of a single health check
+type CheckResult struct {
+	OK        bool      `json:"ok"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+func newCheckResult(err error) CheckResult {
+	ans := CheckResult{OK: err == nil, CheckedAt: time.Now()}
+	if err != nil {
+		ans.Error = err.Error()
+	}
+	return ans
+}
+
+// WorkersCheckResult describes live workers
+type WorkersCheckResult struct {
+	CheckResult
+	NumLive int `json:"numLive"`
+}
+
+// CanaryResult is a result of a canary query
+type CanaryResult struct {
+	CheckResult
+
+	// NotConfigured means there is no canary query for the corpus
+	// and searching in the corpus is not tested
+	NotConfigured bool `json:"notConfigured,omitempty"`
+
+	Query      string `json:"query"`
+	ConcSize   int    `json:"concSize"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Report contains results of all the health checks
+type Report struct {
+
+	// Ready means that searches are expected to work
+	// (at least in some of the corpora)
+	Ready bool `json:"ready"`
+
+	// Degraded means that some of the corpora cannot be searched
+	// (see Registries and Canaries for details)
+	Degraded bool `json:"degraded"`
+
+	// Redis is nil in case Redis is not used (the "combined" mode)
+	Redis *CheckResult `json:"redis,omitempty"`
+
+	// Workers is nil in case the queue does not support heartbeats
+	Workers *WorkersCheckResult `json:"workers,omitempty"`
+
+	// Registries contains checks of corpora registry files
+	// (by corpus ID)
+	Registries map[string]CheckResult `json:"registries"`
+
+	// Canaries contains results of the latest canary
+	// queries (by corpus ID). Corpora without a canary query
+	// are marked as not configured.
+	Canaries map[string]CanaryResult `json:"canaries"`
+}
+
+// Checker performs health checks of the whole search pipeline.
+// Canary queries are run periodically in background (see GoRunCanaries),
+// other checks are performed on each request.
+type Checker struct {
+	conf        *Conf
+	corporaConf *corpus.CorporaSetup
+	queue       rdb.QueryPublisher
+
+	// pinger is nil in case the queue does not use a remote service
+	pinger Pinger
+
+	// heartbeats is nil in case the queue does not support heartbeats
+	heartbeats rdb.WorkerHeartbeats
+
+	mu       sync.RWMutex
+	canaries map[string]CanaryResult
+}
+
+func (c *Checker) checkRedis(ctx context.Context) *CheckResult {
+	if c.pinger == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	ans := newCheckResult(c.pinger.Ping(ctx))
+	return &ans
+}
+
+func (c *Checker) checkWorkers() *WorkersCheckResult {
+	if c.heartbeats == nil {
+		return nil
+	}
+	workers, err := c.heartbeats.LiveWorkers(rdb.WorkerHeartbeatMaxAge)
+	if err == nil && len(workers) == 0 {
+		err = errors.New("no live workers")
+	}
+	return &WorkersCheckResult{
+		CheckResult: newCheckResult(err),
+		NumLive:     len(workers),
+	}
+}
+
+func (c *Checker) checkRegistry(corpusID string) CheckResult {
+	path := c.corporaConf.GetRegistryPath(corpusID)
+	f, err := os.Open(path)
+	if err != nil {
+		return newCheckResult(fmt.Errorf("failed to open registry file: %w", err))
+	}
+	defer f.Close()
+	if _, err := f.Read(make([]byte, 1)); err != nil {
+		return newCheckResult(fmt.Errorf("failed to read registry file: %w", err))
+	}
+	return newCheckResult(nil)
+}
+
+func (c *Checker) canaryQuery(rsc *corpus.CorpusSetup) string {
+	if rsc.CanaryQuery != "" {
+		return rsc.CanaryQuery
+	}
+	return c.conf.CanaryQuery
+}
+
+// runCanary searches the corpus the same way a user search would do
+// (i.e. via the queue and a worker) except for the result cache
+func (c *Checker) runCanary(ctx context.Context, rsc *corpus.CorpusSetup) CanaryResult {
+	ans := CanaryResult{Query: c.canaryQuery(rsc)}
+	if len(rsc.PosAttrs) == 0 {
+		ans.CheckResult = newCheckResult(errors.New("no positional attributes configured"))
+		return ans
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(c.conf.CanaryTimeoutSecs)*time.Second)
+	defer cancel()
+	ctx = rdb.WithQueryOrigin(
+		ctx, rdb.QueryOrigin{Lane: rdb.LaneWatchdog, ClientID: canaryClientID})
+	t0 := time.Now()
+	wait, err := c.queue.PublishQuery(ctx, rdb.Query{
+		Func: rdb.FuncConcExample,
+		Args: rdb.ConcQueryArgs{
+			CorpusPath: c.corporaConf.GetRegistryPath(rsc.ID),
+			Query:      ans.Query,
+			// the first attribute must be duplicated, see the "searchRetrieve" handler
+			Attrs:    []string{rsc.PosAttrs[0].Name, rsc.PosAttrs[0].Name},
+			MaxItems: 1,
+			NoCache:  true,
+		},
+	})
+	if err != nil {
+		ans.CheckResult = newCheckResult(err)
+		return ans
+	}
+	res := <-wait
+	ans.DurationMs = time.Since(t0).Milliseconds()
+	ans.ConcSize = res.ConcSize
+	ans.CheckResult = newCheckResult(res.Error)
+	return ans
+}
+
+func (c *Checker) runCanaries(ctx context.Context) {
+	for _, rsc := range c.corporaConf.Resources {
+		if c.canaryQuery(rsc) == "" {
+			continue
+		}
+		res := c.runCanary(ctx, rsc)
+		if ctx.Err() != nil {
+			// the service is being stopped
+			return
+		}
+		if !res.OK {
+			log.Error().
+				Str("corpus", rsc.ID).
+				Str("query", res.Query).
+				Str("error", res.Error).
+				Msg("health check canary query failed")
+		}
+		c.mu.Lock()
+		c.canaries[rsc.ID] = res
+		c.mu.Unlock()
+	}
+}
+
+// GoRunCanaries runs canary queries in background until
+// the `ctx` is cancelled. The first run starts immediately.
+func (c *Checker) GoRunCanaries(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Duration(c.conf.CanaryIntervalSecs) * time.Second)
+		defer ticker.Stop()
+		for {
+			c.runCanaries(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Check performs all the checks (except for canary queries
+// where the latest results are used) and creates a report.
+// A failing corpus does not make the service unready as long
+// as there is at least one corpus which can be searched.
+// Corpora without a canary query are considered searchable
+// as long as their registry files can be read.
+func (c *Checker) Check(ctx context.Context) Report {
+	ans := Report{
+		Ready:      true,
+		Redis:      c.checkRedis(ctx),
+		Workers:    c.checkWorkers(),
+		Registries: make(map[string]CheckResult),
+		Canaries:   make(map[string]CanaryResult),
+	}
+	if ans.Redis != nil && !ans.Redis.OK {
+		ans.Ready = false
+	}
+	if ans.Workers != nil && !ans.Workers.OK {
+		ans.Ready = false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var numAvailable int
+	for _, rsc := range c.corporaConf.Resources {
+		reg := c.checkRegistry(rsc.ID)
+		ans.Registries[rsc.ID] = reg
+		canary, ok := c.canaries[rsc.ID]
+		if c.canaryQuery(rsc) == "" {
+			canary = CanaryResult{NotConfigured: true}
+
+		} else if !ok {
+			canary = CanaryResult{
+				Query:       c.canaryQuery(rsc),
+				CheckResult: CheckResult{Error: errNotCheckedYet.Error()},
+			}
+		}
+		ans.Canaries[rsc.ID] = canary
+		if reg.OK && (canary.OK || canary.NotConfigured) {
+			numAvailable++
+
+		} else {
+			ans.Degraded = true
+		}
+	}
+	if numAvailable == 0 {
+		ans.Ready = false
+	}
+	return ans
+}
+
+// NewChecker creates a new health checker. Redis and worker
+// checks are used in case the `queue` supports them.
+func NewChecker(
+	conf *Conf,
+	corporaConf *corpus.CorporaSetup,
+	queue rdb.QueryPublisher,
+) *Checker {
+	ans := &Checker{
+		conf:        conf,
+		corporaConf: corporaConf,
+		queue:       queue,
+		canaries:    make(map[string]CanaryResult),
+	}
+	if pinger, ok := queue.(Pinger); ok {
+		ans.pinger = pinger
+	}
+	if heartbeats, ok := queue.(rdb.WorkerHeartbeats); ok {
+		ans.heartbeats = heartbeats
+	}
+	return ans
+}
@@ -0,0 +1,198 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeQueue answers canary queries immediately and reports
+// configured Redis and workers state
+type fakeQueue struct {
+	pingErr     error
+	liveWorkers []string
+
+	// failing contains registry paths of corpora where
+	// queries fail
+	failing map[string]bool
+
+	queries []string
+}
+
+func (q *fakeQueue) PublishQuery(ctx context.Context, query rdb.Query) (<-chan result.ConcResult, error) {
+	args := query.Args.(rdb.ConcQueryArgs)
+	q.queries = append(q.queries, args.Query)
+	ans := make(chan result.ConcResult, 1)
+	if q.failing[args.CorpusPath] {
+		ans <- result.ConcResult{Error: errors.New("failed to open corpus")}
+
+	} else {
+		ans <- result.ConcResult{ConcSize: 7}
+	}
+	return ans, nil
+}
+
+func (q *fakeQueue) PublishAttrValuesQuery(ctx context.Context, query rdb.Query) (<-chan result.AttrValuesResult, error) {
+	return nil, errors.New("not supported")
+}
+
+func (q *fakeQueue) Ping(ctx context.Context) error {
+	return q.pingErr
+}
+
+func (q *fakeQueue) WriteHeartbeat(status rdb.WorkerStatus) error {
+	return nil
+}
+
+func (q *fakeQueue) WorkersStatus() ([]rdb.WorkerStatus, error) {
+	return []rdb.WorkerStatus{}, nil
+}
+
+func (q *fakeQueue) LiveWorkers(maxAge time.Duration) ([]string, error) {
+	return q.liveWorkers, nil
+}
+
+func newTestChecker(t *testing.T, queue *fakeQueue, conf *Conf) *Checker {
+	regDir := t.TempDir()
+	for _, corpusID := range []string{"A", "B"} {
+		err := os.WriteFile(filepath.Join(regDir, corpusID), []byte("PATH /tmp\n"), 0644)
+		assert.NoError(t, err)
+	}
+	posAttrs := []corpus.PosAttr{{Name: "word"}}
+	corporaConf := &corpus.CorporaSetup{
+		RegistryDir: regDir,
+		Resources: corpus.SrchResources{
+			{ID: "A", PosAttrs: posAttrs, CanaryQuery: `[word="a"]`},
+			{ID: "B", PosAttrs: posAttrs},
+		},
+	}
+	return NewChecker(conf, corporaConf, queue)
+}
+
+func TestCheckCorpusWithoutCanary(t *testing.T) {
+	queue := &fakeQueue{liveWorkers: []string{"w1"}}
+	checker := newTestChecker(t, queue, &Conf{CanaryTimeoutSecs: 1})
+	checker.runCanaries(context.Background())
+	assert.Equal(t, []string{`[word="a"]`}, queue.queries)
+
+	report := checker.Check(context.Background())
+	assert.True(t, report.Ready)
+	assert.False(t, report.Degraded)
+	assert.True(t, report.Canaries["A"].OK)
+	assert.True(t, report.Canaries["B"].NotConfigured)
+	assert.Empty(t, report.Canaries["B"].Error)
+
+	// only the registry file is checked for corpora without a canary query
+	queue.failing = map[string]bool{checker.corporaConf.GetRegistryPath("A"): true}
+	checker.runCanaries(context.Background())
+	report = checker.Check(context.Background())
+	assert.True(t, report.Ready)
+	assert.True(t, report.Degraded)
+
+	assert.NoError(t, os.Remove(checker.corporaConf.GetRegistryPath("B")))
+	report = checker.Check(context.Background())
+	assert.False(t, report.Ready)
+}
+
+func TestCheckNotReadyBeforeCanaries(t *testing.T) {
+	checker := newTestChecker(t, &fakeQueue{liveWorkers: []string{"w1"}}, &Conf{CanaryQuery: `[word="x"]`})
+	report := checker.Check(context.Background())
+	assert.False(t, report.Ready)
+	assert.Equal(t, errNotCheckedYet.Error(), report.Canaries["A"].Error)
+	assert.True(t, report.Registries["A"].OK)
+}
+
+func TestCheckUsesCorpusCanaryQuery(t *testing.T) {
+	queue := &fakeQueue{liveWorkers: []string{"w1"}}
+	checker := newTestChecker(t, queue, &Conf{CanaryQuery: `[word="x"]`, CanaryTimeoutSecs: 1})
+	checker.runCanaries(context.Background())
+	assert.Equal(t, []string{`[word="a"]`, `[word="x"]`}, queue.queries)
+
+	report := checker.Check(context.Background())
+	assert.True(t, report.Ready)
+	assert.False(t, report.Degraded)
+	assert.Equal(t, 7, report.Canaries["A"].ConcSize)
+	assert.Equal(t, 1, report.Workers.NumLive)
+}
+
+func TestCheckDegradedCorpus(t *testing.T) {
+	queue := &fakeQueue{liveWorkers: []string{"w1"}}
+	checker := newTestChecker(t, queue, &Conf{CanaryQuery: `[word="x"]`, CanaryTimeoutSecs: 1})
+	queue.failing = map[string]bool{checker.corporaConf.GetRegistryPath("B"): true}
+	checker.runCanaries(context.Background())
+
+	report := checker.Check(context.Background())
+	assert.True(t, report.Ready)
+	assert.True(t, report.Degraded)
+	assert.True(t, report.Canaries["A"].OK)
+	assert.False(t, report.Canaries["B"].OK)
+
+	queue.failing[checker.corporaConf.GetRegistryPath("A")] = true
+	checker.runCanaries(context.Background())
+	report = checker.Check(context.Background())
+	assert.False(t, report.Ready)
+}
+
+func TestCheckInfrastructure(t *testing.T) {
+	queue := &fakeQueue{}
+	checker := newTestChecker(t, queue, &Conf{CanaryQuery: `[word="x"]`, CanaryTimeoutSecs: 1})
+	checker.runCanaries(context.Background())
+
+	report := checker.Check(context.Background())
+	assert.False(t, report.Ready)
+	assert.False(t, report.Workers.OK)
+	assert.True(t, report.Redis.OK)
+
+	queue.liveWorkers = []string{"w1"}
+	queue.pingErr = errors.New("connection refused")
+	report = checker.Check(context.Background())
+	assert.False(t, report.Ready)
+	assert.False(t, report.Redis.OK)
+}
+
+func TestReadyStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	queue := &fakeQueue{liveWorkers: []string{"w1"}}
+	checker := newTestChecker(t, queue, &Conf{CanaryQuery: `[word="x"]`, CanaryTimeoutSecs: 1})
+	actions := NewActions(checker)
+
+	runReady := func() int {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/ready", nil)
+		actions.Ready(ctx)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, runReady())
+	checker.runCanaries(context.Background())
+	assert.Equal(t, http.StatusOK, runReady())
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package health
+
+import (
+	"fmt"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dfltCanaryIntervalSecs = 300
+	dfltCanaryTimeoutSecs  = 30
+)
+
+// Conf configures health checks
+type Conf struct {
+
+	// CanaryQuery is a Manatee CQL query used to test searching
+	// in corpora without their own canary query (see corpus.CorpusSetup).
+	// As the whole concordance is always calculated, a selective query
+	// with a small result must be used. There is no default value as
+	// such a query depends on corpus data. Corpora without any canary
+	// query are not tested by canaries.
+	CanaryQuery string `json:"canaryQuery"`
+
+	// CanaryIntervalSecs specifies how often canary queries are run
+	CanaryIntervalSecs int `json:"canaryIntervalSecs"`
+
+	// CanaryTimeoutSecs specifies how long a canary query can take
+	CanaryTimeoutSecs int `json:"canaryTimeoutSecs"`
+}
+
+func (conf *Conf) ValidateAndDefaults(confContext string) error {
+	if conf.CanaryIntervalSecs < 0 {
+		return fmt.Errorf("`%s.canaryIntervalSecs` must be a positive number", confContext)
+
+	} else if conf.CanaryIntervalSecs == 0 {
+		conf.CanaryIntervalSecs = dfltCanaryIntervalSecs
+		log.Warn().
+			Int("value", conf.CanaryIntervalSecs).
+			Msgf("%s.canaryIntervalSecs not specified, using default", confContext)
+	}
+	if conf.CanaryTimeoutSecs < 0 {
+		return fmt.Errorf("`%s.canaryTimeoutSecs` must be a positive number", confContext)
+
+	} else if conf.CanaryTimeoutSecs == 0 {
+		conf.CanaryTimeoutSecs = dfltCanaryTimeoutSecs
+		log.Warn().
+			Int("value", conf.CanaryTimeoutSecs).
+			Msgf("%s.canaryTimeoutSecs not specified, using default", confContext)
+	}
+	return nil
+}
+
+// WarnMissingCanaries logs corpora without a canary query (neither
+// their own one nor the one configured for health checks). Such corpora
+// are not tested by synthetic searches.
+func (conf *Conf) WarnMissingCanaries(confContext string, resources corpus.SrchResources) {
+	if conf.CanaryQuery != "" {
+		return
+	}
+	for i, rsc := range resources {
+		if rsc.CanaryQuery == "" {
+			log.Warn().
+				Str("corpus", rsc.ID).
+				Msgf("%s.resources[%d].canaryQuery not set, canary checks disabled for the corpus", confContext, i)
+		}
+	}
+}
@@ -23,9 +23,111 @@
 #include "query/cqpeval.hh"
 #include "mango.h"
 #include <cmath>
+#include <vector>
+#include <algorithm>
+#include <random>
+#include <unordered_set>
+#include <sstream>
+#include <atomic>
+#include <chrono>
+#include <thread>
+#include <memory>
+#include <mutex>
+#include <map>
+#include <list>
 
 using namespace std;
 
+// how often we check for cancellation of a running concordance computation
+const int cancelCheckIntervalMs = 50;
+
+
+CancelTokenV cancel_token_new() {
+    return new std::atomic<bool>(false);
+}
+
+void cancel_token_set(CancelTokenV token) {
+    static_cast<std::atomic<bool>*>(token)->store(true);
+}
+
+void cancel_token_free(CancelTokenV token) {
+    delete static_cast<std::atomic<bool>*>(token);
+}
+
+
+
+/**
+ * @brief Select a deterministic random sample of `sampleSize` concordance
+ * lines out of `concSize` ones. The same seed always produces the same sample
+ * so paging through the sample is stable. The returned line indices are sorted
+ * so the sample keeps the original order of the concordance.
+ * (Robert Floyd's algorithm is used so we never allocate more than `sampleSize` items)
+ *
+ * @param concSize
+ * @param sampleSize
+ * @param seed
+ * @return std::vector<PosInt>
+ */
+std::vector<PosInt> sample_lines(PosInt concSize, PosInt sampleSize, PosInt seed) {
+    std::vector<PosInt> ans;
+    if (sampleSize >= concSize) {
+        ans.reserve(concSize);
+        for (PosInt i = 0; i < concSize; i++) {
+            ans.push_back(i);
+        }
+        return ans;
+    }
+    std::mt19937_64 rng(static_cast<std::uint64_t>(seed));
+    std::unordered_set<PosInt> selected;
+    selected.reserve(sampleSize);
+    for (PosInt j = concSize - sampleSize; j < concSize; j++) {
+        std::uniform_int_distribution<PosInt> dist(0, j);
+        PosInt t = dist(rng);
+        if (!selected.insert(t).second) {
+            selected.insert(j);
+        }
+    }
+    ans.assign(selected.begin(), selected.end());
+    std::sort(ans.begin(), ans.end());
+    return ans;
+}
+
+/**
+ * @brief Export the current line of `kl` into a newly allocated string
+ * in the form "[refs][refsSplitter][left] [kwic] [right]".
+ *
+ * @param kl
+ * @param refsSplitter
+ * @return char*
+ */
+char* export_kwic_line(KWICLines* kl, const char* refsSplitter) {
+    auto lft = kl->get_left();
+    auto kwc = kl->get_kwic();
+    auto rgt = kl->get_right();
+    std::ostringstream buffer;
+
+    buffer << kl->get_refs() << refsSplitter;
+
+    for (size_t i = 0; i < lft.size(); ++i) {
+        if (i > 0) {
+            buffer << " ";
+        }
+        buffer << lft.at(i);
+    }
+    for (size_t i = 0; i < kwc.size(); ++i) {
+        if (i > 0) {
+            buffer << " ";
+        }
+        buffer << kwc.at(i);
+    }
+    for (size_t i = 0; i < rgt.size(); ++i) {
+        if (i > 0) {
+            buffer << " ";
+        }
+        buffer << rgt.at(i);
+    }
+    return strdup(buffer.str().c_str());
+}
 
 /**
  * @brief Based on provided query, return at most `limit` sentences matching the query.
@@ -33,7 +135,12 @@ using namespace std;
  * @param corpusPath
  * @param query
  * @param attrs Positional attributes (comma-separated) to be attached to returned tokens
- * @param limit
+ * @param limit a maximum number of returned lines; for zero, only
+ *   the concordance size is returned
+ * @param sampleSize if greater than zero, lines are taken from a random sample
+ *   of the concordance (and the reported concordance size is the size of the sample)
+ * @param sampleSeed a seed for the random sample
+ * @param cancelToken allows for cancelling the concordance computation
  * @return KWICRowsRetval
  */
 KWICRowsRetval conc_examples(
@@ -46,15 +153,44 @@ KWICRowsRetval conc_examples(
     PosInt fromLine,
     PosInt limit,
     PosInt maxContext,
-    const char* viewContextStruct) {
+    const char* viewContextStruct,
+    PosInt sampleSize,
+    PosInt sampleSeed,
+    CancelTokenV cancelToken) {
 
     string cPath(corpusPath);
     try {
         Corpus* corp = new Corpus(cPath);
         Concordance* conc = new Concordance(
             corp, corp->filter_query(eval_cqpquery(query, corp)));
+        // the concordance is computed in a separate thread so instead
+        // of just calling conc->sync(), we can watch for cancellation
+        auto cancelled = static_cast<std::atomic<bool>*>(cancelToken);
+        while (!conc->finished()) {
+            if (cancelled->load()) {
+                delete conc;
+                delete corp;
+                KWICRowsRetval ans {
+                    nullptr,
+                    0,
+                    0,
+                    strdup("concordance computation cancelled"),
+                    2
+                };
+                return ans;
+            }
+            std::this_thread::sleep_for(std::chrono::milliseconds(cancelCheckIntervalMs));
+        }
         conc->sync();
-        if (conc->size() == 0 && fromLine == 0) {
+        std::vector<PosInt> sample;
+        PosInt concSize = conc->size();
+        if (sampleSize > 0) {
+            sample = sample_lines(concSize, sampleSize, sampleSeed);
+            concSize = sample.size();
+        }
+        if (concSize == 0 && fromLine == 0) {
+            delete conc;
+            delete corp;
             KWICRowsRetval ans {
                 nullptr,
                 0,
@@ -63,72 +199,98 @@ KWICRowsRetval conc_examples(
             };
             return ans;
         }
-        if (conc->size() < fromLine) {
+        if (concSize < fromLine) {
+            delete conc;
+            delete corp;
             const char* msg = "line range out of result size";
             char* dynamicStr = static_cast<char*>(malloc(strlen(msg) + 1));
             strcpy(dynamicStr, msg);
+            // we still provide the concordance size so the caller
+            // is able to calculate correct ranges
             KWICRowsRetval ans {
                 nullptr,
                 0,
-                0,
+                concSize,
                 dynamicStr,
                 1
             };
             return ans;
         }
-        conc->shuffle();
-        PosInt concSize = conc->size();
+        if (limit == 0) {
+            // only the concordance size has been requested
+            delete conc;
+            delete corp;
+            KWICRowsRetval ans {
+                nullptr,
+                0,
+                concSize,
+                nullptr,
+                0
+            };
+            return ans;
+        }
         std::string cppContextStruct(viewContextStruct);
-        std::string halfLeft = "-" + std::to_string(int(std::floor(maxContext / 2.0)));
-        std::string halfRight = std::to_string(int(std::ceil(maxContext / 2.0)));
-        KWICLines* kl = new KWICLines(
-            corp,
-            conc->RS(true, fromLine, fromLine+limit),
-            cppContextStruct.empty() ? halfLeft.c_str() : ("-1:"+cppContextStruct).c_str(),
-            cppContextStruct.empty() ? halfRight.c_str() : ("1:"+cppContextStruct).c_str(),
-            attrs,
-            attrs,
-            structs,
-            refs,
-            maxContext,
-            false
-        );
-        if (conc->size() < limit) {
-            limit = conc->size();
+        std::string leftCtx = cppContextStruct.empty() ?
+            "-" + std::to_string(int(std::floor(maxContext / 2.0))) : "-1:" + cppContextStruct;
+        std::string rightCtx = cppContextStruct.empty() ?
+            std::to_string(int(std::ceil(maxContext / 2.0))) : "1:" + cppContextStruct;
+        if (concSize < limit) {
+            limit = concSize;
         }
         char** lines = (char**)malloc(limit * sizeof(char*));
         int i = 0;
-        while (kl->nextline()) {
-            auto lft = kl->get_left();
-            auto kwc = kl->get_kwic();
-            auto rgt = kl->get_right();
-            std::ostringstream buffer;
-
-            buffer << kl->get_refs() << refsSplitter;
-
-            for (size_t i = 0; i < lft.size(); ++i) {
-                if (i > 0) {
-                    buffer << " ";
+        if (sampleSize > 0) {
+            // sampled lines are not contiguous so we fetch them by runs
+            // of consecutive lines (with a single KWICLines per run)
+            PosInt j = fromLine;
+            while (j < concSize && i < limit) {
+                PosInt runEnd = j + 1;
+                while (runEnd < concSize && runEnd - j < limit - i
+                        && sample[runEnd] == sample[runEnd-1] + 1) {
+                    runEnd++;
                 }
-                buffer << lft.at(i);
-            }
-            for (size_t i = 0; i < kwc.size(); ++i) {
-                if (i > 0) {
-                    buffer << " ";
+                KWICLines* kl = new KWICLines(
+                    corp,
+                    conc->RS(false, sample[j], sample[runEnd-1]+1),
+                    leftCtx.c_str(),
+                    rightCtx.c_str(),
+                    attrs,
+                    attrs,
+                    structs,
+                    refs,
+                    maxContext,
+                    false
+                );
+                while (i < limit && kl->nextline()) {
+                    lines[i] = export_kwic_line(kl, refsSplitter);
+                    i++;
                 }
-                buffer << kwc.at(i);
+                delete kl;
+                j = runEnd;
             }
-            for (size_t i = 0; i < rgt.size(); ++i) {
-                if (i > 0) {
-                    buffer << " ";
+
+        } else {
+            conc->shuffle();
+            KWICLines* kl = new KWICLines(
+                corp,
+                conc->RS(true, fromLine, fromLine+limit),
+                leftCtx.c_str(),
+                rightCtx.c_str(),
+                attrs,
+                attrs,
+                structs,
+                refs,
+                maxContext,
+                false
+            );
+            while (kl->nextline()) {
+                lines[i] = export_kwic_line(kl, refsSplitter);
+                i++;
+                if (i == limit) {
+                    break;
                 }
-                buffer << rgt.at(i);
-            }
-            lines[i] = strdup(buffer.str().c_str());
-            i++;
-            if (i == limit) {
-                break;
             }
+            delete kl;
         }
         // We've allocated memory for `limit` rows,
         // but it's possible that there is less rows
@@ -167,3 +329,120 @@ void conc_examples_free(KWICRowsV value, int numItems) {
     }
     free(tValue);
 }
+
+
+typedef std::vector<std::pair<std::string, PosInt>> SortedLexicon;
+typedef std::pair<std::string, std::string> SortedLexiconKey;
+
+// maxSortedLexicons limits the number of sorted lexicons kept in memory,
+// the least recently used ones are removed first
+static const size_t maxSortedLexicons = 16;
+
+// sortedLexicons caches sorted attribute values (along with their
+// frequencies) by corpus path and attribute name so a scan does not have
+// to sort the whole lexicon each time. The sortedLexiconsLRU list contains
+// cached keys ordered from the most recently used one.
+static std::map<
+    SortedLexiconKey,
+    std::pair<std::shared_ptr<const SortedLexicon>, std::list<SortedLexiconKey>::iterator>
+> sortedLexicons;
+static std::list<SortedLexiconKey> sortedLexiconsLRU;
+static std::mutex sortedLexiconsMutex;
+
+/**
+ * @brief Get lexicographically sorted values of a positional attribute
+ * along with their frequencies. Once created, the list is cached (the cached
+ * list is recreated in case the size of the lexicon changes, e.g. due to
+ * a recompiled corpus). At most maxSortedLexicons lists are cached.
+ */
+static std::shared_ptr<const SortedLexicon> get_sorted_lexicon(
+    const std::string& corpusPath,
+    const std::string& attrName,
+    PosAttr* attr) {
+
+    auto key = std::make_pair(corpusPath, attrName);
+    {
+        std::lock_guard<std::mutex> lock(sortedLexiconsMutex);
+        auto cached = sortedLexicons.find(key);
+        if (cached != sortedLexicons.end() && PosInt(cached->second.first->size()) == PosInt(attr->id_range())) {
+            sortedLexiconsLRU.splice(sortedLexiconsLRU.begin(), sortedLexiconsLRU, cached->second.second);
+            return cached->second.first;
+        }
+    }
+    // sorting is done without the lock so other attributes can be served
+    auto items = std::make_shared<SortedLexicon>();
+    items->reserve(attr->id_range());
+    for (int id = 0; id < attr->id_range(); id++) {
+        items->push_back(std::make_pair(std::string(attr->id2str(id)), attr->freq(id)));
+    }
+    std::sort(items->begin(), items->end());
+    std::lock_guard<std::mutex> lock(sortedLexiconsMutex);
+    auto cached = sortedLexicons.find(key);
+    if (cached != sortedLexicons.end()) {
+        sortedLexiconsLRU.erase(cached->second.second);
+        sortedLexicons.erase(cached);
+    }
+    sortedLexiconsLRU.push_front(key);
+    sortedLexicons[key] = std::make_pair(items, sortedLexiconsLRU.begin());
+    while (sortedLexicons.size() > maxSortedLexicons) {
+        sortedLexicons.erase(sortedLexiconsLRU.back());
+        sortedLexiconsLRU.pop_back();
+    }
+    return items;
+}
+
+AttrValuesRetval attr_values(
+    const char* corpusPath,
+    const char* attrName,
+    const char* fromValue,
+    PosInt numBefore,
+    PosInt numAfter) {
+
+    string cPath(corpusPath);
+    try {
+        std::unique_ptr<Corpus> corp(new Corpus(cPath));
+        PosAttr* attr = corp->get_attr(attrName);
+        std::shared_ptr<const SortedLexicon> lexicon = get_sorted_lexicon(cPath, attrName, attr);
+        const SortedLexicon& items = *lexicon;
+        std::string cppFromValue(fromValue);
+        auto split = std::lower_bound(
+            items.begin(),
+            items.end(),
+            std::make_pair(cppFromValue, PosInt(0))
+        );
+        PosInt splitIdx = split - items.begin();
+        PosInt fromIdx = std::max(PosInt(0), splitIdx - numBefore);
+        PosInt toIdx = std::min(PosInt(items.size()), splitIdx + numAfter);
+        PosInt size = std::max(PosInt(0), toIdx - fromIdx);
+        char** values = (char**)malloc(size * sizeof(char*));
+        PosInt* freqs = (PosInt*)malloc(size * sizeof(PosInt));
+        for (PosInt i = 0; i < size; i++) {
+            values[i] = strdup(items[fromIdx + i].first.c_str());
+            freqs[i] = items[fromIdx + i].second;
+        }
+        AttrValuesRetval ans {
+            values,
+            freqs,
+            size,
+            nullptr
+        };
+        return ans;
+
+    } catch (std::exception &e) {
+        AttrValuesRetval ans {
+            nullptr,
+            nullptr,
+            0,
+            strdup(e.what())
+        };
+        return ans;
+    }
+}
+
+void attr_values_free(char** values, PosInt* freqs, int numItems) {
+    for (int i = 0; i < numItems; i++) {
+        free(values[i]);
+    }
+    free(values);
+    free(freqs);
+}
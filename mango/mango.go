@@ -24,9 +24,11 @@ package mango
 import "C"
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"unsafe"
 
 	"github.com/czcorpus/cnc-gokit/collections"
@@ -35,10 +37,19 @@ import (
 
 const (
 	MaxRecordsInternalLimit = 1000
+
+	// MaxAttrValuesInternalLimit limits number of attribute values
+	// we are able to obtain at once via GetAttrValues
+	MaxAttrValuesInternalLimit = 10000
+
+	// MaxSampleSizeInternalLimit limits size of a random sample
+	// of a concordance (see SampleArgs)
+	MaxSampleSizeInternalLimit = 1000000
 )
 
 var (
 	ErrRowsRangeOutOfConc = errors.New("rows range is out of concordance size")
+	ErrCancelled          = errors.New("concordance computation cancelled")
 )
 
 // ---
@@ -48,33 +59,88 @@ type GoConcSize struct {
 	CorpusSize int64
 }
 
+// SampleArgs specifies a deterministic random sample of a concordance.
+// The same seed always produces the same sample so it is possible to
+// page through it. A zero Size means no sampling.
+type SampleArgs struct {
+	Size int
+	Seed int64
+}
+
 type GoConcordance struct {
 	Lines    []string
 	ConcSize int
 }
 
+// GoAttrValue is a single value of a positional attribute
+// along with its absolute frequency in a corpus
+type GoAttrValue struct {
+	Value string
+	Freq  int64
+}
+
+// GetConcordance searches for `query` in a corpus and returns
+// lines of the resulting concordance. For zero `maxItems`, only
+// the concordance size is returned. Once the `ctx` is cancelled,
+// the computation is stopped and ErrCancelled is returned.
 func GetConcordance(
+	ctx context.Context,
 	corpusPath, query string,
 	attrs []string,
 	structs []string,
 	refs []string,
 	fromLine, maxItems, maxContext int,
 	viewContextStruct string,
+	sample SampleArgs,
 ) (GoConcordance, error) {
 	if !collections.SliceContains(refs, "#") {
 		refs = append([]string{"#"}, refs...)
 	}
+	cancelToken := C.cancel_token_new()
+	watchDone := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			C.cancel_token_set(cancelToken)
+		case <-watchDone:
+		}
+	}()
+	defer func() {
+		close(watchDone)
+		wg.Wait()
+		C.cancel_token_free(cancelToken)
+	}()
+	cCorpusPath := C.CString(corpusPath)
+	defer C.free(unsafe.Pointer(cCorpusPath))
+	cQuery := C.CString(query)
+	defer C.free(unsafe.Pointer(cQuery))
+	cAttrs := C.CString(strings.Join(attrs, ","))
+	defer C.free(unsafe.Pointer(cAttrs))
+	cStructs := C.CString(strings.Join(structs, ","))
+	defer C.free(unsafe.Pointer(cStructs))
+	cRefs := C.CString(strings.Join(refs, ","))
+	defer C.free(unsafe.Pointer(cRefs))
+	cRefsEndMark := C.CString(concordance.RefsEndMark)
+	defer C.free(unsafe.Pointer(cRefsEndMark))
+	cViewContextStruct := C.CString(viewContextStruct)
+	defer C.free(unsafe.Pointer(cViewContextStruct))
 	ans := C.conc_examples(
-		C.CString(corpusPath),
-		C.CString(query),
-		C.CString(strings.Join(attrs, ",")),
-		C.CString(strings.Join(structs, ",")),
-		C.CString(strings.Join(refs, ",")),
-		C.CString(concordance.RefsEndMark),
+		cCorpusPath,
+		cQuery,
+		cAttrs,
+		cStructs,
+		cRefs,
+		cRefsEndMark,
 		C.longlong(fromLine),
 		C.longlong(maxItems),
 		C.longlong(maxContext),
-		C.CString(viewContextStruct))
+		cViewContextStruct,
+		C.longlong(sample.Size),
+		C.longlong(sample.Seed),
+		cancelToken)
 	var ret GoConcordance
 	ret.Lines = make([]string, 0, maxItems)
 	ret.ConcSize = int(ans.concSize)
@@ -83,6 +149,9 @@ func GetConcordance(
 		defer C.free(unsafe.Pointer(ans.err))
 		if ans.errorCode == 1 {
 			return ret, ErrRowsRangeOutOfConc
+
+		} else if ans.errorCode == 2 {
+			return ret, ErrCancelled
 		}
 		return ret, err
 
@@ -100,3 +169,47 @@ func GetConcordance(
 	}
 	return ret, nil
 }
+
+// GetAttrValues returns lexicographically sorted values of a positional
+// attribute `attr` found around `fromValue`. At most `numBefore` values
+// lower than `fromValue` are returned, followed by at most `numAfter` values
+// greater or equal to `fromValue`. For an empty `fromValue`, the lexicon
+// is read from its beginning.
+func GetAttrValues(
+	corpusPath, attr, fromValue string,
+	numBefore, numAfter int,
+) ([]GoAttrValue, error) {
+	if numBefore+numAfter > MaxAttrValuesInternalLimit {
+		return []GoAttrValue{}, fmt.Errorf(
+			"cannot fetch more than %d attribute values", MaxAttrValuesInternalLimit)
+	}
+	cCorpusPath := C.CString(corpusPath)
+	defer C.free(unsafe.Pointer(cCorpusPath))
+	cAttr := C.CString(attr)
+	defer C.free(unsafe.Pointer(cAttr))
+	cFromValue := C.CString(fromValue)
+	defer C.free(unsafe.Pointer(cFromValue))
+	ans := C.attr_values(
+		cCorpusPath,
+		cAttr,
+		cFromValue,
+		C.longlong(numBefore),
+		C.longlong(numAfter),
+	)
+	if ans.err != nil {
+		err := fmt.Errorf(C.GoString(ans.err))
+		defer C.free(unsafe.Pointer(ans.err))
+		return []GoAttrValue{}, err
+	}
+	defer C.attr_values_free(ans.values, ans.freqs, C.int(ans.size))
+	ret := make([]GoAttrValue, int(ans.size))
+	values := (*[MaxAttrValuesInternalLimit]*C.char)(unsafe.Pointer(ans.values))
+	freqs := (*[MaxAttrValuesInternalLimit]C.PosInt)(unsafe.Pointer(ans.freqs))
+	for i := 0; i < int(ans.size); i++ {
+		ret[i] = GoAttrValue{
+			Value: C.GoString(values[i]),
+			Freq:  int64(freqs[i]),
+		}
+	}
+	return ret, nil
+}
@@ -26,6 +26,8 @@ typedef void* KWICRowsV;
 
 typedef long long int PosInt;
 
+typedef void* CancelTokenV;
+
 typedef struct ConcRetval {
     ConcV value;
     const char * err;
@@ -39,6 +41,13 @@ typedef struct KWICRowsRetval {
     int errorCode;
 } KWICRowsRetval;
 
+typedef struct AttrValuesRetval {
+    char** values;
+    PosInt* freqs;
+    PosInt size;
+    const char * err;
+} AttrValuesRetval;
+
 
 /**
  * @brief Based on provided query, return at most `limit` sentences matching the query.
@@ -51,7 +60,15 @@ typedef struct KWICRowsRetval {
  * @param corpusPath
  * @param query
  * @param attrs Positional attributes (comma-separated) to be attached to returned tokens
- * @param limit
+ * @param limit a maximum number of returned lines; for zero, only
+ *   the concordance size is returned
+ * @param sampleSize if greater than zero, lines are taken from a deterministic
+ *   random sample of `sampleSize` concordance lines (and the returned `concSize`
+ *   is the size of the sample)
+ * @param sampleSeed a seed used to select the random sample
+ * @param cancelToken a token (see `cancel_token_new`) allowing for
+ *   cancellation of the concordance computation. In such case, an error
+ *   with `errorCode` 2 is returned.
  * @return KWICRowsRetval
  */
 KWICRowsRetval conc_examples(
@@ -64,7 +81,33 @@ KWICRowsRetval conc_examples(
     PosInt fromLine,
     PosInt limit,
     PosInt maxContext,
-    const char* viewContextStruct);
+    const char* viewContextStruct,
+    PosInt sampleSize,
+    PosInt sampleSeed,
+    CancelTokenV cancelToken);
+/**
+ * @brief Create a new cancellation token for `conc_examples`.
+ * The token must be freed using `cancel_token_free`.
+ *
+ * @return CancelTokenV
+ */
+CancelTokenV cancel_token_new();
+
+/**
+ * @brief Request cancellation of a computation using the token.
+ * It is safe to call the function from a different thread.
+ *
+ * @param token
+ */
+void cancel_token_set(CancelTokenV token);
+
+/**
+ * @brief Free a cancellation token.
+ *
+ * @param token
+ */
+void cancel_token_free(CancelTokenV token);
+
 /**
  * @brief This function frees all the allocated memory
  * for a concordance example. It is intended to be called
@@ -75,6 +118,40 @@ KWICRowsRetval conc_examples(
  */
 void conc_examples_free(KWICRowsV value, int numItems);
 
+/**
+ * @brief Return values (along with their frequencies) of a positional
+ * attribute in the lexicographical order. The values are taken around
+ * the `fromValue` - at most `numBefore` values lower than `fromValue`
+ * followed by at most `numAfter` values greater or equal to `fromValue`.
+ * An empty `fromValue` means "from the beginning of the lexicon".
+ * The sorted lexicon is created once per corpus and attribute
+ * and then it is reused by following calls.
+ *
+ * @param corpusPath
+ * @param attrName
+ * @param fromValue
+ * @param numBefore
+ * @param numAfter
+ * @return AttrValuesRetval
+ */
+AttrValuesRetval attr_values(
+    const char* corpusPath,
+    const char* attrName,
+    const char* fromValue,
+    PosInt numBefore,
+    PosInt numAfter);
+
+/**
+ * @brief This function frees all the allocated memory
+ * for attribute values. It is intended to be called
+ * from Go.
+ *
+ * @param values
+ * @param freqs
+ * @param numItems
+ */
+void attr_values_free(char** values, PosInt* freqs, int numItems);
+
 
 #ifdef __cplusplus
 }
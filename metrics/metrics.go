@@ -0,0 +1,193 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package metrics defines Prometheus metrics of the server and workers.
+// All the metrics are registered in the default Prometheus registry.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "mquerysru"
+
+	// request labels set by FCS handlers (see SetRequestLabel)
+	LabelVersion   = "version"
+	LabelOperation = "operation"
+	LabelQueryType = "query_type"
+
+	ctxKeyPrefix = "metrics:"
+	unknownValue = "none"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of FCS requests by version, operation, query type and HTTP status",
+		},
+		[]string{LabelVersion, LabelOperation, LabelQueryType, "status"},
+	)
+
+	requestDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of FCS requests by version, operation and query type",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		},
+		[]string{LabelVersion, LabelOperation, LabelQueryType},
+	)
+
+	diagnosticsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "diagnostics_total",
+			Help:      "Number of SRU diagnostics emitted by diagnostic code",
+		},
+		[]string{LabelVersion, "code"},
+	)
+
+	queryWaitDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "query_wait_seconds",
+			Help:      "Time between publishing a query to workers and obtaining its result",
+			Buckets:   []float64{0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		},
+		[]string{"func"},
+	)
+
+	queryTimeoutsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "query_timeouts_total",
+			Help:      "Number of queries without worker response in time",
+		},
+		[]string{"func"},
+	)
+
+	queryCancellationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "query_cancellations_total",
+			Help:      "Number of queries cancelled by clients",
+		},
+		[]string{"func"},
+	)
+
+	concordanceSize = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "concordance_size",
+			Help:      "Sizes of concordances by corpus",
+			Buckets:   prometheus.ExponentialBuckets(1, 10, 9),
+		},
+		[]string{"corpus"},
+	)
+
+	jobDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "worker_job_duration_seconds",
+			Help:      "Duration of worker jobs",
+			Buckets:   []float64{0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		},
+		[]string{"worker_id", "func"},
+	)
+
+	jobErrorsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "worker_job_errors_total",
+			Help:      "Number of worker jobs finished with an error",
+		},
+		[]string{"worker_id", "func"},
+	)
+)
+
+// SetRequestLabel sets a label of the current FCS request metrics.
+// Labels not set by handlers are reported as "none".
+func SetRequestLabel(ctx *gin.Context, label, value string) {
+	ctx.Set(ctxKeyPrefix+label, value)
+}
+
+func requestLabel(ctx *gin.Context, label string) string {
+	if v := ctx.GetString(ctxKeyPrefix + label); v != "" {
+		return v
+	}
+	return unknownValue
+}
+
+// GinMiddleware measures FCS requests. It is expected to be used
+// only with FCS endpoints.
+func GinMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		t0 := time.Now()
+		ctx.Next()
+		version := requestLabel(ctx, LabelVersion)
+		operation := requestLabel(ctx, LabelOperation)
+		queryType := requestLabel(ctx, LabelQueryType)
+		requestsTotal.WithLabelValues(
+			version, operation, queryType, strconv.Itoa(ctx.Writer.Status())).Inc()
+		requestDuration.WithLabelValues(
+			version, operation, queryType).Observe(time.Since(t0).Seconds())
+	}
+}
+
+// Handler provides metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+func ObserveDiagnostic(version string, code int) {
+	diagnosticsTotal.WithLabelValues(version, strconv.Itoa(code)).Inc()
+}
+
+func ObserveQueryWait(fn string, dur time.Duration) {
+	queryWaitDuration.WithLabelValues(fn).Observe(dur.Seconds())
+}
+
+func ObserveQueryTimeout(fn string) {
+	queryTimeoutsTotal.WithLabelValues(fn).Inc()
+}
+
+func ObserveQueryCancellation(fn string) {
+	queryCancellationsTotal.WithLabelValues(fn).Inc()
+}
+
+func ObserveConcSize(corpusID string, size int) {
+	concordanceSize.WithLabelValues(corpusID).Observe(float64(size))
+}
+
+// ObserveJob records a finished worker job
+func ObserveJob(workerID, fn string, dur time.Duration, err error) {
+	jobDuration.WithLabelValues(workerID, fn).Observe(dur.Seconds())
+	if err != nil {
+		jobErrorsTotal.WithLabelValues(workerID, fn).Inc()
+	}
+}
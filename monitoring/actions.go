@@ -19,17 +19,40 @@
 package monitoring
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/czcorpus/cnc-gokit/datetime"
 	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/czcorpus/mquery-sru/rdb"
 	"github.com/gin-gonic/gin"
 )
 
+// ResultCacheStatsProvider provides statistics of the concordance
+// result cache (see rdb.Adapter)
+type ResultCacheStatsProvider interface {
+	ResultCacheStats() (rdb.CacheStats, error)
+}
+
+// QueueStatsProvider provides numbers of queued queries
+// per lane and client (see rdb.SchedulingConf)
+type QueueStatsProvider interface {
+	QueueStats() (rdb.QueueStats, error)
+}
+
+// WorkersStatusProvider provides statuses of running workers
+// (see rdb.WorkerHeartbeats)
+type WorkersStatusProvider interface {
+	WorkersStatus() ([]rdb.WorkerStatus, error)
+}
+
 type Actions struct {
-	logger   *WorkerJobLogger
-	location *time.Location
+	logger     *WorkerJobLogger
+	cacheStats ResultCacheStatsProvider
+	queueStats QueueStatsProvider
+	workers    WorkersStatusProvider
+	location   *time.Location
 }
 
 func (a *Actions) WorkersLoad(ctx *gin.Context) {
@@ -69,13 +92,99 @@ func (a *Actions) WorkersLoadTotal(ctx *gin.Context) {
 
 }
 
+// WorkersLoadTimeline provides workers' load per minute
+func (a *Actions) WorkersLoadTimeline(ctx *gin.Context) {
+	now := time.Now().In(a.location)
+	dur, err := datetime.ParseDuration(ctx.Request.URL.Query().Get("ago"))
+	fromDT := now.Add(-dur)
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusUnprocessableEntity)
+		return
+	}
+	timeline, err := a.logger.LoadTimeline(fromDT, now)
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusUnprocessableEntity)
+		return
+	}
+	for i := range timeline {
+		timeline[i].Load *= 100
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, timeline)
+}
+
+// ResultCache provides concordance cache hits and misses
+// as counted by all the workers
+func (a *Actions) ResultCache(ctx *gin.Context) {
+	if a.cacheStats == nil {
+		uniresp.RespondWithErrorJSON(
+			ctx, errors.New("result cache not available"), http.StatusNotFound)
+		return
+	}
+	stats, err := a.cacheStats.ResultCacheStats()
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	uniresp.WriteJSONResponse(
+		ctx.Writer,
+		map[string]any{
+			"hits":            stats.Hits,
+			"misses":          stats.Misses,
+			"hitRatioPercent": 100 * stats.HitRatio(),
+		},
+	)
+}
+
+// Queue provides numbers of queued queries per lane and client
+func (a *Actions) Queue(ctx *gin.Context) {
+	if a.queueStats == nil {
+		uniresp.RespondWithErrorJSON(
+			ctx, errors.New("queue statistics not available"), http.StatusNotFound)
+		return
+	}
+	stats, err := a.queueStats.QueueStats()
+	if errors.Is(err, rdb.ErrQueueStatsNotAvailable) {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusNotFound)
+		return
+
+	} else if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, stats)
+}
+
+// Workers lists running workers along with their jobs
+func (a *Actions) Workers(ctx *gin.Context) {
+	if a.workers == nil {
+		uniresp.RespondWithErrorJSON(
+			ctx, errors.New("workers status not available"), http.StatusNotFound)
+		return
+	}
+	workers, err := a.workers.WorkersStatus()
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, workers)
+}
+
+// NewActions creates monitoring actions. The `cacheStats`, `queueStats`
+// and `workers` arguments can be nil in case the respective information
+// is not available.
 func NewActions(
 	logger *WorkerJobLogger,
+	cacheStats ResultCacheStatsProvider,
+	queueStats QueueStatsProvider,
+	workers WorkersStatusProvider,
 	location *time.Location,
 ) *Actions {
 	ans := &Actions{
-		logger:   logger,
-		location: location,
+		logger:     logger,
+		cacheStats: cacheStats,
+		queueStats: queueStats,
+		workers:    workers,
+		location:   location,
 	}
 	return ans
 }
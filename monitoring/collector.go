@@ -0,0 +1,65 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package monitoring
+
+import (
+	"errors"
+
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+// QueueCollector exports numbers of queued queries per lane
+// as Prometheus metrics. The numbers are obtained on each scrape.
+type QueueCollector struct {
+	stats QueueStatsProvider
+	desc  *prometheus.Desc
+}
+
+func (qc *QueueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- qc.desc
+}
+
+func (qc *QueueCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := qc.stats.QueueStats()
+	if errors.Is(err, rdb.ErrQueueStatsNotAvailable) {
+		return
+
+	} else if err != nil {
+		log.Error().Err(err).Msg("failed to collect queue metrics")
+		return
+	}
+	for _, lane := range stats.Lanes {
+		ch <- prometheus.MustNewConstMetric(
+			qc.desc, prometheus.GaugeValue, float64(lane.NumQueued), lane.Name)
+	}
+}
+
+func NewQueueCollector(stats QueueStatsProvider) *QueueCollector {
+	return &QueueCollector{
+		stats: stats,
+		desc: prometheus.NewDesc(
+			"mquerysru_queue_length",
+			"Number of queries waiting for a worker by queue lane",
+			[]string{"lane"},
+			nil,
+		),
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package monitoring
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dfltRetentionDays = 7
+)
+
+// Conf configures persistence of worker job logs
+type Conf struct {
+
+	// DBPath is a path to an SQLite database file where worker job logs
+	// are stored. The file must be accessible by the server and all
+	// the workers (typically all the processes run on the same machine).
+	DBPath string `json:"dbPath"`
+
+	// RetentionDays specifies how long job logs and load timeline
+	// items are kept
+	RetentionDays int `json:"retentionDays"`
+}
+
+func (conf *Conf) ValidateAndDefaults(confContext string) error {
+	if conf.DBPath == "" {
+		return fmt.Errorf("missing `%s.dbPath`", confContext)
+	}
+	if conf.RetentionDays < 0 {
+		return fmt.Errorf("`%s.retentionDays` must be a positive number", confContext)
+
+	} else if conf.RetentionDays == 0 {
+		conf.RetentionDays = dfltRetentionDays
+		log.Warn().
+			Int("value", conf.RetentionDays).
+			Msgf("%s.retentionDays not specified, using default", confContext)
+	}
+	return nil
+}
@@ -21,60 +21,332 @@ package monitoring
 
 import (
 	"database/sql"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/czcorpus/mquery-sru/result"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog/log"
 )
 
+const (
+	timelineInterval = time.Minute
+	cleanupInterval  = time.Hour
+
+	// logBufferSize specifies how many job logs can wait for
+	// being stored before new ones are dropped
+	logBufferSize = 1000
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS worker_jobs (
+	worker_id TEXT NOT NULL,
+	slot INTEGER NOT NULL,
+	num_slots INTEGER NOT NULL,
+	lane TEXT NOT NULL,
+	func TEXT NOT NULL,
+	begin_ts INTEGER NOT NULL,
+	end_ts INTEGER NOT NULL,
+	error TEXT,
+	cache_hit INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS worker_jobs_end_ts_idx ON worker_jobs(end_ts);
+CREATE TABLE IF NOT EXISTS worker_load_timeline (
+	ts INTEGER NOT NULL,
+	worker_id TEXT NOT NULL,
+	load REAL NOT NULL,
+	PRIMARY KEY (ts, worker_id)
+);
+`
+
+// WorkersLoad maps worker IDs to ratios of time their job slots
+// were busy
 type WorkersLoad map[string]float64
 
+// TimelineItem is a load of a worker within a single timeline interval
+// (a minute) ending at `Time`
+type TimelineItem struct {
+	Time     time.Time `json:"time"`
+	WorkerID string    `json:"workerId"`
+	Load     float64   `json:"load"`
+}
+
+// WorkerJobLogger stores worker job logs and calculates workers' load.
+// Times are stored as Unix timestamps in milliseconds. Without a database
+// (i.e. `db` is nil), nothing is stored and all the loads are zero.
+// Job logs are written asynchronously by a single writer goroutine
+// so workers are not slowed down by the database.
 type WorkerJobLogger struct {
-	db       *sql.DB
-	location *time.Location
+	db            *sql.DB
+	location      *time.Location
+	retentionDays int
+	records       chan result.JobLog
+	writerDone    chan struct{}
+	closeOnce     sync.Once
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixMilli()
 }
 
+// Log passes the record to the writer goroutine. In case the writer
+// cannot keep up and its buffer is full, the record is dropped so
+// the calling worker is never blocked. Log must not be called after
+// Close.
 func (w *WorkerJobLogger) Log(rec result.JobLog) {
-	// TODO
+	if w.db == nil {
+		return
+	}
+	select {
+	case w.records <- rec:
+	default:
+		log.Error().
+			Str("workerId", rec.WorkerID).
+			Msg("job log buffer full, dropping job log")
+	}
 }
 
+// Close stops the writer goroutine once all the buffered
+// records are stored.
+func (w *WorkerJobLogger) Close() {
+	if w.db == nil {
+		return
+	}
+	w.closeOnce.Do(func() {
+		close(w.records)
+		<-w.writerDone
+	})
+}
+
+func (w *WorkerJobLogger) runWriter() {
+	defer close(w.writerDone)
+	for rec := range w.records {
+		if err := w.writeRecord(rec); err != nil {
+			log.Error().Err(err).Str("workerId", rec.WorkerID).Msg("failed to store job log")
+		}
+	}
+}
+
+func (w *WorkerJobLogger) writeRecord(rec result.JobLog) error {
+	var errMsg sql.NullString
+	if rec.Err != nil {
+		errMsg = sql.NullString{String: rec.Err.Error(), Valid: true}
+	}
+	numSlots := rec.NumSlots
+	if numSlots < 1 {
+		numSlots = 1
+	}
+	_, err := w.db.Exec(
+		"INSERT INTO worker_jobs "+
+			"(worker_id, slot, num_slots, lane, func, begin_ts, end_ts, error, cache_hit) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		rec.WorkerID, rec.Slot, numSlots, rec.Lane, rec.Func,
+		toMillis(rec.Begin), toMillis(rec.End), errMsg, rec.CacheHit,
+	)
+	return err
+}
+
+// busyTimes returns, for each worker with jobs overlapping the interval,
+// the sum of the jobs' durations within the interval and the number of
+// the worker's job slots.
+func (w *WorkerJobLogger) busyTimes(fromDT, toDT time.Time) (map[string][2]int64, error) {
+	from, to := toMillis(fromDT), toMillis(toDT)
+	rows, err := w.db.Query(
+		"SELECT worker_id, MAX(num_slots), SUM(MIN(end_ts, ?) - MAX(begin_ts, ?)) "+
+			"FROM worker_jobs WHERE end_ts > ? AND begin_ts < ? "+
+			"GROUP BY worker_id",
+		to, from, from, to,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workers load: %w", err)
+	}
+	defer rows.Close()
+	ans := make(map[string][2]int64)
+	for rows.Next() {
+		var workerID string
+		var numSlots, busy int64
+		if err := rows.Scan(&workerID, &numSlots, &busy); err != nil {
+			return nil, fmt.Errorf("failed to get workers load: %w", err)
+		}
+		ans[workerID] = [2]int64{busy, numSlots}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get workers load: %w", err)
+	}
+	return ans, nil
+}
+
+// WorkersLoad calculates, for each worker with jobs within the interval,
+// a ratio of time its job slots were busy. Only finished jobs are
+// considered.
 func (w *WorkerJobLogger) WorkersLoad(fromDT, toDT time.Time) (WorkersLoad, error) {
-	ans := make(map[string]float64)
-	// TODO
+	ans := make(WorkersLoad)
+	window := toMillis(toDT) - toMillis(fromDT)
+	if w.db == nil || window <= 0 {
+		return ans, nil
+	}
+	busy, err := w.busyTimes(fromDT, toDT)
+	if err != nil {
+		return ans, err
+	}
+	for workerID, v := range busy {
+		ans[workerID] = float64(v[0]) / float64(window*v[1])
+	}
 	return ans, nil
 }
 
+// TotalLoad calculates a ratio of busy time of all the job slots
+// of workers with jobs within the interval.
 func (w *WorkerJobLogger) TotalLoad(fromDT, toDT time.Time) (float64, error) {
-	// TODO
-	return 0, nil
+	window := toMillis(toDT) - toMillis(fromDT)
+	if w.db == nil || window <= 0 {
+		return 0, nil
+	}
+	busy, err := w.busyTimes(fromDT, toDT)
+	if err != nil {
+		return 0, err
+	}
+	var totalBusy, totalCapacity int64
+	for _, v := range busy {
+		totalBusy += v[0]
+		totalCapacity += window * v[1]
+	}
+	if totalCapacity == 0 {
+		return 0, nil
+	}
+	return float64(totalBusy) / float64(totalCapacity), nil
 }
 
-func (w *WorkerJobLogger) writeTimelineItem() error {
-	// TODO
+// LoadTimeline returns stored timeline items within the interval
+func (w *WorkerJobLogger) LoadTimeline(fromDT, toDT time.Time) ([]TimelineItem, error) {
+	ans := make([]TimelineItem, 0, 100)
+	if w.db == nil {
+		return ans, nil
+	}
+	rows, err := w.db.Query(
+		"SELECT ts, worker_id, load FROM worker_load_timeline "+
+			"WHERE ts > ? AND ts <= ? ORDER BY ts, worker_id",
+		toMillis(fromDT), toMillis(toDT),
+	)
+	if err != nil {
+		return ans, fmt.Errorf("failed to get load timeline: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item TimelineItem
+		var ts int64
+		if err := rows.Scan(&ts, &item.WorkerID, &item.Load); err != nil {
+			return ans, fmt.Errorf("failed to get load timeline: %w", err)
+		}
+		item.Time = time.UnixMilli(ts).In(w.location)
+		ans = append(ans, item)
+	}
+	if err := rows.Err(); err != nil {
+		return ans, fmt.Errorf("failed to get load timeline: %w", err)
+	}
+	return ans, nil
+}
+
+// writeTimelineItem stores workers' load within the last finished
+// timeline interval. As the interval is aligned, writing the same
+// item repeatedly (e.g. by multiple server instances) is harmless.
+func (w *WorkerJobLogger) writeTimelineItem(now time.Time) error {
+	toDT := now.Truncate(timelineInterval)
+	load, err := w.WorkersLoad(toDT.Add(-timelineInterval), toDT)
+	if err != nil {
+		return err
+	}
+	for workerID, v := range load {
+		_, err := w.db.Exec(
+			"INSERT OR REPLACE INTO worker_load_timeline (ts, worker_id, load) "+
+				"VALUES (?, ?, ?)",
+			toMillis(toDT), workerID, v,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to write timeline item: %w", err)
+		}
+	}
 	return nil
 }
 
-func (w *WorkerJobLogger) cleanupTimeline() error {
-	// TODO
+// cleanupTimeline removes job logs and timeline items
+// older than the configured retention time
+func (w *WorkerJobLogger) cleanupTimeline(now time.Time) error {
+	limit := toMillis(now.AddDate(0, 0, -w.retentionDays))
+	if _, err := w.db.Exec("DELETE FROM worker_jobs WHERE end_ts < ?", limit); err != nil {
+		return fmt.Errorf("failed to cleanup job logs: %w", err)
+	}
+	if _, err := w.db.Exec("DELETE FROM worker_load_timeline WHERE ts < ?", limit); err != nil {
+		return fmt.Errorf("failed to cleanup load timeline: %w", err)
+	}
 	return nil
 }
 
 func (w *WorkerJobLogger) GoRunTimelineWriter() {
+	if w.db == nil {
+		return
+	}
 	go func() {
-		ticker := time.NewTicker(60 * time.Second)
-		for range ticker.C {
-			w.writeTimelineItem()
+		ticker := time.NewTicker(timelineInterval)
+		for now := range ticker.C {
+			if err := w.writeTimelineItem(now); err != nil {
+				log.Error().Err(err).Msg("failed to write workers load timeline")
+			}
 		}
 	}()
 	go func() {
-		ticker := time.NewTicker(time.Hour)
-		for range ticker.C {
-			w.cleanupTimeline()
+		ticker := time.NewTicker(cleanupInterval)
+		for now := range ticker.C {
+			if err := w.cleanupTimeline(now); err != nil {
+				log.Error().Err(err).Msg("failed to cleanup workers load timeline")
+			}
 		}
 	}()
 }
 
-func NewWorkerJobLogger(location *time.Location) *WorkerJobLogger {
-	return &WorkerJobLogger{
+// openDB opens (and initializes if needed) an SQLite database
+// for job logs. The WAL mode along with the busy timeout allows
+// for concurrent writes of multiple worker processes.
+func openDB(path string) (*sql.DB, error) {
+	db, err := sql.Open(
+		"sqlite3",
+		fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=5000", path),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job log database: %w", err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize job log database: %w", err)
+	}
+	return db, nil
+}
+
+// NewWorkerJobLogger creates a new job logger. In case `conf` is nil,
+// job logs are not stored.
+func NewWorkerJobLogger(conf *Conf, location *time.Location) (*WorkerJobLogger, error) {
+	ans := &WorkerJobLogger{
 		location: location,
 	}
+	if conf == nil {
+		return ans, nil
+	}
+	db, err := openDB(conf.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	return newWorkerJobLogger(db, location, conf.RetentionDays), nil
+}
+
+func newWorkerJobLogger(db *sql.DB, location *time.Location, retentionDays int) *WorkerJobLogger {
+	ans := &WorkerJobLogger{
+		db:            db,
+		location:      location,
+		retentionDays: retentionDays,
+		records:       make(chan result.JobLog, logBufferSize),
+		writerDone:    make(chan struct{}),
+	}
+	go ans.runWriter()
+	return ans
 }
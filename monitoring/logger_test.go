@@ -0,0 +1,188 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package monitoring
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/stretchr/testify/assert"
+)
+
+var testT0 = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+func newTestLogger(t *testing.T) *WorkerJobLogger {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each connection to an in-memory database gets its own database
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return newWorkerJobLogger(db, time.UTC, 1)
+}
+
+func testJob(workerID string, slot, numSlots int, begin, end time.Duration) result.JobLog {
+	return result.JobLog{
+		WorkerID: workerID,
+		Slot:     slot,
+		NumSlots: numSlots,
+		Lane:     "default",
+		Func:     "concordance",
+		Begin:    testT0.Add(begin),
+		End:      testT0.Add(end),
+	}
+}
+
+// logTestJobs stores jobs overlapping the interval [testT0, testT0 + 1 minute]:
+// worker w1 (a single slot) is busy for 30s, worker w2 (two slots) for 75s
+// (jobs exceeding the interval are counted only partially) and worker w3
+// has no job within the interval
+func logTestJobs(t *testing.T, logger *WorkerJobLogger) {
+	logger.Log(testJob("w1", 0, 1, 0, 30*time.Second))
+	logger.Log(testJob("w2", 0, 2, -30*time.Second, 30*time.Second))
+	rec := testJob("w2", 1, 2, 15*time.Second, 75*time.Second)
+	rec.Err = errors.New("query failed")
+	logger.Log(rec)
+	logger.Log(testJob("w3", 0, 0, 2*time.Minute, 3*time.Minute))
+	logger.Close()
+}
+
+func countRows(t *testing.T, logger *WorkerJobLogger, table string) int {
+	var ans int
+	if err := logger.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&ans); err != nil {
+		t.Fatal(err)
+	}
+	return ans
+}
+
+func TestLogWritesAllRecords(t *testing.T) {
+	logger := newTestLogger(t)
+	logTestJobs(t, logger)
+	assert.Equal(t, 4, countRows(t, logger, "worker_jobs"))
+	var errMsg sql.NullString
+	err := logger.db.QueryRow(
+		"SELECT error FROM worker_jobs WHERE worker_id = 'w2' AND slot = 1").Scan(&errMsg)
+	assert.NoError(t, err)
+	assert.Equal(t, "query failed", errMsg.String)
+	var numSlots int
+	err = logger.db.QueryRow(
+		"SELECT num_slots FROM worker_jobs WHERE worker_id = 'w3'").Scan(&numSlots)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, numSlots)
+	// closing repeatedly is harmless
+	logger.Close()
+}
+
+func TestBusyTimes(t *testing.T) {
+	logger := newTestLogger(t)
+	logTestJobs(t, logger)
+	busy, err := logger.busyTimes(testT0, testT0.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		map[string][2]int64{
+			"w1": {30000, 1},
+			"w2": {75000, 2},
+		},
+		busy,
+	)
+}
+
+func TestWorkersLoad(t *testing.T) {
+	logger := newTestLogger(t)
+	logTestJobs(t, logger)
+	load, err := logger.WorkersLoad(testT0, testT0.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, load, 2)
+	assert.InDelta(t, 0.5, load["w1"], 1e-9)
+	assert.InDelta(t, 0.625, load["w2"], 1e-9)
+
+	load, err = logger.WorkersLoad(testT0, testT0)
+	assert.NoError(t, err)
+	assert.Empty(t, load)
+}
+
+func TestTotalLoad(t *testing.T) {
+	logger := newTestLogger(t)
+	logTestJobs(t, logger)
+	load, err := logger.TotalLoad(testT0, testT0.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.InDelta(t, 105.0/180.0, load, 1e-9)
+
+	load, err = logger.TotalLoad(testT0.Add(time.Hour), testT0.Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, load)
+}
+
+func TestLoadTimeline(t *testing.T) {
+	logger := newTestLogger(t)
+	logTestJobs(t, logger)
+	// the item is aligned to the end of the last finished interval
+	assert.NoError(t, logger.writeTimelineItem(testT0.Add(time.Minute+20*time.Second)))
+	// writing the same item again replaces it
+	assert.NoError(t, logger.writeTimelineItem(testT0.Add(time.Minute+40*time.Second)))
+	items, err := logger.LoadTimeline(testT0, testT0.Add(time.Hour))
+	assert.NoError(t, err)
+	if assert.Len(t, items, 2) {
+		assert.Equal(t, "w1", items[0].WorkerID)
+		assert.True(t, items[0].Time.Equal(testT0.Add(time.Minute)))
+		assert.InDelta(t, 0.5, items[0].Load, 1e-9)
+		assert.Equal(t, "w2", items[1].WorkerID)
+		assert.InDelta(t, 0.625, items[1].Load, 1e-9)
+	}
+	items, err = logger.LoadTimeline(testT0.Add(time.Minute), testT0.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+}
+
+func TestCleanupTimeline(t *testing.T) {
+	logger := newTestLogger(t)
+	logTestJobs(t, logger)
+	assert.NoError(t, logger.writeTimelineItem(testT0.Add(time.Minute)))
+
+	// retention is one day - only jobs finished before 10:00:45
+	// of the previous day are removed
+	assert.NoError(t, logger.cleanupTimeline(testT0.AddDate(0, 0, 1).Add(45*time.Second)))
+	assert.Equal(t, 2, countRows(t, logger, "worker_jobs"))
+	assert.Equal(t, 2, countRows(t, logger, "worker_load_timeline"))
+
+	assert.NoError(t, logger.cleanupTimeline(testT0.AddDate(0, 0, 1).Add(time.Hour)))
+	assert.Equal(t, 0, countRows(t, logger, "worker_jobs"))
+	assert.Equal(t, 0, countRows(t, logger, "worker_load_timeline"))
+}
+
+func TestLoggerWithoutDatabase(t *testing.T) {
+	logger, err := NewWorkerJobLogger(nil, time.UTC)
+	assert.NoError(t, err)
+	logger.Log(testJob("w1", 0, 1, 0, time.Second))
+	logger.Close()
+	load, err := logger.TotalLoad(testT0, testT0.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, load)
+	items, err := logger.LoadTimeline(testT0, testT0.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+}
@@ -1,5 +1,10 @@
 package compiler
 
+import (
+	"errors"
+	"fmt"
+)
+
 type AST interface {
 	Generate() string
 	AddError(err error)
@@ -7,3 +12,60 @@ type AST interface {
 	TranslateWithinCtx(v string) string
 	TranslatePosAttr(qualifier, name string) string
 }
+
+// RewritableAST is implemented by ASTs able to rewrite parts
+// of a query not supported by a searched corpus (e.g. a missing
+// layer). This corresponds to the FCS `x-fcs-rewrites-allowed`
+// argument.
+type RewritableAST interface {
+	AST
+	SetRewritesAllowed(v bool)
+
+	// Rewrites returns human readable descriptions of all the
+	// rewrites applied during the last Generate() call
+	Rewrites() []string
+}
+
+// PrintableAST is implemented by ASTs able to serialize a query
+// back to its source language in a canonical form (normalized
+// whitespace and quoting). Parsing the canonical form yields
+// the same tree so equivalent queries have the same canonical form.
+type PrintableAST interface {
+	AST
+	String() string
+}
+
+// CanonicalQuery returns a canonical form of the query in case
+// the AST supports it (see PrintableAST). Otherwise, the `original`
+// query is returned.
+func CanonicalQuery(ast AST, original string) string {
+	if pAST, ok := ast.(PrintableAST); ok {
+		return pAST.String()
+	}
+	return original
+}
+
+// UnsupportedFeatureError reports a valid query construct which
+// cannot be translated into Manatee CQL or which a searched corpus
+// does not support (e.g. a missing layer). It corresponds to the SRU
+// diagnostic "Query feature unsupported".
+type UnsupportedFeatureError struct {
+
+	// Feature names the construct as written in the query
+	// (e.g. `regexp flag /d`, `within turn`)
+	Feature string
+
+	Reason string
+}
+
+func (err UnsupportedFeatureError) Error() string {
+	return fmt.Sprintf("unsupported query feature %s: %s", err.Feature, err.Reason)
+}
+
+// AsUnsupportedFeature tests whether the error reports
+// an unsupported query feature
+func AsUnsupportedFeature(err error) (UnsupportedFeatureError, bool) {
+	var ans UnsupportedFeatureError
+	ok := errors.As(err, &ans)
+	return ans, ok
+}
@@ -0,0 +1,200 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+)
+
+// Complexity describes properties of a query affecting
+// the cost of its evaluation
+type Complexity struct {
+
+	// SequenceLength is the max. number of tokens in a sequence
+	SequenceLength int
+
+	// QuantifierBound is the highest explicit quantifier bound
+	QuantifierBound int
+
+	// UnboundedQuantifier is set in case the query contains
+	// a quantifier without an upper bound (`*`, `+`, `{n,}`)
+	UnboundedQuantifier bool
+
+	// Alternations is the number of alternations in the query
+	Alternations int
+
+	// LeadingWildcard is set in case a regular expression
+	// can start by matching any character (e.g. `.*ing`, `.?ing`)
+	LeadingWildcard bool
+}
+
+// MeasurableAST is implemented by ASTs able to determine
+// complexity of a query
+type MeasurableAST interface {
+	AST
+	Complexity() Complexity
+}
+
+// ComplexityError reports a query exceeding a complexity limit.
+// It corresponds to the SRU diagnostic "Query too complex".
+type ComplexityError struct {
+
+	// Limit is a name of the exceeded limit (as configured)
+	Limit string
+
+	Reason string
+}
+
+func (err ComplexityError) Error() string {
+	return fmt.Sprintf("query too complex: %s", err.Reason)
+}
+
+// CheckComplexity tests the query against the limits. ASTs not
+// supporting complexity measurement (see MeasurableAST) and nil limits
+// are always accepted. Zero numeric limits are not applied.
+func CheckComplexity(ast AST, limits *corpus.QueryLimits) error {
+	mAST, ok := ast.(MeasurableAST)
+	if !ok || limits == nil {
+		return nil
+	}
+	cmpl := mAST.Complexity()
+	if limits.MaxSequenceLength > 0 && cmpl.SequenceLength > limits.MaxSequenceLength {
+		return ComplexityError{
+			Limit: "maxSequenceLength",
+			Reason: fmt.Sprintf(
+				"sequence of %d tokens exceeds the limit of %d",
+				cmpl.SequenceLength, limits.MaxSequenceLength),
+		}
+	}
+	if limits.MaxQuantifierBound > 0 && cmpl.QuantifierBound > limits.MaxQuantifierBound {
+		return ComplexityError{
+			Limit: "maxQuantifierBound",
+			Reason: fmt.Sprintf(
+				"quantifier bound %d exceeds the limit of %d",
+				cmpl.QuantifierBound, limits.MaxQuantifierBound),
+		}
+	}
+	if limits.DisallowUnboundedQuantifiers && cmpl.UnboundedQuantifier {
+		return ComplexityError{
+			Limit:  "disallowUnboundedQuantifiers",
+			Reason: "quantifiers without an upper bound (`*`, `+`, `{n,}`) are not allowed",
+		}
+	}
+	if limits.MaxAlternations > 0 && cmpl.Alternations > limits.MaxAlternations {
+		return ComplexityError{
+			Limit: "maxAlternations",
+			Reason: fmt.Sprintf(
+				"%d alternations exceed the limit of %d",
+				cmpl.Alternations, limits.MaxAlternations),
+		}
+	}
+	if limits.DisallowLeadingWildcards && cmpl.LeadingWildcard {
+		return ComplexityError{
+			Limit:  "disallowLeadingWildcards",
+			Reason: "regular expressions starting with a wildcard are not allowed",
+		}
+	}
+	return nil
+}
+
+// StartsWithWildcard tests whether a regular expression can start
+// by matching any character (e.g. `.*ing`, `.?.*ing`, `(.|a)ing`).
+// Such expressions cannot use an index and require a scan of the whole
+// lexicon. In case the pattern cannot be parsed, only the leading
+// character is tested.
+func StartsWithWildcard(pattern string) bool {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return strings.HasPrefix(pattern, ".")
+	}
+	return startsWithAny(re.Simplify())
+}
+
+// startsWithAny tests whether the first matched character
+// of the expression can be an arbitrary one
+func startsWithAny(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return true
+	case syntax.OpCharClass:
+		return isWideCharClass(re.Rune)
+	case syntax.OpCapture, syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		return startsWithAny(re.Sub[0])
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if startsWithAny(sub) {
+				return true
+			}
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if startsWithAny(sub) {
+				return true
+			}
+			if !matchesEmpty(sub) {
+				return false
+			}
+		}
+	}
+	return false
+}
+
+// isWideCharClass tests whether a character class covers most of
+// the characters (typically a negated class like `[^a]`)
+func isWideCharClass(ranges []rune) bool {
+	var size int
+	for i := 0; i+1 < len(ranges); i += 2 {
+		size += int(ranges[i+1]-ranges[i]) + 1
+	}
+	return size > unicode.MaxRune/2
+}
+
+// matchesEmpty tests whether the expression can match
+// an empty string
+func matchesEmpty(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpStar, syntax.OpQuest,
+		syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return true
+	case syntax.OpCapture, syntax.OpPlus:
+		return matchesEmpty(re.Sub[0])
+	case syntax.OpRepeat:
+		return re.Min == 0 || matchesEmpty(re.Sub[0])
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if matchesEmpty(sub) {
+				return true
+			}
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !matchesEmpty(sub) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
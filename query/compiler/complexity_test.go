@@ -0,0 +1,103 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/stretchr/testify/assert"
+)
+
+type measuredAST struct {
+	AST
+	complexity Complexity
+}
+
+func (a *measuredAST) Complexity() Complexity {
+	return a.complexity
+}
+
+func TestCheckComplexity(t *testing.T) {
+	limits := &corpus.QueryLimits{
+		MaxSequenceLength:            5,
+		MaxQuantifierBound:           10,
+		MaxAlternations:              3,
+		DisallowUnboundedQuantifiers: true,
+		DisallowLeadingWildcards:     true,
+	}
+	ast := &measuredAST{complexity: Complexity{SequenceLength: 5, QuantifierBound: 10, Alternations: 3}}
+	assert.NoError(t, CheckComplexity(ast, limits))
+	assert.NoError(t, CheckComplexity(&measuredAST{complexity: Complexity{SequenceLength: 6}}, nil))
+
+	var cmplErr ComplexityError
+	err := CheckComplexity(&measuredAST{complexity: Complexity{QuantifierBound: 50}}, limits)
+	if assert.ErrorAs(t, err, &cmplErr) {
+		assert.Equal(t, "maxQuantifierBound", cmplErr.Limit)
+	}
+	err = CheckComplexity(&measuredAST{complexity: Complexity{UnboundedQuantifier: true}}, limits)
+	if assert.ErrorAs(t, err, &cmplErr) {
+		assert.Equal(t, "disallowUnboundedQuantifiers", cmplErr.Limit)
+	}
+	err = CheckComplexity(&measuredAST{complexity: Complexity{LeadingWildcard: true}}, limits)
+	if assert.ErrorAs(t, err, &cmplErr) {
+		assert.Equal(t, "disallowLeadingWildcards", cmplErr.Limit)
+	}
+}
+
+func TestCheckComplexityDefaultLimits(t *testing.T) {
+	limits := &corpus.QueryLimits{}
+	assert.NoError(t, limits.ValidateAndDefaults("queryLimits"))
+	// zero limits are not applied and unbounded quantifiers are allowed
+	ast := &measuredAST{
+		complexity: Complexity{
+			SequenceLength:      1000,
+			QuantifierBound:     1000,
+			UnboundedQuantifier: true,
+			Alternations:        1000,
+			LeadingWildcard:     true,
+		},
+	}
+	assert.NoError(t, CheckComplexity(ast, limits))
+
+	limits.MaxQuantifierBound = 10
+	ast = &measuredAST{complexity: Complexity{QuantifierBound: 3, UnboundedQuantifier: true}}
+	assert.NoError(t, CheckComplexity(ast, limits))
+}
+
+func TestStartsWithWildcard(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		expected bool
+	}{
+		{pattern: `.*ing`, expected: true},
+		{pattern: `.?.*ing`, expected: true},
+		{pattern: `(?:.|a)b`, expected: true},
+		{pattern: `\bx?.+`, expected: true},
+		{pattern: `[^a]b`, expected: true},
+		{pattern: `a.*`, expected: false},
+		{pattern: `[a-z]+ing`, expected: false},
+		{pattern: `(a|b).*`, expected: false},
+		{pattern: `.(`, expected: true},
+		{pattern: `a(`, expected: false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, StartsWithWildcard(tc.pattern), tc.pattern)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxTokenLength limits length of an offending token
+	// reported by SyntaxError
+	maxTokenLength = 30
+)
+
+// SyntaxError describes an invalid query along with
+// a position where parsing failed
+type SyntaxError struct {
+	Query string
+
+	// Line is a 1-based line of the error position
+	Line int
+
+	// Column is a 1-based column (in characters) of the error position
+	Column int
+
+	// Offset is a byte offset of the error position
+	Offset int
+
+	// Token is an offending token found at the error position.
+	// An empty value means the end of the query.
+	Token string
+
+	// Expected contains human readable descriptions
+	// of alternatives expected at the error position
+	Expected []string
+
+	// Reason is used instead of unexpected Token and Expected
+	// alternatives in case the error has a different cause
+	// (e.g. an invalid value of an otherwise valid construct)
+	Reason string
+}
+
+func (err *SyntaxError) Error() string {
+	var ans strings.Builder
+	ans.WriteString(fmt.Sprintf("syntax error at line %d, column %d: ", err.Line, err.Column))
+	if err.Reason != "" {
+		ans.WriteString(err.Reason)
+		return ans.String()
+	}
+	if err.Token == "" {
+		ans.WriteString("unexpected end of query")
+
+	} else {
+		ans.WriteString(fmt.Sprintf("unexpected %s", quoteToken(err.Token)))
+	}
+	if len(err.Expected) > 0 {
+		ans.WriteString(", expected ")
+		ans.WriteString(joinAlternatives(err.Expected))
+	}
+	return ans.String()
+}
+
+// Caret returns the query line containing the error with
+// a caret (`^`) below the error position
+func (err *SyntaxError) Caret() string {
+	return MarkPosition(err.Query, err.Pos())
+}
+
+// Pos returns the error position
+func (err *SyntaxError) Pos() Position {
+	return Position{Line: err.Line, Column: err.Column, Offset: err.Offset}
+}
+
+// NewSyntaxError creates a new syntax error based on a failure
+// of a generated parser. The `expected` values are parser's
+// expectations at the `offset` (i.e. quoted literals, character
+// classes etc.). In case there are no expected values, the `reason`
+// describes the error.
+func NewSyntaxError(query string, offset int, expected []string, reason error) *SyntaxError {
+	if offset > len(query) {
+		offset = len(query)
+	}
+	prefix := query[:offset]
+	lineStart := strings.LastIndex(prefix, "\n") + 1
+	ans := &SyntaxError{
+		Query:  query,
+		Line:   strings.Count(prefix, "\n") + 1,
+		Column: utf8.RuneCountInString(prefix[lineStart:]) + 1,
+		Offset: offset,
+		Token:  tokenAt(query[offset:]),
+	}
+	if len(expected) > 0 {
+		ans.Expected = describeExpected(expected)
+
+	} else if reason != nil {
+		ans.Reason = reason.Error()
+	}
+	return ans
+}
+
+// tokenAt returns a token at the beginning of `s`. A token is either
+// a sequence of letters and digits or a single other character.
+func tokenAt(s string) string {
+	s = strings.SplitN(s, "\n", 2)[0]
+	var ans []rune
+	for _, r := range s {
+		isWordChar := unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-'
+		if len(ans) == 0 {
+			ans = append(ans, r)
+			if !isWordChar {
+				break
+			}
+			continue
+		}
+		if !isWordChar || len(ans) >= maxTokenLength {
+			break
+		}
+		ans = append(ans, r)
+	}
+	return string(ans)
+}
+
+// describeExpected transforms expectations reported by a generated
+// parser into human readable descriptions. Optional whitespace is
+// omitted unless it is the only alternative and alternatives
+// of the same kind (e.g. regexp escape sequences) are merged.
+func describeExpected(expected []string) []string {
+	ans := make([]string, 0, len(expected))
+	used := make(map[string]bool)
+	add := func(v string) {
+		if !used[v] {
+			ans = append(ans, v)
+			used[v] = true
+		}
+	}
+	var whitespace bool
+	for _, item := range expected {
+		switch {
+		case item == "[ ]":
+			whitespace = true
+		case item == "EOF":
+			add("end of query")
+		case item == "[0-9]":
+			add("a digit")
+		case item == "[a-zA-Z]":
+			add("a letter")
+		case strings.HasPrefix(item, "["):
+			add("a character")
+		case strings.HasPrefix(item, `"`):
+			lit, err := strconv.Unquote(item)
+			if err != nil {
+				add(item)
+
+			} else if strings.HasPrefix(lit, `\`) {
+				add("an escape sequence")
+
+			} else {
+				add(quoteToken(lit))
+			}
+		default:
+			add(item)
+		}
+	}
+	if len(ans) == 0 && whitespace {
+		add("a space")
+	}
+	return ans
+}
+
+func quoteToken(v string) string {
+	if strings.Contains(v, `"`) {
+		return "'" + v + "'"
+	}
+	return `"` + v + `"`
+}
+
+func joinAlternatives(items []string) string {
+	if len(items) == 1 {
+		return items[0]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " or " + items[len(items)-1]
+}
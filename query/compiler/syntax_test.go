@@ -0,0 +1,64 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyntaxErrorPosition(t *testing.T) {
+	err := NewSyntaxError("\"a\"\n[wörd=x]", 11, []string{`"'"`, `"\""`, "[ ]"}, nil)
+	assert.Equal(t, 2, err.Line)
+	assert.Equal(t, 7, err.Column)
+	assert.Equal(t, "x", err.Token)
+	assert.Equal(t, []string{`"'"`, `'"'`}, err.Expected)
+	assert.Equal(
+		t,
+		`syntax error at line 2, column 7: unexpected "x", expected "'" or '"'`,
+		err.Error(),
+	)
+	assert.Equal(t, "[wörd=x]\n      ^", err.Caret())
+}
+
+func TestSyntaxErrorEndOfQuery(t *testing.T) {
+	err := NewSyntaxError(`"a"{2`, 5, []string{`","`, `"}"`, "[0-9]", "EOF"}, nil)
+	assert.Equal(t, "", err.Token)
+	assert.Equal(
+		t,
+		`syntax error at line 1, column 6: unexpected end of query, expected ",", "}", a digit or end of query`,
+		err.Error(),
+	)
+}
+
+func TestSyntaxErrorMergesExpected(t *testing.T) {
+	err := NewSyntaxError(`"abc`, 4, []string{`"\\("`, `"\\)"`, "[ ]", "[#%§]", "[,-_^$ ]"}, nil)
+	assert.Equal(t, []string{"an escape sequence", "a character"}, err.Expected)
+
+	err = NewSyntaxError(`[wo rd="x"]`, 3, []string{"[ ]"}, nil)
+	assert.Equal(t, []string{"a space"}, err.Expected)
+}
+
+func TestSyntaxErrorReason(t *testing.T) {
+	err := NewSyntaxError(`[word="x"]`, 1, nil, errors.New("invalid attribute"))
+	assert.Equal(t, "word", err.Token)
+	assert.Equal(t, "syntax error at line 1, column 2: invalid attribute", err.Error())
+}
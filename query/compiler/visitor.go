@@ -0,0 +1,192 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Position is a position of a node within a query
+type Position struct {
+
+	// Line is a 1-based line number
+	Line int
+
+	// Column is a 1-based column (in characters)
+	Column int
+
+	// Offset is a byte offset
+	Offset int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("line %d, column %d", p.Line, p.Column)
+}
+
+// Node is a node of a query abstract syntax tree
+type Node interface {
+
+	// Pos returns a position where the node starts in the query
+	Pos() Position
+
+	// Children returns direct descendants of the node
+	Children() []Node
+}
+
+// BaseNode provides a position within a query. It is intended
+// to be embedded in AST nodes.
+type BaseNode struct {
+	pos Position
+}
+
+func (n BaseNode) Pos() Position {
+	return n.pos
+}
+
+func (n *BaseNode) SetPos(pos Position) {
+	n.pos = pos
+}
+
+// Visitor is called by Walk for each visited node. In case the returned
+// visitor is nil, children of the node are not visited. Otherwise,
+// the returned visitor is used to visit the children.
+type Visitor interface {
+	Visit(node Node) Visitor
+}
+
+// Walk traverses the tree in depth-first order starting with the `node`
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	for _, child := range node.Children() {
+		Walk(v, child)
+	}
+}
+
+// ChildNodes creates a list of child nodes omitting nil values.
+// It is intended for implementations of Node.Children.
+func ChildNodes(nodes ...Node) []Node {
+	ans := make([]Node, 0, len(nodes))
+	for _, n := range nodes {
+		if n == nil {
+			continue
+		}
+		if v := reflect.ValueOf(n); v.Kind() == reflect.Pointer && v.IsNil() {
+			continue
+		}
+		ans = append(ans, n)
+	}
+	return ans
+}
+
+// SemanticError is an error of a syntactically valid query
+// (e.g. a layer not supported by a searched corpus)
+type SemanticError struct {
+	Pos Position
+	Err error
+}
+
+func (err *SemanticError) Error() string {
+	return fmt.Sprintf("%s (at %s)", err.Err, err.Pos)
+}
+
+func (err *SemanticError) Unwrap() error {
+	return err.Err
+}
+
+// SemanticNode is implemented by nodes which can be checked
+// against a context `T` (typically a query along with its
+// corpus configuration)
+type SemanticNode[T any] interface {
+	Node
+	CheckSemantics(ctx T) []error
+}
+
+// semanticValidator is a visitor collecting semantic errors
+// of all the visited nodes
+type semanticValidator[T any] struct {
+	ctx    T
+	errors []error
+}
+
+func (v *semanticValidator[T]) Visit(n Node) Visitor {
+	if sn, ok := n.(SemanticNode[T]); ok {
+		for _, err := range sn.CheckSemantics(v.ctx) {
+			v.errors = append(v.errors, &SemanticError{Pos: n.Pos(), Err: err})
+		}
+	}
+	return v
+}
+
+// ValidateTree walks the tree starting with the `root` and checks
+// all the SemanticNode nodes against the `ctx`. All the returned
+// errors are of the *SemanticError type.
+func ValidateTree[T any](root Node, ctx T) []error {
+	v := &semanticValidator[T]{ctx: ctx}
+	Walk(v, root)
+	return v.errors
+}
+
+// ValidatableAST is implemented by ASTs able to check a query
+// against a corpus configuration without generating a Manatee CQL
+// query. This allows for rejecting invalid queries before they
+// are passed to workers.
+type ValidatableAST interface {
+	AST
+	Node
+
+	// Validate walks the tree and returns all the found errors
+	// (typically of the *SemanticError type)
+	Validate() []error
+}
+
+// ValidateAST validates the `ast` in case it supports validation
+// (see ValidatableAST). Otherwise, nil is returned.
+func ValidateAST(ast AST) []error {
+	if vAST, ok := ast.(ValidatableAST); ok {
+		return vAST.Validate()
+	}
+	return nil
+}
+
+// MarkPosition returns the query line containing the position
+// with a caret (`^`) below the position
+func MarkPosition(query string, pos Position) string {
+	lines := strings.Split(query, "\n")
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return ""
+	}
+	line := lines[pos.Line-1]
+	var pad strings.Builder
+	for i, r := range []rune(line) {
+		if i >= pos.Column-1 {
+			break
+		}
+		if r == '\t' {
+			pad.WriteRune(r)
+
+		} else {
+			pad.WriteRune(' ')
+		}
+	}
+	return fmt.Sprintf("%s\n%s^", line, pad.String())
+}
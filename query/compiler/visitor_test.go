@@ -0,0 +1,95 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testNode struct {
+	children []Node
+}
+
+func (n *testNode) Pos() Position {
+	return Position{Line: 1, Column: 1}
+}
+
+func (n *testNode) Children() []Node {
+	return n.children
+}
+
+func TestChildNodesSkipsNil(t *testing.T) {
+	var nilNode *testNode
+	child := &testNode{}
+	assert.Equal(t, []Node{child}, ChildNodes(nil, nilNode, child))
+}
+
+func TestSemanticErrorUnwrap(t *testing.T) {
+	var err error = &SemanticError{
+		Pos: Position{Line: 1, Column: 4, Offset: 3},
+		Err: UnsupportedFeatureError{Feature: "foo", Reason: "bar"},
+	}
+	featErr, ok := AsUnsupportedFeature(err)
+	assert.True(t, ok)
+	assert.Equal(t, "foo", featErr.Feature)
+	assert.Equal(t, "unsupported query feature foo: bar (at line 1, column 4)", err.Error())
+}
+
+// checkedNode reports itself as invalid in case its name
+// is found among the context's forbidden names
+type checkedNode struct {
+	BaseNode
+	name     string
+	children []Node
+}
+
+func (n *checkedNode) Children() []Node {
+	return n.children
+}
+
+func (n *checkedNode) CheckSemantics(forbidden map[string]bool) []error {
+	if forbidden[n.name] {
+		return []error{errors.New("forbidden " + n.name)}
+	}
+	return nil
+}
+
+func TestValidateTree(t *testing.T) {
+	leaf := &checkedNode{name: "b"}
+	leaf.SetPos(Position{Line: 1, Column: 5, Offset: 4})
+	root := &checkedNode{
+		name:     "a",
+		children: []Node{&testNode{children: []Node{leaf}}, &checkedNode{name: "c"}},
+	}
+	assert.Empty(t, ValidateTree(root, map[string]bool{"x": true}))
+
+	errs := ValidateTree(root, map[string]bool{"a": true, "b": true})
+	if assert.Len(t, errs, 2) {
+		assert.Equal(t, "forbidden a (at line 0, column 0)", errs[0].Error())
+		var semErr *SemanticError
+		assert.ErrorAs(t, errs[1], &semErr)
+		assert.Equal(t, Position{Line: 1, Column: 5, Offset: 4}, semErr.Pos)
+	}
+
+	// nodes checked against a different context type are skipped
+	assert.Empty(t, ValidateTree(root, "a"))
+}
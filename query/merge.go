@@ -0,0 +1,276 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// MergeRoundRobin takes one line from each resource in turn
+	MergeRoundRobin MergeStrategy = "round-robin"
+
+	// MergeSequential takes all the lines of the first resource,
+	// then all the lines of the second one etc.
+	MergeSequential MergeStrategy = "sequential"
+
+	// MergeProportional interleaves lines so that each resource
+	// is represented proportionally to its number of hits
+	MergeProportional MergeStrategy = "proportional"
+
+	DefaultMergeStrategy = MergeRoundRobin
+)
+
+// MergeStrategy specifies how lines from multiple resources
+// are merged into a single result
+type MergeStrategy string
+
+func (ms MergeStrategy) Validate() error {
+	if ms == MergeRoundRobin || ms == MergeSequential || ms == MergeProportional {
+		return nil
+	}
+	return fmt.Errorf("unknown merge strategy: %s", ms)
+}
+
+func (ms MergeStrategy) String() string {
+	return string(ms)
+}
+
+// ----
+
+// MergePlan describes which lines of individual resources
+// are needed to produce a page of a merged result and
+// in which order they are to be taken.
+type MergePlan struct {
+
+	// Ranges contains a line range for each resource (in the order
+	// of the original resource list). The `To` is exclusive and
+	// for resources not involved in the page, From == To.
+	Ranges LineRangeList
+
+	// Order contains resource names for individual lines of the page
+	Order []string
+}
+
+// lineOrder defines a total order of all the lines of all the resources
+// for a merge strategy. Line `i` of resource `r` is denoted as (r, i).
+type lineOrder interface {
+
+	// less compares lines (r1, i) and (r2, j)
+	less(r1, i, r2, j int) bool
+
+	// initialCut returns, for each resource, a number of its lines
+	// which (together) form a prefix of the merged result. The prefix
+	// should be close to the `offset`.
+	initialCut(offset int) []int
+}
+
+// ----
+
+type sequentialOrder struct {
+	sizes []int
+}
+
+func (o sequentialOrder) less(r1, i, r2, j int) bool {
+	if r1 != r2 {
+		return r1 < r2
+	}
+	return i < j
+}
+
+func (o sequentialOrder) initialCut(offset int) []int {
+	ans := make([]int, len(o.sizes))
+	for r, size := range o.sizes {
+		ans[r] = min(size, offset)
+		offset -= ans[r]
+	}
+	return ans
+}
+
+// ----
+
+type roundRobinOrder struct {
+	sizes []int
+}
+
+func (o roundRobinOrder) less(r1, i, r2, j int) bool {
+	if i != j {
+		return i < j
+	}
+	return r1 < r2
+}
+
+// numInRounds returns number of lines contained in the first `rounds` rounds
+func (o roundRobinOrder) numInRounds(rounds int) int {
+	var ans int
+	for _, size := range o.sizes {
+		ans += min(size, rounds)
+	}
+	return ans
+}
+
+func (o roundRobinOrder) initialCut(offset int) []int {
+	var maxSize int
+	for _, size := range o.sizes {
+		maxSize = max(maxSize, size)
+	}
+	// find the last round starting before (or at) the offset
+	rounds := sort.Search(maxSize+1, func(t int) bool {
+		return o.numInRounds(t) > offset
+	}) - 1
+	ans := make([]int, len(o.sizes))
+	for r, size := range o.sizes {
+		ans[r] = min(size, rounds)
+	}
+	return ans
+}
+
+// ----
+
+// proportionalOrder assigns the line (r, i) a position
+// (2i + 1) / (2 * size_r) within the interval (0, 1) and
+// orders lines by the positions (resource order breaks ties).
+type proportionalOrder struct {
+	sizes []int
+	total int
+}
+
+func (o proportionalOrder) less(r1, i, r2, j int) bool {
+	// (2i + 1) / (2 * size_r1) < (2j + 1) / (2 * size_r2)
+	hi1, lo1 := bits.Mul64(uint64(2*i+1), uint64(o.sizes[r2]))
+	hi2, lo2 := bits.Mul64(uint64(2*j+1), uint64(o.sizes[r1]))
+	if hi1 != hi2 {
+		return hi1 < hi2
+	}
+	if lo1 != lo2 {
+		return lo1 < lo2
+	}
+	return r1 < r2
+}
+
+// initialCut selects all the lines with position lower than offset / total
+func (o proportionalOrder) initialCut(offset int) []int {
+	ans := make([]int, len(o.sizes))
+	if o.total == 0 {
+		return ans
+	}
+	for r, size := range o.sizes {
+		// number of i >= 0 such that (2i + 1) * total < 2 * offset * size
+		hi, lo := bits.Mul64(uint64(2*offset), uint64(size))
+		if hi == 0 && lo <= uint64(o.total) {
+			continue
+		}
+		lo, borrow := bits.Sub64(lo, uint64(o.total)+1, 0)
+		hi -= borrow
+		quo, _ := bits.Div64(hi, lo, uint64(2*o.total))
+		ans[r] = min(size, int(quo)+1)
+	}
+	return ans
+}
+
+// ----
+
+func newLineOrder(strategy MergeStrategy, sizes []int) lineOrder {
+	switch strategy {
+	case MergeSequential:
+		return sequentialOrder{sizes: sizes}
+	case MergeProportional:
+		var total int
+		for _, size := range sizes {
+			total += size
+		}
+		return proportionalOrder{sizes: sizes, total: total}
+	default:
+		return roundRobinOrder{sizes: sizes}
+	}
+}
+
+// nextLine returns a resource providing the lowest line not
+// contained in the cut. In case all the lines are in the cut, -1
+// is returned.
+func nextLine(order lineOrder, sizes, cut []int) int {
+	ans := -1
+	for r := range sizes {
+		if cut[r] < sizes[r] && (ans == -1 || order.less(r, cut[r], ans, cut[ans])) {
+			ans = r
+		}
+	}
+	return ans
+}
+
+// lastLine returns a resource providing the highest line contained
+// in the cut. In case the cut is empty, -1 is returned.
+func lastLine(order lineOrder, cut []int) int {
+	ans := -1
+	for r := range cut {
+		if cut[r] > 0 && (ans == -1 || order.less(ans, cut[ans]-1, r, cut[r]-1)) {
+			ans = r
+		}
+	}
+	return ans
+}
+
+// PlanMerge calculates line ranges of individual resources needed
+// to produce a page of a merged result starting at `offset` (zero-based)
+// with at most `limit` lines. The `sizes` argument contains total numbers
+// of lines (concordance sizes) of individual resources from `rscList`.
+// Because the calculation is based on the total sizes, the merged result
+// is stable across pages.
+func PlanMerge(
+	strategy MergeStrategy,
+	rscList []string,
+	sizes []int,
+	offset, limit int,
+) MergePlan {
+	order := newLineOrder(strategy, sizes)
+	cut := order.initialCut(offset)
+	var numCut int
+	for _, v := range cut {
+		numCut += v
+	}
+	for ; numCut > offset; numCut-- {
+		cut[lastLine(order, cut)]--
+	}
+	for ; numCut < offset; numCut++ {
+		r := nextLine(order, sizes, cut)
+		if r == -1 {
+			break
+		}
+		cut[r]++
+	}
+	ans := MergePlan{
+		Ranges: make(LineRangeList, len(rscList)),
+		Order:  make([]string, 0, limit),
+	}
+	for r, rsc := range rscList {
+		ans.Ranges[r] = LineRange{Rsc: rsc, From: cut[r], To: cut[r]}
+	}
+	for len(ans.Order) < limit {
+		r := nextLine(order, sizes, cut)
+		if r == -1 {
+			break
+		}
+		cut[r]++
+		ans.Ranges[r].To++
+		ans.Order = append(ans.Order, rscList[r])
+	}
+	return ans
+}
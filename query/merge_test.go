@@ -0,0 +1,102 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fullOrder produces the whole merged result by sorting all the lines
+func fullOrder(strategy MergeStrategy, rscList []string, sizes []int) []string {
+	type line struct{ r, i int }
+	lines := make([]line, 0, 100)
+	for r, size := range sizes {
+		for i := 0; i < size; i++ {
+			lines = append(lines, line{r, i})
+		}
+	}
+	order := newLineOrder(strategy, sizes)
+	sort.Slice(lines, func(a, b int) bool {
+		return order.less(lines[a].r, lines[a].i, lines[b].r, lines[b].i)
+	})
+	ans := make([]string, len(lines))
+	for k, v := range lines {
+		ans[k] = fmt.Sprintf("%s:%d", rscList[v.r], v.i)
+	}
+	return ans
+}
+
+// planLines turns a plan into a list of lines identified the same way as in fullOrder
+func planLines(plan MergePlan) []string {
+	next := make(map[string]int)
+	for _, rng := range plan.Ranges {
+		next[rng.Rsc] = rng.From
+	}
+	ans := make([]string, len(plan.Order))
+	for k, rsc := range plan.Order {
+		ans[k] = fmt.Sprintf("%s:%d", rsc, next[rsc])
+		next[rsc]++
+	}
+	return ans
+}
+
+func TestPlanMergePagesAreStable(t *testing.T) {
+	rscList := []string{"c1", "c2", "c3"}
+	sizes := []int{7, 0, 23}
+	for _, strategy := range []MergeStrategy{MergeRoundRobin, MergeSequential, MergeProportional} {
+		expected := fullOrder(strategy, rscList, sizes)
+		for offset := 0; offset < 35; offset++ {
+			plan := PlanMerge(strategy, rscList, sizes, offset, 4)
+			to := min(offset+4, len(expected))
+			if offset > len(expected) {
+				assert.Empty(t, plan.Order)
+				continue
+			}
+			assert.Equal(t, expected[offset:to], planLines(plan), "%s, offset %d", strategy, offset)
+		}
+	}
+}
+
+func TestPlanMergeRoundRobin(t *testing.T) {
+	plan := PlanMerge(MergeRoundRobin, []string{"c1", "c2"}, []int{2, 10}, 1, 5)
+	assert.Equal(t, []string{"c2", "c1", "c2", "c2", "c2"}, plan.Order)
+	assert.Equal(t, LineRange{Rsc: "c1", From: 1, To: 2}, plan.Ranges[0])
+	assert.Equal(t, LineRange{Rsc: "c2", From: 0, To: 4}, plan.Ranges[1])
+}
+
+func TestPlanMergeSequential(t *testing.T) {
+	plan := PlanMerge(MergeSequential, []string{"c1", "c2"}, []int{3, 10}, 2, 3)
+	assert.Equal(t, []string{"c1", "c2", "c2"}, plan.Order)
+	assert.Equal(t, LineRange{Rsc: "c1", From: 2, To: 3}, plan.Ranges[0])
+	assert.Equal(t, LineRange{Rsc: "c2", From: 0, To: 2}, plan.Ranges[1])
+}
+
+func TestPlanMergeProportional(t *testing.T) {
+	plan := PlanMerge(MergeProportional, []string{"c1", "c2"}, []int{100, 900}, 0, 10)
+	assert.Equal(t, 1, plan.Ranges[0].To-plan.Ranges[0].From)
+	assert.Equal(t, 9, plan.Ranges[1].To-plan.Ranges[1].From)
+
+	plan = PlanMerge(MergeProportional, []string{"c1", "c2"}, []int{100, 900}, 500, 10)
+	assert.Equal(t, 50, plan.Ranges[0].From)
+	assert.Equal(t, 450, plan.Ranges[1].From)
+}
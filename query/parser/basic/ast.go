@@ -25,9 +25,11 @@ import (
 	"strings"
 
 	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query/compiler"
 )
 
 type Query struct {
+	compiler.BaseNode
 	binaryOperatorQuery *binaryOperatorQuery
 	structureMapping    corpus.StructureMapping
 	posAttrs            []corpus.PosAttr
@@ -122,6 +124,26 @@ func (q *Query) Generate() string {
 	return q.binaryOperatorQuery.Generate(q, false)
 }
 
+// Validate checks the query against the corpus configuration
+// without generating CQL. All the returned errors are of
+// the *compiler.SemanticError type.
+func (q *Query) Validate() []error {
+	return compiler.ValidateTree(q, q)
+}
+
+func (q *Query) Children() []compiler.Node {
+	return compiler.ChildNodes(q.binaryOperatorQuery)
+}
+
+func (q *Query) CheckSemantics(_ *Query) []error {
+	for _, p := range q.posAttrs {
+		if p.IsBasicSearchAttr {
+			return nil
+		}
+	}
+	return []error{errors.New("no attributes configured for the basic search")}
+}
+
 // -----
 
 type binaryOperatorQueryRest struct {
@@ -130,6 +152,7 @@ type binaryOperatorQueryRest struct {
 }
 
 type binaryOperatorQuery struct {
+	compiler.BaseNode
 	nonRecursiveQuery *nonRecursiveQuery
 	rest              []*binaryOperatorQueryRest
 }
@@ -145,6 +168,37 @@ func (boq *binaryOperatorQuery) operatorAt(idx int) string {
 	return ""
 }
 
+func (boq *binaryOperatorQuery) Children() []compiler.Node {
+	ans := compiler.ChildNodes(boq.nonRecursiveQuery)
+	for _, v := range boq.rest {
+		ans = append(ans, compiler.ChildNodes(v.nonRecursiveQuery)...)
+	}
+	return ans
+}
+
+// validate checks that AND and OR operators are not mixed
+// (the translation does not support operator precedence) and
+// that the AND operator can be expressed using sentences
+func (boq *binaryOperatorQuery) CheckSemantics(q *Query) []error {
+	var ans []error
+	for _, v := range boq.rest {
+		if v.operation != boq.operatorAt(0) {
+			ans = append(ans, compiler.UnsupportedFeatureError{
+				Feature: "mixed AND and OR operators",
+				Reason:  "use parentheses to specify the operator precedence",
+			})
+			break
+		}
+	}
+	if boq.operatorAt(0) == "AND" && q.structureMapping.SentenceStruct == "" {
+		ans = append(ans, compiler.UnsupportedFeatureError{
+			Feature: "operator AND",
+			Reason:  "the resource does not define a sentence structure",
+		})
+	}
+	return ans
+}
+
 func (boq *binaryOperatorQuery) Generate(ast *Query, isNegated bool) string {
 	var rest strings.Builder
 	for _, v := range boq.rest {
@@ -183,11 +237,16 @@ func (boq *binaryOperatorQuery) Generate(ast *Query, isNegated bool) string {
 // ----
 
 type nonRecursiveQuery struct {
+	compiler.BaseNode
 	parenthesisExpr *parenthesisExpr
 	term            *term
 	termNegation    bool
 }
 
+func (nrq *nonRecursiveQuery) Children() []compiler.Node {
+	return compiler.ChildNodes(nrq.parenthesisExpr, nrq.term)
+}
+
 func (nrq *nonRecursiveQuery) Generate(ast *Query) string {
 	if nrq.parenthesisExpr != nil {
 		return nrq.parenthesisExpr.Generate(ast)
@@ -202,9 +261,14 @@ func (nrq *nonRecursiveQuery) Generate(ast *Query) string {
 // ----
 
 type parenthesisExpr struct {
+	compiler.BaseNode
 	binaryOperatorQuery *binaryOperatorQuery
 }
 
+func (pe *parenthesisExpr) Children() []compiler.Node {
+	return compiler.ChildNodes(pe.binaryOperatorQuery)
+}
+
 func (pe *parenthesisExpr) Generate(ast *Query) string {
 	// NOTE: We don't need to generate parentheses here
 	// ans the only contained non-terminal is binaryOperatorQuery
@@ -216,10 +280,15 @@ func (pe *parenthesisExpr) Generate(ast *Query) string {
 // ---
 
 type term struct {
+	compiler.BaseNode
 	text       *text
 	quotedText *quotedText
 }
 
+func (t *term) Children() []compiler.Node {
+	return compiler.ChildNodes(t.text, t.quotedText)
+}
+
 func (t *term) Generate(ast *Query, negated bool) string {
 	if t.text != nil {
 		return t.text.Generate(ast, negated)
@@ -234,9 +303,18 @@ func (t *term) Generate(ast *Query, negated bool) string {
 // ----
 
 type quotedText struct {
+	compiler.BaseNode
 	words []*word
 }
 
+func (qt *quotedText) Children() []compiler.Node {
+	ans := make([]compiler.Node, 0, len(qt.words))
+	for _, w := range qt.words {
+		ans = append(ans, compiler.ChildNodes(w)...)
+	}
+	return ans
+}
+
 func (qt *quotedText) Generate(ast *Query, negated bool) string {
 	var ans strings.Builder
 	for _, v := range qt.words {
@@ -252,9 +330,14 @@ func (qt *quotedText) AddWord(w *word) {
 // -----
 
 type text struct {
+	compiler.BaseNode
 	word *word
 }
 
+func (t *text) Children() []compiler.Node {
+	return compiler.ChildNodes(t.word)
+}
+
 func (t *text) Generate(ast *Query, negated bool) string {
 	return ast.getDefaultAttrsExp(t.word.Generate(ast), negated)
 }
@@ -262,9 +345,14 @@ func (t *text) Generate(ast *Query, negated bool) string {
 // ------
 
 type word struct {
+	compiler.BaseNode
 	value string
 }
 
+func (w *word) Children() []compiler.Node {
+	return []compiler.Node{}
+}
+
 func (w *word) Generate(ast *Query) string {
 	tmp := w.value
 	cqlEscapeChar := []string{"\"", "\\"}
@@ -22,6 +22,8 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query/compiler"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -45,3 +47,40 @@ func TestBasicParser(t *testing.T) {
 
 	}
 }
+
+func TestQueryValidate(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{ID: "attr1", Name: "word", Layer: corpus.LayerTypeText, IsBasicSearchAttr: true},
+	}
+	smapping := corpus.StructureMapping{SentenceStruct: "s"}
+
+	q, err := ParseQuery(`cat AND (dog OR mouse)`, posAttrs, smapping)
+	assert.NoError(t, err)
+	assert.Empty(t, q.Validate())
+
+	q, err = ParseQuery(`cat AND dog OR mouse`, posAttrs, smapping)
+	assert.NoError(t, err)
+	errs := q.Validate()
+	if assert.Len(t, errs, 1) {
+		_, ok := compiler.AsUnsupportedFeature(errs[0])
+		assert.True(t, ok)
+	}
+
+	q, err = ParseQuery(`cat OR (dog AND mouse)`, posAttrs, corpus.StructureMapping{})
+	assert.NoError(t, err)
+	errs = q.Validate()
+	var semErr *compiler.SemanticError
+	if assert.Len(t, errs, 1) && assert.ErrorAs(t, errs[0], &semErr) {
+		assert.Equal(t, 9, semErr.Pos.Column)
+	}
+
+	q, err = ParseQuery(`cat`, []corpus.PosAttr{}, smapping)
+	assert.NoError(t, err)
+	assert.Len(t, q.Validate(), 1)
+}
+
+func TestQueryComplexity(t *testing.T) {
+	q, err := ParseQuery(`"grumpy old cat" OR dog OR mouse`, []corpus.PosAttr{}, corpus.StructureMapping{})
+	assert.NoError(t, err)
+	assert.Equal(t, compiler.Complexity{SequenceLength: 3, Alternations: 2}, q.Complexity())
+}
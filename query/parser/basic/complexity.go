@@ -0,0 +1,54 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package basic
+
+import (
+	"github.com/czcorpus/mquery-sru/query/compiler"
+)
+
+// complexityMeter is a visitor determining complexity
+// of a query
+type complexityMeter struct {
+	ans compiler.Complexity
+}
+
+func (cm *complexityMeter) Visit(n compiler.Node) compiler.Visitor {
+	switch tn := n.(type) {
+	case *binaryOperatorQuery:
+		for _, v := range tn.rest {
+			if v.operation == "OR" {
+				cm.ans.Alternations++
+			}
+		}
+	case *quotedText:
+		cm.ans.SequenceLength = max(cm.ans.SequenceLength, len(tn.words))
+	case *text:
+		cm.ans.SequenceLength = max(cm.ans.SequenceLength, 1)
+	}
+	return cm
+}
+
+// Complexity walks the tree and determines the query complexity.
+// Please note that words are always matched literally so there
+// are no quantifiers and wildcards.
+func (q *Query) Complexity() compiler.Complexity {
+	cm := &complexityMeter{}
+	compiler.Walk(cm, q)
+	return cm.ans
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 
 	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query/compiler"
 )
 
 // ParseQuery parses FCS-QL and returns an abstract syntax
@@ -33,7 +34,7 @@ func ParseQuery(
 ) (*Query, error) {
 	ans, err := Parse("query", []byte(q)) // Debug(true))
 	if err != nil {
-		return nil, err
+		return nil, newSyntaxError(q, err)
 	}
 	tAns, ok := ans.(*Query)
 	if !ok {
@@ -44,3 +45,21 @@ func ParseQuery(
 		SetPosAttrs(posAttrs)
 	return tAns, nil
 }
+
+// newSyntaxError transforms the first error reported by the generated
+// parser into a compiler.SyntaxError
+func newSyntaxError(q string, err error) error {
+	if errs, ok := err.(errList); ok && len(errs) > 0 {
+		err = errs[0]
+	}
+	if pErr, ok := err.(*parserError); ok {
+		return compiler.NewSyntaxError(q, pErr.pos.offset, pErr.expected, pErr.Inner)
+	}
+	return err
+}
+
+// nodePos returns a position of the currently matched
+// expression to be attached to an AST node
+func nodePos(c *current) compiler.Position {
+	return compiler.Position{Line: c.pos.line, Column: c.pos.col, Offset: c.pos.offset}
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package basic
+
+import (
+	"strings"
+)
+
+// The String methods serialize the tree back to CQL in a canonical
+// form: terms and operators are separated by single spaces and phrases
+// are double-quoted. Parsing the canonical form yields the same tree
+// (except for node positions).
+
+func (q *Query) String() string {
+	return q.binaryOperatorQuery.String()
+}
+
+func (boq *binaryOperatorQuery) String() string {
+	var ans strings.Builder
+	ans.WriteString(boq.nonRecursiveQuery.String())
+	for _, v := range boq.rest {
+		ans.WriteString(" " + v.operation + " " + v.nonRecursiveQuery.String())
+	}
+	return ans.String()
+}
+
+func (nrq *nonRecursiveQuery) String() string {
+	if nrq.parenthesisExpr != nil {
+		return nrq.parenthesisExpr.String()
+	}
+	if nrq.termNegation {
+		return "NOT " + nrq.term.String()
+	}
+	return nrq.term.String()
+}
+
+func (pe *parenthesisExpr) String() string {
+	return "(" + pe.binaryOperatorQuery.String() + ")"
+}
+
+func (t *term) String() string {
+	if t.text != nil {
+		return t.text.String()
+	}
+	return t.quotedText.String()
+}
+
+func (qt *quotedText) String() string {
+	words := make([]string, len(qt.words))
+	for i, w := range qt.words {
+		words[i] = w.String()
+	}
+	return `"` + strings.Join(words, " ") + `"`
+}
+
+func (t *text) String() string {
+	return t.word.String()
+}
+
+func (w *word) String() string {
+	return w.value
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package basic
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query/compiler"
+	"github.com/stretchr/testify/assert"
+)
+
+// posResetter is used to compare trees regardless of node positions
+type posResetter struct{}
+
+func (pr posResetter) Visit(n compiler.Node) compiler.Visitor {
+	if pn, ok := n.(interface{ SetPos(compiler.Position) }); ok {
+		pn.SetPos(compiler.Position{})
+	}
+	return pr
+}
+
+func parseWithoutPos(t *testing.T, q string) *Query {
+	ans, err := ParseQuery(q, []corpus.PosAttr{}, corpus.StructureMapping{})
+	if !assert.NoError(t, err, q) {
+		return nil
+	}
+	compiler.Walk(posResetter{}, ans)
+	return ans
+}
+
+func TestPrintCanonical(t *testing.T) {
+	cases := map[string]string{
+		`cat`:                           `cat`,
+		"cat  AND\n\tdog":               `cat AND dog`,
+		`"grumpy   cat"`:                `"grumpy cat"`,
+		`NOT   cat OR (dog AND "a  b")`: `NOT cat OR (dog AND "a b")`,
+	}
+	for q, expected := range cases {
+		ast := parseWithoutPos(t, q)
+		if ast != nil {
+			assert.Equal(t, expected, ast.String(), q)
+		}
+	}
+}
+
+// randomQuery generates a random CQL query with random
+// (valid) whitespace
+func randomQuery(rnd *rand.Rand, depth int) string {
+	pick := func(items ...string) string {
+		return items[rnd.Intn(len(items))]
+	}
+	ws := func() string {
+		return strings.Repeat(pick(" ", "\n", "\t"), rnd.Intn(2)+1)
+	}
+	var nrq func(d int) string
+	nrq = func(d int) string {
+		switch n := rnd.Intn(4); {
+		case n == 0 && d > 0:
+			return "(" + randomQuery(rnd, d-1) + ")"
+		case n == 1:
+			return "NOT" + ws() + pick("cat", "dog")
+		case n == 2:
+			return `"` + pick("grumpy", "č") + ws() + pick("cat", "a.b", "x-y") + `"`
+		default:
+			return pick("cat", "dog", "mouse", "1+1", "ž")
+		}
+	}
+	ans := nrq(depth)
+	for i := rnd.Intn(3); i > 0; i-- {
+		ans += ws() + pick("AND", "OR") + ws() + nrq(depth)
+	}
+	return ans
+}
+
+func TestRoundTripRandomQueries(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	for i := 0; i < 500; i++ {
+		q := randomQuery(rnd, 2)
+		ast := parseWithoutPos(t, q)
+		if ast == nil {
+			continue
+		}
+		canonical := ast.String()
+		ast2 := parseWithoutPos(t, canonical)
+		if ast2 == nil {
+			continue
+		}
+		assert.Equal(t, ast, ast2, q)
+		assert.Equal(t, canonical, ast2.String(), q)
+	}
+}
@@ -20,14 +20,18 @@ package fcsql
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/query/compiler"
-
-	"github.com/rs/zerolog/log"
 )
 
+// regexpMetaChars are characters which must be escaped
+// in Manatee regular expressions to match literally
+const regexpMetaChars = `\.^$*+?()[]{}|"`
+
 const (
 	mainQueryOpNone mainQueryOp = iota
 	mainQueryOpSequence
@@ -45,11 +49,14 @@ type beType int
 // ----
 
 type Query struct {
+	compiler.BaseNode
 	mainQuery        *mainQuery
 	within           *withinPart
 	structureMapping corpus.StructureMapping
 	posAttrs         []corpus.PosAttr
 	errors           []error
+	rewritesAllowed  bool
+	rewrites         []string
 }
 
 func (q *Query) SetStructureMapping(m corpus.StructureMapping) *Query {
@@ -62,6 +69,25 @@ func (q *Query) SetPosAttrs(attrs []corpus.PosAttr) *Query {
 	return q
 }
 
+// SetRewritesAllowed enables rewriting of query parts
+// the corpus does not support (instead of reporting errors)
+func (q *Query) SetRewritesAllowed(v bool) {
+	q.rewritesAllowed = v
+}
+
+// Rewrites returns descriptions of all the rewrites applied
+// during the last Generate() call
+func (q *Query) Rewrites() []string {
+	return q.rewrites
+}
+
+func (q *Query) addRewrite(msg string, args ...any) {
+	q.rewrites = append(q.rewrites, fmt.Sprintf(msg, args...))
+}
+
+// TranslateWithinCtx transforms a FCS-QL `within` scope into a corpus
+// structure. In case the corpus does not define the structure, an empty
+// string is returned.
 func (q *Query) TranslateWithinCtx(v string) string {
 	switch v {
 	case "sentence", "s":
@@ -77,31 +103,116 @@ func (q *Query) TranslateWithinCtx(v string) string {
 	case "session":
 		return q.structureMapping.SessionStruct
 	}
-	return "??"
+	return ""
 }
 
 // TranslatePosAttr transforms a FCS-QL attribute specifier (e.g. `text`, `p_tag:pos`)
 // into a real corpus positional attribute.
-// Please note that it also supports `word` alias for the `text` layer
+// Please note that it also supports `word` and `token` aliases for the `text` layer
+// (both are used in the FCS-QL specification examples).
 func (q *Query) TranslatePosAttr(qualifier, name string) string {
+	attr, rewrite, err := q.resolvePosAttr(qualifier, name)
+	if err != nil {
+		q.AddError(err)
+		return ""
+	}
+	if rewrite != "" {
+		q.rewrites = append(q.rewrites, rewrite)
+	}
+	return attr
+}
+
+// resolvePosAttr finds a corpus positional attribute for a FCS-QL
+// attribute specifier. In case the attribute had to be replaced,
+// a description of the rewrite is returned too.
+func (q *Query) resolvePosAttr(qualifier, name string) (string, string, error) {
+	if attr := q.findPosAttr(qualifier, name); attr != "" {
+		return attr, "", nil
+	}
+	if q.rewritesAllowed {
+		if attr, rewrite := q.rewritePosAttr(qualifier, name); attr != "" {
+			return attr, rewrite, nil
+		}
+	}
+	return "", "", compiler.UnsupportedFeatureError{
+		Feature: fmt.Sprintf("layer `%s`", strings.TrimPrefix(qualifier+":"+name, ":")),
+		Reason:  "unknown attribute and/or layer",
+	}
+}
+
+func (q *Query) findPosAttr(qualifier, name string) string {
 	if qualifier != "" {
 		for _, p := range q.posAttrs {
-			if p.Name == qualifier && (string(p.Layer) == name || p.Layer == "text" && name == "word") {
+			if p.Name == qualifier && isLayer(p.Layer, name) {
 				return p.Name
 			}
 		}
 
 	} else {
 		for _, p := range q.posAttrs {
-			if (string(p.Layer) == name || p.Layer == "text" && name == "word") && p.IsLayerDefault {
+			if isLayer(p.Layer, name) && p.IsLayerDefault {
 				return p.Name
 			}
 		}
 	}
-	q.AddError(fmt.Errorf("unknown attribute and/or layer %s:%s", qualifier, name))
 	return ""
 }
 
+// rewritePosAttr tries to find a replacement for an attribute
+// the corpus does not support. First, a possible qualifier is
+// ignored, then "word-like" layers fall back to the text layer.
+// The replacement is returned along with a description of the rewrite.
+func (q *Query) rewritePosAttr(qualifier, name string) (string, string) {
+	if qualifier != "" {
+		if attr := q.findPosAttr("", name); attr != "" {
+			return attr, fmt.Sprintf("attribute `%s:%s` replaced by `%s`", qualifier, name, attr)
+		}
+	}
+	if isWordLikeLayer(name) {
+		if attr := q.findPosAttr("", string(corpus.LayerTypeText)); attr != "" {
+			return attr, fmt.Sprintf("layer `%s` replaced by `%s`", name, attr)
+		}
+	}
+	return "", ""
+}
+
+// canDropAttr tests whether a constraint on an unsupported
+// attribute can be removed from the query
+func (q *Query) canDropAttr(qualifier, name string) bool {
+	return q.rewritesAllowed &&
+		q.findPosAttr(qualifier, name) == "" &&
+		q.findPosAttr("", name) == "" &&
+		!isWordLikeLayer(name) &&
+		q.findPosAttr("", string(corpus.LayerTypeText)) != ""
+}
+
+// dropAttrConstraint returns an expression matching any token
+// which can be used instead of a constraint on an unsupported attribute
+func (q *Query) dropAttrConstraint(qualifier, name string) string {
+	q.addRewrite(
+		"constraint on `%s` removed",
+		strings.TrimPrefix(qualifier+":"+name, ":"),
+	)
+	return fmt.Sprintf(`%s=".*"`, q.findPosAttr("", string(corpus.LayerTypeText)))
+}
+
+// canDropWithin tests whether an unsupported `within` part
+// can be removed from the query
+func (q *Query) canDropWithin() bool {
+	return q.rewritesAllowed && q.TranslateWithinCtx(q.within.value) == ""
+}
+
+// Validate checks the query against the corpus configuration
+// without generating CQL. All the returned errors are of
+// the *compiler.SemanticError type.
+func (q *Query) Validate() []error {
+	return compiler.ValidateTree(q, q)
+}
+
+func (q *Query) Children() []compiler.Node {
+	return compiler.ChildNodes(q.mainQuery, q.within)
+}
+
 func (q *Query) AddError(err error) {
 	q.errors = append(q.errors, err)
 }
@@ -112,12 +223,17 @@ func (q *Query) Errors() []error {
 
 func (q *Query) Generate() string {
 	q.errors = make([]error, 0, 20)
+	q.rewrites = make([]string, 0, 5)
+	if q.within != nil && q.canDropWithin() {
+		q.addRewrite("unsupported `within %s` removed", q.within.value)
+		return q.mainQuery.Generate(q)
+	}
 	if q.within != nil {
-		return fmt.Sprintf(
-			"%s %s",
-			q.mainQuery.Generate(q),
-			q.within.Generate(q),
-		)
+		mq := q.mainQuery.Generate(q)
+		if within := q.within.Generate(q); within != "" {
+			return fmt.Sprintf("%s %s", mq, within)
+		}
+		return mq
 	}
 	return q.mainQuery.Generate(q)
 }
@@ -125,20 +241,61 @@ func (q *Query) Generate() string {
 // ----
 
 type quantifiedQuery struct {
+	compiler.BaseNode
 	basicQuery *basicQuery
 	quantifier string
 }
 
 func (qq *quantifiedQuery) Generate(ast compiler.AST) string {
 	if qq.quantifier != "" {
-		return fmt.Sprintf("%s%s", qq.basicQuery.Generate(ast), qq.quantifier)
+		quant, err := qq.translateQuantifier()
+		if err != nil {
+			ast.AddError(err)
+		}
+		return fmt.Sprintf("%s%s", qq.basicQuery.Generate(ast), quant)
 	}
 	return qq.basicQuery.Generate(ast)
 }
 
+func (qq *quantifiedQuery) Children() []compiler.Node {
+	return compiler.ChildNodes(qq.basicQuery)
+}
+
+func (qq *quantifiedQuery) CheckSemantics(q *Query) []error {
+	if _, err := qq.translateQuantifier(); err != nil {
+		return []error{err}
+	}
+	return nil
+}
+
+// translateQuantifier normalizes ranges as Manatee does not
+// support the `{,m}` form
+func (qq *quantifiedQuery) translateQuantifier() (string, error) {
+	if !strings.HasPrefix(qq.quantifier, "{") {
+		return qq.quantifier, nil
+	}
+	rng := strings.Split(strings.Trim(qq.quantifier, "{}"), ",")
+	if len(rng) == 1 {
+		return qq.quantifier, nil
+	}
+	if rng[0] == "" {
+		rng[0] = "0"
+	}
+	var err error
+	if rng[1] != "" {
+		minVal, err1 := strconv.Atoi(rng[0])
+		maxVal, err2 := strconv.Atoi(rng[1])
+		if err1 != nil || err2 != nil || minVal > maxVal {
+			err = fmt.Errorf("invalid quantifier %s", qq.quantifier)
+		}
+	}
+	return fmt.Sprintf("{%s,%s}", rng[0], rng[1]), err
+}
+
 // -----
 
 type mainQuery struct {
+	compiler.BaseNode
 	quantifiedQuery *quantifiedQuery
 	mainQuery       *mainQuery
 	operator        mainQueryOp
@@ -159,14 +316,23 @@ func (mq *mainQuery) Generate(ast compiler.AST) string {
 	}
 }
 
+func (mq *mainQuery) Children() []compiler.Node {
+	return compiler.ChildNodes(mq.quantifiedQuery, mq.mainQuery)
+}
+
 // -------
 
 type basicExpression struct {
+	compiler.BaseNode
 	attribute     *attribute
 	operator      string
 	expression    *expression
 	flaggedRegexp *flaggedRegexp
 	exprType      beType
+
+	// negated is set for attribute constraints enclosed
+	// by an odd number of negations (`!`)
+	negated bool
 }
 
 func (be *basicExpression) Generate(ast compiler.AST) string {
@@ -176,6 +342,13 @@ func (be *basicExpression) Generate(ast compiler.AST) string {
 	case basicExpressionTypeNot:
 		return fmt.Sprintf("!%s", be.expression.Generate(ast))
 	case basicExpressionTypeAttrOpRegexp:
+		if q, ok := ast.(*Query); ok && q.canDropAttr(be.attribute.name, be.attribute.value) {
+			if be.isNegative() {
+				ast.AddError(be.negativeDropError())
+				return ""
+			}
+			return q.dropAttrConstraint(be.attribute.name, be.attribute.value)
+		}
 		return fmt.Sprintf(
 			"%s%s%s", be.attribute.Generate(ast), be.operator, be.flaggedRegexp.Generate(ast))
 	default:
@@ -183,6 +356,53 @@ func (be *basicExpression) Generate(ast compiler.AST) string {
 	}
 }
 
+func (be *basicExpression) Children() []compiler.Node {
+	return compiler.ChildNodes(be.expression, be.attribute, be.flaggedRegexp)
+}
+
+func (be *basicExpression) CheckSemantics(q *Query) []error {
+	if be.exprType != basicExpressionTypeAttrOpRegexp {
+		return nil
+	}
+	if q.canDropAttr(be.attribute.name, be.attribute.value) {
+		if be.isNegative() {
+			return []error{be.negativeDropError()}
+		}
+		return nil
+	}
+	if _, _, err := q.resolvePosAttr(be.attribute.name, be.attribute.value); err != nil {
+		return []error{err}
+	}
+	return nil
+}
+
+// negate flips polarity of all the attribute constraints
+// within the expression
+func (be *basicExpression) negate() {
+	if be.exprType == basicExpressionTypeAttrOpRegexp {
+		be.negated = !be.negated
+		return
+	}
+	be.expression.negate()
+}
+
+// isNegative tests whether the constraint excludes tokens (i.e. it
+// is negated or it uses the `!=` operator). Removing such a constraint
+// would make the enclosing expression match nothing instead of anything.
+func (be *basicExpression) isNegative() bool {
+	return be.negated != (be.operator == "!=")
+}
+
+func (be *basicExpression) negativeDropError() error {
+	return compiler.UnsupportedFeatureError{
+		Feature: fmt.Sprintf(
+			"layer `%s`",
+			strings.TrimPrefix(be.attribute.name+":"+be.attribute.value, ":"),
+		),
+		Reason: "a negative constraint on an unknown attribute and/or layer cannot be removed",
+	}
+}
+
 // ------
 
 type expressionTailItem struct {
@@ -191,6 +411,7 @@ type expressionTailItem struct {
 }
 
 type expression struct {
+	compiler.BaseNode
 	basicExpression *basicExpression
 	tailValues      []*expressionTailItem
 }
@@ -202,6 +423,15 @@ func (e *expression) AddTailItem(operator string, value *basicExpression) {
 	)
 }
 
+// negate flips polarity of all the attribute constraints
+// within the expression
+func (e *expression) negate() {
+	e.basicExpression.negate()
+	for _, te := range e.tailValues {
+		te.value.negate()
+	}
+}
+
 func (e *expression) Generate(ast compiler.AST) string {
 	if e == nil {
 		return ""
@@ -214,9 +444,18 @@ func (e *expression) Generate(ast compiler.AST) string {
 	return ans.String()
 }
 
+func (e *expression) Children() []compiler.Node {
+	ans := compiler.ChildNodes(e.basicExpression)
+	for _, te := range e.tailValues {
+		ans = append(ans, compiler.ChildNodes(te.value)...)
+	}
+	return ans
+}
+
 // -------
 
 type attribute struct {
+	compiler.BaseNode
 	name  string
 	value string
 }
@@ -225,42 +464,85 @@ func (a *attribute) Generate(ast compiler.AST) string {
 	return ast.TranslatePosAttr(a.name, a.value)
 }
 
+func (a *attribute) Children() []compiler.Node {
+	return []compiler.Node{}
+}
+
 // -------
 
 type regexp struct {
+	compiler.BaseNode
 	quotedString *quotedString
 }
 
-func (r *regexp) WithPrefix(p string) string {
-	return r.quotedString.WithPrefix(p)
-}
-
 func (r *regexp) Generate(ast compiler.AST) string {
 	return r.quotedString.Generate(ast)
 }
 
+func (r *regexp) Children() []compiler.Node {
+	return compiler.ChildNodes(r.quotedString)
+}
+
 // -------
 
 type flaggedRegexp struct {
+	compiler.BaseNode
 	regexp *regexp
 	flags  []string
 }
 
+// Generate translates the regexp along with its flags:
+//   - `i`, `c` (case-insensitive) => the `(?i)` prefix
+//   - `I`, `C` (case-sensitive) => nothing as this is the Manatee default
+//   - `l` (literal matching) => all the regexp special characters are escaped
+//   - `d` (diacritic agnostic matching) is not supported by Manatee
 func (fr *flaggedRegexp) Generate(ast compiler.AST) string {
-	// TODO add support for additional stuff besides case sensitivity
-	var flag string
-	for _, f := range fr.flags {
-		if f == "i" || f == "I" || f == "c" || f == "C" {
-			flag = "(?i)"
+	if len(fr.flags) == 0 {
+		return fr.regexp.Generate(ast)
+	}
+	caseInsensitive, literal, errs := fr.parseFlags()
+	for _, err := range errs {
+		ast.AddError(err)
+	}
+	var prefix string
+	if caseInsensitive {
+		prefix = "(?i)"
+	}
+	return fmt.Sprintf(`"%s%s"`, prefix, fr.regexp.quotedString.Pattern(literal))
+}
+
+func (fr *flaggedRegexp) Children() []compiler.Node {
+	return compiler.ChildNodes(fr.regexp)
+}
 
-		} else {
-			log.Warn().Str("flag", flag).Msg("requested unsupported regexp flag")
+func (fr *flaggedRegexp) CheckSemantics(q *Query) []error {
+	_, _, errs := fr.parseFlags()
+	return errs
+}
+
+// parseFlags determines the matching mode based on flags. Flags
+// not supported by Manatee and conflicting flags are reported as errors.
+func (fr *flaggedRegexp) parseFlags() (caseInsensitive, literal bool, errs []error) {
+	var caseSensitive bool
+	for _, f := range fr.flags {
+		switch f {
+		case "i", "c":
+			caseInsensitive = true
+		case "I", "C":
+			caseSensitive = true
+		case "l":
+			literal = true
+		case "d":
+			errs = append(errs, compiler.UnsupportedFeatureError{
+				Feature: "regexp flag /d",
+				Reason:  "diacritic agnostic matching is not available",
+			})
 		}
 	}
-	if flag != "" {
-		return fr.regexp.WithPrefix(flag)
+	if caseInsensitive && caseSensitive {
+		errs = append(errs, fmt.Errorf("conflicting regexp flags /%s", strings.Join(fr.flags, "")))
 	}
-	return fr.regexp.Generate(ast)
+	return
 }
 
 func (fr *flaggedRegexp) AttachUntypedFlag(v any) error {
@@ -275,26 +557,66 @@ func (fr *flaggedRegexp) AttachUntypedFlag(v any) error {
 // ----
 
 type withinPart struct {
+	compiler.BaseNode
 	value string
 }
 
 func (wp *withinPart) Generate(ast compiler.AST) string {
-	return fmt.Sprintf("within <%s />", ast.TranslateWithinCtx(wp.value))
+	structName := ast.TranslateWithinCtx(wp.value)
+	if structName == "" {
+		ast.AddError(wp.unsupportedError())
+		return ""
+	}
+	return fmt.Sprintf("within <%s />", structName)
+}
+
+func (wp *withinPart) Children() []compiler.Node {
+	return []compiler.Node{}
+}
+
+func (wp *withinPart) CheckSemantics(q *Query) []error {
+	if q.TranslateWithinCtx(wp.value) == "" && !q.canDropWithin() {
+		return []error{wp.unsupportedError()}
+	}
+	return nil
+}
+
+func (wp *withinPart) unsupportedError() error {
+	return compiler.UnsupportedFeatureError{
+		Feature: fmt.Sprintf("`within %s`", wp.value),
+		Reason:  "the resource does not define a respective structure",
+	}
 }
 
 // ----
 
 type implicitQuery struct {
+	compiler.BaseNode
 	flaggedRegexp *flaggedRegexp
 }
 
+// Generate translates the query as a search in the `text` layer
+// (which may differ from the Manatee default attribute)
 func (wp *implicitQuery) Generate(ast compiler.AST) string {
-	return wp.flaggedRegexp.Generate(ast)
+	return fmt.Sprintf(
+		"[%s=%s]", ast.TranslatePosAttr("", string(corpus.LayerTypeText)), wp.flaggedRegexp.Generate(ast))
+}
+
+func (wp *implicitQuery) Children() []compiler.Node {
+	return compiler.ChildNodes(wp.flaggedRegexp)
+}
+
+func (wp *implicitQuery) CheckSemantics(q *Query) []error {
+	if _, _, err := q.resolvePosAttr("", string(corpus.LayerTypeText)); err != nil {
+		return []error{err}
+	}
+	return nil
 }
 
 // ------
 
 type segmentQuery struct {
+	compiler.BaseNode
 	expression *expression
 }
 
@@ -302,9 +624,14 @@ func (wp *segmentQuery) Generate(ast compiler.AST) string {
 	return fmt.Sprintf("[%s]", wp.expression.Generate(ast))
 }
 
+func (wp *segmentQuery) Children() []compiler.Node {
+	return compiler.ChildNodes(wp.expression)
+}
+
 // -------
 
 type basicQuery struct {
+	compiler.BaseNode
 	value any
 }
 
@@ -321,6 +648,13 @@ func (sq *basicQuery) Generate(ast compiler.AST) string {
 	return "??"
 }
 
+func (sq *basicQuery) Children() []compiler.Node {
+	if n, ok := sq.value.(compiler.Node); ok {
+		return compiler.ChildNodes(n)
+	}
+	return []compiler.Node{}
+}
+
 func (sq *basicQuery) GetInnerQuery() *mainQuery {
 	v, ok := sq.value.(*mainQuery)
 	if !ok {
@@ -348,19 +682,59 @@ func (sq *basicQuery) GetSegmentQuery() *segmentQuery {
 // -----
 
 type quotedString struct {
+	compiler.BaseNode
 	value  string
 	regexp string
 }
 
 func (qs *quotedString) Generate(ast compiler.AST) string {
+	return fmt.Sprintf(`"%s"`, qs.Pattern(false))
+}
+
+// Pattern returns the string as a Manatee regular expression
+// (without quotes). Escaped Unicode codepoints (`\xhh`, `\uhhhh`,
+// `\Uhhhhhhhh`) are replaced by respective characters. In case
+// `literal` is true, the string is matched literally.
+func (qs *quotedString) Pattern(literal bool) string {
+	src := qs.value
 	if qs.regexp != "" {
-		return fmt.Sprintf(`"%s"`, qs.regexp)
+		src = qs.regexp
 	}
-	return fmt.Sprintf(`"%s"`, qs.value)
+	var ans strings.Builder
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		if r != '\\' || i+size >= len(src) {
+			writePatternRune(&ans, r, literal)
+			i += size
+			continue
+		}
+		i += size
+		r, size = utf8.DecodeRuneInString(src[i:])
+		if cp, n := decodeCodepoint(src[i:]); n > 0 {
+			writePatternRune(&ans, cp, true)
+			i += n
+			continue
+		}
+		i += size
+		switch {
+		case r == '\'':
+			ans.WriteRune(r)
+		case literal && r == 'n':
+			ans.WriteString(`\n`)
+		case literal && r == 't':
+			ans.WriteString(`\t`)
+		case literal:
+			writePatternRune(&ans, r, true)
+		default:
+			ans.WriteRune('\\')
+			ans.WriteRune(r)
+		}
+	}
+	return ans.String()
 }
 
-func (qs *quotedString) WithPrefix(p string) string {
-	return fmt.Sprintf(`"%s%s"`, p, qs.value)
+func (qs *quotedString) Children() []compiler.Node {
+	return []compiler.Node{}
 }
 
 func (qs *quotedString) Append(s string) {
@@ -369,6 +743,61 @@ func (qs *quotedString) Append(s string) {
 
 // -----
 
+// writePatternRune writes a character to a regular expression. In case
+// `escape` is true, a character with a special meaning is escaped.
+// Double quotes are always escaped as they delimit the expression.
+func writePatternRune(b *strings.Builder, r rune, escape bool) {
+	if r == '"' || escape && strings.ContainsRune(regexpMetaChars, r) {
+		b.WriteRune('\\')
+	}
+	b.WriteRune(r)
+}
+
+// decodeCodepoint decodes an escaped Unicode codepoint
+// (`xhh`, `uhhhh` or `Uhhhhhhhh` - i.e. without the leading backslash)
+// at the beginning of `s`. It returns the codepoint and the number of bytes
+// consumed. In case there is no such codepoint, zero length is returned.
+func decodeCodepoint(s string) (rune, int) {
+	var numDigits int
+	switch {
+	case strings.HasPrefix(s, "x"):
+		numDigits = 2
+	case strings.HasPrefix(s, "u"):
+		numDigits = 4
+	case strings.HasPrefix(s, "U"):
+		numDigits = 8
+	default:
+		return 0, 0
+	}
+	if len(s) < numDigits+1 {
+		return 0, 0
+	}
+	cp, err := strconv.ParseUint(s[1:numDigits+1], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(cp)) {
+		return 0, 0
+	}
+	return rune(cp), numDigits + 1
+}
+
+// isLayer tests whether a corpus layer matches a FCS-QL layer
+// identifier. The `word` and `token` identifiers are considered
+// aliases of the `text` layer.
+func isLayer(layer corpus.LayerType, name string) bool {
+	return string(layer) == name ||
+		layer == corpus.LayerTypeText && (name == "word" || name == "token")
+}
+
+// isWordLikeLayer tests whether a layer contains word forms
+// so it can be substituted by the text layer in case
+// a corpus does not support it
+func isWordLikeLayer(name string) bool {
+	switch corpus.LayerType(name) {
+	case corpus.LayerTypeLemma, corpus.LayerTypeOrth, corpus.LayerTypeNorm, corpus.LayerTypePhonetic:
+		return true
+	}
+	return false
+}
+
 func fromIdxOfUntypedSlice(arr any, idx int) any {
 	if arr == nil {
 		return nil
@@ -0,0 +1,107 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package fcsql
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/czcorpus/mquery-sru/query/compiler"
+)
+
+// complexityMeter is a visitor determining complexity
+// of a query
+type complexityMeter struct {
+	ans compiler.Complexity
+}
+
+func (cm *complexityMeter) Visit(n compiler.Node) compiler.Visitor {
+	switch tn := n.(type) {
+	case *mainQuery:
+		cm.ans.SequenceLength = max(cm.ans.SequenceLength, tn.sequenceLength())
+		if tn.operator == mainQueryOpOr {
+			cm.ans.Alternations++
+		}
+	case *quantifiedQuery:
+		bound, unbounded := tn.quantifierBound()
+		cm.ans.QuantifierBound = max(cm.ans.QuantifierBound, bound)
+		if unbounded {
+			cm.ans.UnboundedQuantifier = true
+		}
+	case *expression:
+		for _, te := range tn.tailValues {
+			if te.operator == "|" {
+				cm.ans.Alternations++
+			}
+		}
+	case *flaggedRegexp:
+		if tn.hasLeadingWildcard() {
+			cm.ans.LeadingWildcard = true
+		}
+	}
+	return cm
+}
+
+// Complexity walks the tree and determines the query complexity
+func (q *Query) Complexity() compiler.Complexity {
+	cm := &complexityMeter{}
+	compiler.Walk(cm, q)
+	return cm.ans
+}
+
+// sequenceLength returns number of tokens in a sequence starting
+// with the query (nested queries count as single tokens)
+func (mq *mainQuery) sequenceLength() int {
+	ans := 1
+	for m := mq; m.operator == mainQueryOpSequence; m = m.mainQuery {
+		ans++
+	}
+	return ans
+}
+
+// quantifierBound returns the highest explicit bound of the
+// quantifier (zero for `?` and no quantifier) and whether
+// the quantifier has no upper bound (`*`, `+`, `{n,}`)
+func (qq *quantifiedQuery) quantifierBound() (bound int, unbounded bool) {
+	switch qq.quantifier {
+	case "":
+		return 0, false
+	case "*", "+":
+		return 0, true
+	case "?":
+		return 0, false
+	}
+	items := strings.Split(strings.Trim(qq.quantifier, "{}"), ",")
+	for _, v := range items {
+		if b, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			bound = max(bound, b)
+		}
+	}
+	unbounded = len(items) > 1 && strings.TrimSpace(items[len(items)-1]) == ""
+	return
+}
+
+// hasLeadingWildcard tests whether the regexp can start
+// by matching any character (e.g. `.*ing`, `.?.*ing`)
+func (fr *flaggedRegexp) hasLeadingWildcard() bool {
+	if _, literal, _ := fr.parseFlags(); literal {
+		return false
+	}
+	return compiler.StartsWithWildcard(fr.regexp.quotedString.Pattern(false))
+}
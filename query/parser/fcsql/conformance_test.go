@@ -0,0 +1,163 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package fcsql
+
+import (
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query/compiler"
+	"github.com/stretchr/testify/assert"
+)
+
+// conformanceCase describes expected handling of a FCS-QL construct.
+// Exactly one of `cql`, `unsupported` and `invalid` is expected to be set.
+type conformanceCase struct {
+	query string
+
+	// cql is an expected translation
+	cql string
+
+	// unsupported is an expected name of an unsupported feature
+	unsupported string
+
+	// invalid means that the query is syntactically valid
+	// but it cannot be processed
+	invalid bool
+}
+
+// conformanceTable is derived from the FCS-QL 2.0 specification
+// examples and the grammar productions
+var conformanceTable = []conformanceCase{
+	// specification examples
+	{query: `"walking"`, cql: `[word="walking"]`},
+	{query: `[token = "walking"]`, cql: `[word="walking"]`},
+	{query: `"Dog" /c`, cql: `[word="(?i)Dog"]`},
+	{query: `[word = "Dog" /c]`, cql: `[word="(?i)Dog"]`},
+	{query: `[pos = "NOUN"]`, cql: `[tag="NOUN"]`},
+	{query: `[pos != "NOUN"]`, cql: `[tag!="NOUN"]`},
+	{query: `[lemma = "walk"]`, cql: `[lemma="walk"]`},
+	{query: `"blaue|grüne" [pos = "NOUN"]`, cql: `[word="blaue|grüne"] [tag="NOUN"]`},
+	{query: `"dogs" []{3,} "cats" within s`, cql: `[word="dogs"] []{3,} [word="cats"] within <s />`},
+	{query: `[z:pos = "ADJ"]`, unsupported: "layer `z:pos`"},
+	{query: `[z:pos = "ADJ" & q:pos = "ADJ"]`, unsupported: "layer `z:pos`"},
+
+	// layers
+	{query: `[text = "walking"]`, cql: `[word="walking"]`},
+	{query: `[ud:pos = "ADJ"]`, cql: `[ud="ADJ"]`},
+	{query: `[orth = "walking"]`, unsupported: "layer `orth`"},
+	{query: `[phonetic = "wo:kin"]`, unsupported: "layer `phonetic`"},
+
+	// expressions
+	{query: `[]`, cql: `[]`},
+	{query: `[word = "a" & pos = "ADJ"]`, cql: `[word="a" & tag="ADJ"]`},
+	{query: `[word = "a" | word = "b"]`, cql: `[word="a" | word="b"]`},
+	{query: `[(word = "a" | word = "b") & pos = "ADJ"]`, cql: `[(word="a" | word="b") & tag="ADJ"]`},
+	{query: `[!word = "a"]`, cql: `[!word="a"]`},
+
+	// sequences, alternatives, grouping
+	{query: `"a" | "b"`, cql: `[word="a"] | [word="b"]`},
+	{query: `("a" "b")`, cql: `([word="a"] [word="b"])`},
+
+	// quantifiers
+	{query: `"a"+`, cql: `[word="a"]+`},
+	{query: `"a"*`, cql: `[word="a"]*`},
+	{query: `"a"?`, cql: `[word="a"]?`},
+	{query: `[]{2}`, cql: `[]{2}`},
+	{query: `[]{2,}`, cql: `[]{2,}`},
+	{query: `[]{,3}`, cql: `[]{0,3}`},
+	{query: `[]{2,3}`, cql: `[]{2,3}`},
+	{query: `("a" "b"){2}`, cql: `([word="a"] [word="b"]){2}`},
+	{query: `[]{3,2}`, invalid: true},
+
+	// regexp flags
+	{query: `"dog" /i`, cql: `[word="(?i)dog"]`},
+	{query: `"dog" /I`, cql: `[word="dog"]`},
+	{query: `"dog" /C`, cql: `[word="dog"]`},
+	{query: `"a.b" /l`, cql: `[word="a\.b"]`},
+	{query: `"a.b" /li`, cql: `[word="(?i)a\.b"]`},
+	{query: `"dog" /d`, unsupported: "regexp flag /d"},
+	{query: `"dog" /iI`, invalid: true},
+
+	// escapes
+	{query: `"\x41b"`, cql: `[word="Ab"]`},
+	{query: `"é"`, cql: `[word="é"]`},
+	{query: `"\U0001F600"`, cql: `[word="😀"]`},
+	{query: `"\x2E"`, cql: `[word="\."]`},
+	{query: `'it\'s'`, cql: `[word="it's"]`},
+	{query: `"a\.b"`, cql: `[word="a\.b"]`},
+	{query: `"a\.b" /l`, cql: `[word="a\.b"]`},
+	{query: `"a\\b" /l`, cql: `[word="a\\b"]`},
+
+	// within scopes
+	{query: `"a" within sentence`, cql: `[word="a"] within <s />`},
+	{query: `"a" within p`, cql: `[word="a"] within <p />`},
+	{query: `"a" within paragraph`, cql: `[word="a"] within <p />`},
+	{query: `"a" within text`, cql: `[word="a"] within <doc />`},
+	{query: `"a" within u`, unsupported: "`within u`"},
+	{query: `"a" within utterance`, unsupported: "`within utterance`"},
+	{query: `"a" within t`, unsupported: "`within t`"},
+	{query: `"a" within turn`, unsupported: "`within turn`"},
+	{query: `"a" within session`, unsupported: "`within session`"},
+}
+
+func TestFCSQLConformance(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{ID: "attr1", Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true},
+		{ID: "attr2", Name: "lemma", Layer: corpus.LayerTypeLemma, IsLayerDefault: true},
+		{ID: "attr3", Name: "tag", Layer: corpus.LayerTypePOS, IsLayerDefault: true},
+		{ID: "attr4", Name: "ud", Layer: corpus.LayerTypePOS},
+	}
+	smapping := corpus.StructureMapping{
+		SentenceStruct:  "s",
+		ParagraphStruct: "p",
+		TextStruct:      "doc",
+	}
+	for _, tc := range conformanceTable {
+		ast, err := ParseQuery(tc.query, posAttrs, smapping)
+		if !assert.NoError(t, err, tc.query) {
+			continue
+		}
+		// validation must report the same problems as generating
+		validationErrs := ast.Validate()
+		cql := ast.Generate()
+		assert.Equal(t, len(ast.Errors()) > 0, len(validationErrs) > 0, tc.query)
+		switch {
+		case tc.unsupported != "":
+			if assert.NotEmpty(t, ast.Errors(), tc.query) {
+				featErr, ok := compiler.AsUnsupportedFeature(ast.Errors()[0])
+				assert.True(t, ok, tc.query)
+				assert.Equal(t, tc.unsupported, featErr.Feature, tc.query)
+			}
+			if assert.NotEmpty(t, validationErrs, tc.query) {
+				featErr, ok := compiler.AsUnsupportedFeature(validationErrs[0])
+				assert.True(t, ok, tc.query)
+				assert.Equal(t, tc.unsupported, featErr.Feature, tc.query)
+			}
+		case tc.invalid:
+			if assert.NotEmpty(t, ast.Errors(), tc.query) {
+				_, ok := compiler.AsUnsupportedFeature(ast.Errors()[0])
+				assert.False(t, ok, tc.query)
+			}
+		default:
+			assert.Empty(t, ast.Errors(), tc.query)
+			assert.Equal(t, tc.cql, cql, tc.query)
+		}
+	}
+}
@@ -22,6 +22,8 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query/compiler"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -51,3 +53,220 @@ func TestFCSQLParser(t *testing.T) {
 
 	}
 }
+
+func TestQueryRewrites(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{ID: "attr1", Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true},
+	}
+	q, err := ParseQuery(`[lemma = "walk" & pos = "NOUN"]`, posAttrs, corpus.StructureMapping{})
+	assert.NoError(t, err)
+	q.Generate()
+	assert.Len(t, q.Errors(), 2)
+
+	q.SetRewritesAllowed(true)
+	ans := q.Generate()
+	assert.Empty(t, q.Errors())
+	assert.Len(t, q.Rewrites(), 2)
+	assert.Contains(t, ans, `word=".*"`)
+	assert.NotContains(t, ans, "lemma")
+}
+
+func TestQueryRewritesNegation(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{ID: "attr1", Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true},
+	}
+	testCases := []struct {
+		query      string
+		refused    bool
+		numRewrite int
+	}{
+		{query: `[!pos = "NOUN"]`, refused: true},
+		{query: `[pos != "X"]`, refused: true},
+		{query: `[word = "a" & !(pos = "X")]`, refused: true},
+		{query: `[word = "a" & !(word = "b" | pos = "X")]`, refused: true},
+		{query: `[!(!pos = "X")]`, numRewrite: 1},
+		{query: `[!(pos != "X")]`, numRewrite: 1},
+		{query: `[!(!(pos != "X"))]`, refused: true},
+		{query: `[word = "a" & pos = "X"]`, numRewrite: 1},
+	}
+	for _, tc := range testCases {
+		q, err := ParseQuery(tc.query, posAttrs, corpus.StructureMapping{})
+		if !assert.NoError(t, err, tc.query) {
+			continue
+		}
+		q.SetRewritesAllowed(true)
+		errs := q.Validate()
+		q.Generate()
+		if tc.refused {
+			assert.Len(t, errs, 1, tc.query)
+			if assert.Len(t, q.Errors(), 1, tc.query) {
+				_, ok := compiler.AsUnsupportedFeature(q.Errors()[0])
+				assert.True(t, ok, tc.query)
+			}
+			assert.Empty(t, q.Rewrites(), tc.query)
+
+		} else {
+			assert.Empty(t, errs, tc.query)
+			assert.Empty(t, q.Errors(), tc.query)
+			assert.Len(t, q.Rewrites(), tc.numRewrite, tc.query)
+		}
+	}
+}
+
+func TestParseQuerySyntaxError(t *testing.T) {
+	_, err := ParseQuery(`[word="x"] within foo`, []corpus.PosAttr{}, corpus.StructureMapping{})
+	var synErr *compiler.SyntaxError
+	if assert.ErrorAs(t, err, &synErr) {
+		assert.Equal(t, 1, synErr.Line)
+		assert.Equal(t, 19, synErr.Column)
+		assert.Equal(t, "foo", synErr.Token)
+		assert.Contains(t, synErr.Expected, `"sentence"`)
+		assert.NotContains(t, synErr.Expected, "[ ]")
+	}
+}
+
+func TestQueryValidate(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{ID: "attr1", Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true},
+	}
+	q, err := ParseQuery(`"a" [z:pos = "ADJ"] within u`, posAttrs, corpus.StructureMapping{})
+	assert.NoError(t, err)
+	errs := q.Validate()
+	if assert.Len(t, errs, 2) {
+		var semErr *compiler.SemanticError
+		if assert.ErrorAs(t, errs[0], &semErr) {
+			assert.Equal(t, compiler.Position{Line: 1, Column: 6, Offset: 5}, semErr.Pos)
+		}
+		if assert.ErrorAs(t, errs[1], &semErr) {
+			assert.Equal(t, compiler.Position{Line: 1, Column: 21, Offset: 20}, semErr.Pos)
+		}
+		featErr, ok := compiler.AsUnsupportedFeature(errs[1])
+		assert.True(t, ok)
+		assert.Equal(t, "`within u`", featErr.Feature)
+	}
+
+	q.SetRewritesAllowed(true)
+	assert.Empty(t, q.Validate())
+}
+
+// nodeCounter is a visitor counting visited nodes
+type nodeCounter struct {
+	numNodes int
+}
+
+func (nc *nodeCounter) Visit(node compiler.Node) compiler.Visitor {
+	nc.numNodes++
+	return nc
+}
+
+func TestWalk(t *testing.T) {
+	q, err := ParseQuery(`[word = "a" & !lemma = "b"]`, []corpus.PosAttr{}, corpus.StructureMapping{})
+	assert.NoError(t, err)
+	nc := &nodeCounter{}
+	compiler.Walk(nc, q)
+	// query, main query, quantified query, basic query, segment query,
+	// expression, 2 x basic expression (attr=value), 2 x attribute,
+	// 2 x flagged regexp, 2 x regexp, 2 x quoted string, basic expression (not),
+	// expression (negated)
+	assert.Equal(t, 18, nc.numNodes)
+}
+
+func TestQueryComplexity(t *testing.T) {
+	q, err := ParseQuery(
+		`"a" []{0,50} ("b" | "c") [word = ".*ing" | word = "x"]`,
+		[]corpus.PosAttr{},
+		corpus.StructureMapping{},
+	)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		compiler.Complexity{
+			SequenceLength:  4,
+			QuantifierBound: 50,
+			Alternations:    2,
+			LeadingWildcard: true,
+		},
+		q.Complexity(),
+	)
+
+	q, err = ParseQuery(`".*ing" /l`, []corpus.PosAttr{}, corpus.StructureMapping{})
+	assert.NoError(t, err)
+	assert.False(t, q.Complexity().LeadingWildcard)
+}
+
+func TestQueryComplexityQuantifiers(t *testing.T) {
+	testCases := []struct {
+		query     string
+		bound     int
+		unbounded bool
+	}{
+		{query: `[]`},
+		{query: `[]?`},
+		{query: `[]*`, unbounded: true},
+		{query: `[]+`, unbounded: true},
+		{query: `[]{1,}`, bound: 1, unbounded: true},
+		{query: `[]{0,50}`, bound: 50},
+		{query: `[]{,7}`, bound: 7},
+		{query: `[]{3}`, bound: 3},
+		{query: `"a" ("b" []{2,})`, bound: 2, unbounded: true},
+	}
+	for _, tc := range testCases {
+		q, err := ParseQuery(tc.query, []corpus.PosAttr{}, corpus.StructureMapping{})
+		if !assert.NoError(t, err, tc.query) {
+			continue
+		}
+		cmpl := q.Complexity()
+		assert.Equal(t, tc.bound, cmpl.QuantifierBound, tc.query)
+		assert.Equal(t, tc.unbounded, cmpl.UnboundedQuantifier, tc.query)
+	}
+}
+
+func TestQueryComplexityDefaultLimits(t *testing.T) {
+	limits := &corpus.QueryLimits{}
+	assert.NoError(t, limits.ValidateAndDefaults("queryLimits"))
+	for _, query := range []string{
+		`[]*`,
+		`[]+`,
+		`"a" []{3,} "b"`,
+		`"dogs" []{3,} "cats" within s`,
+	} {
+		q, err := ParseQuery(query, []corpus.PosAttr{}, corpus.StructureMapping{})
+		if !assert.NoError(t, err, query) {
+			continue
+		}
+		assert.NoError(t, compiler.CheckComplexity(q, limits), query)
+	}
+
+	limits.DisallowUnboundedQuantifiers = true
+	q, err := ParseQuery(`[]+`, []corpus.PosAttr{}, corpus.StructureMapping{})
+	assert.NoError(t, err)
+	var cmplErr compiler.ComplexityError
+	if assert.ErrorAs(t, compiler.CheckComplexity(q, limits), &cmplErr) {
+		assert.Equal(t, "disallowUnboundedQuantifiers", cmplErr.Limit)
+	}
+}
+
+func TestQueryComplexityLeadingWildcard(t *testing.T) {
+	testCases := []struct {
+		query    string
+		wildcard bool
+	}{
+		{query: `".*ing"`, wildcard: true},
+		{query: `".+ing"`, wildcard: true},
+		{query: `".?.*ing"`, wildcard: true},
+		{query: `".ing"`, wildcard: true},
+		{query: `"[^x]ing"`, wildcard: true},
+		{query: `"x?.*ing"`, wildcard: true},
+		{query: `"^.*ing"`, wildcard: true},
+		{query: `"walk.*"`},
+		{query: `"[ab].*"`},
+		{query: `".*ing" /l`},
+	}
+	for _, tc := range testCases {
+		q, err := ParseQuery(tc.query, []corpus.PosAttr{}, corpus.StructureMapping{})
+		if !assert.NoError(t, err, tc.query) {
+			continue
+		}
+		assert.Equal(t, tc.wildcard, q.Complexity().LeadingWildcard, tc.query)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package fcsql
+
+import (
+	"strings"
+)
+
+// The String methods serialize the tree back to FCS-QL in
+// a canonical form: tokens are separated by single spaces (none
+// inside quantifiers and around attribute qualifiers), strings are
+// double-quoted and groups are kept as written. Parsing the canonical
+// form yields the same tree (except for node positions).
+
+func (q *Query) String() string {
+	if q.within != nil {
+		return q.mainQuery.String() + " " + q.within.String()
+	}
+	return q.mainQuery.String()
+}
+
+func (mq *mainQuery) String() string {
+	switch mq.operator {
+	case mainQueryOpSequence:
+		return mq.quantifiedQuery.String() + " " + mq.mainQuery.String()
+	case mainQueryOpOr:
+		return mq.quantifiedQuery.String() + " | " + mq.mainQuery.String()
+	default:
+		return mq.quantifiedQuery.String()
+	}
+}
+
+func (qq *quantifiedQuery) String() string {
+	return qq.basicQuery.String() + qq.quantifier
+}
+
+func (sq *basicQuery) String() string {
+	if sq.GetInnerQuery() != nil {
+		return "(" + sq.GetInnerQuery().String() + ")"
+
+	} else if sq.GetImplicitQuery() != nil {
+		return sq.GetImplicitQuery().String()
+
+	} else if sq.GetSegmentQuery() != nil {
+		return sq.GetSegmentQuery().String()
+	}
+	return ""
+}
+
+func (wp *implicitQuery) String() string {
+	return wp.flaggedRegexp.String()
+}
+
+func (wp *segmentQuery) String() string {
+	if wp.expression == nil {
+		return "[]"
+	}
+	return "[" + wp.expression.String() + "]"
+}
+
+func (e *expression) String() string {
+	var ans strings.Builder
+	ans.WriteString(e.basicExpression.String())
+	for _, te := range e.tailValues {
+		ans.WriteString(" " + te.operator + " " + te.value.String())
+	}
+	return ans.String()
+}
+
+func (be *basicExpression) String() string {
+	switch be.exprType {
+	case basicExpressionTypeGroup:
+		return "(" + be.expression.String() + ")"
+	case basicExpressionTypeNot:
+		return "!" + be.expression.String()
+	case basicExpressionTypeAttrOpRegexp:
+		return be.attribute.String() + " " + be.operator + " " + be.flaggedRegexp.String()
+	default:
+		return ""
+	}
+}
+
+func (a *attribute) String() string {
+	if a.name != "" {
+		return a.name + ":" + a.value
+	}
+	return a.value
+}
+
+func (fr *flaggedRegexp) String() string {
+	if len(fr.flags) == 0 {
+		return fr.regexp.String()
+	}
+	return fr.regexp.String() + " /" + strings.Join(fr.flags, "")
+}
+
+func (r *regexp) String() string {
+	return r.quotedString.String()
+}
+
+// String returns the string in double quotes. Please note that
+// the value keeps escape sequences as written so there is no need
+// to escape anything (an unescaped double quote cannot occur).
+func (qs *quotedString) String() string {
+	if qs.regexp != "" {
+		return `"` + qs.regexp + `"`
+	}
+	return `"` + qs.value + `"`
+}
+
+func (wp *withinPart) String() string {
+	return "within " + wp.value
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package fcsql
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query/compiler"
+	"github.com/stretchr/testify/assert"
+)
+
+// posResetter is used to compare trees regardless of node positions
+type posResetter struct{}
+
+func (pr posResetter) Visit(n compiler.Node) compiler.Visitor {
+	if pn, ok := n.(interface{ SetPos(compiler.Position) }); ok {
+		pn.SetPos(compiler.Position{})
+	}
+	return pr
+}
+
+func parseWithoutPos(t *testing.T, q string) *Query {
+	ans, err := ParseQuery(q, []corpus.PosAttr{}, corpus.StructureMapping{})
+	if !assert.NoError(t, err, q) {
+		return nil
+	}
+	compiler.Walk(posResetter{}, ans)
+	return ans
+}
+
+// assertRoundTrip tests that parsing of the canonical form
+// of the query yields the same tree
+func assertRoundTrip(t *testing.T, q string) {
+	ast := parseWithoutPos(t, q)
+	if ast == nil {
+		return
+	}
+	canonical := ast.String()
+	ast2 := parseWithoutPos(t, canonical)
+	if ast2 == nil {
+		return
+	}
+	assert.Equal(t, ast, ast2, q)
+	assert.Equal(t, canonical, ast2.String(), q)
+}
+
+func TestPrintCanonical(t *testing.T) {
+	cases := map[string]string{
+		`"walking"`:                   `"walking"`,
+		`'it\'s'`:                     `"it\'s"`,
+		`[ word="a"&pos = 'ADJ' ]`:    `[word = "a" & pos = "ADJ"]`,
+		`"a"   "b"  |  "c"`:           `"a" "b" | "c"`,
+		`( "a" "b" ) {2}`:             `("a" "b"){2}`,
+		`[]{,3} within   s`:           `[]{,3} within s`,
+		`"dog"/cl`:                    `"dog" /cl`,
+		`[!(z:pos="ADJ"|lemma!="x")]`: `[!(z:pos = "ADJ" | lemma != "x")]`,
+		`[word = "a.*"]`:              `[word = "a.*"]`,
+		`"a" []  [ ]`:                 `"a" [] []`,
+		`[ (word="foo") ]`:            `[(word = "foo")]`,
+	}
+	for q, expected := range cases {
+		ast := parseWithoutPos(t, q)
+		if ast != nil {
+			assert.Equal(t, expected, ast.String(), q)
+		}
+	}
+}
+
+func TestRoundTripConformanceQueries(t *testing.T) {
+	for _, tc := range conformanceTable {
+		assertRoundTrip(t, tc.query)
+	}
+}
+
+// randomQuery generates a random FCS-QL query with random
+// (valid) whitespace
+func randomQuery(rnd *rand.Rand, depth int) string {
+	ws := func() string {
+		return strings.Repeat(" ", rnd.Intn(3))
+	}
+	pick := func(items ...string) string {
+		return items[rnd.Intn(len(items))]
+	}
+	str := func() string {
+		// (single-quoted strings do not support regexp operators)
+		var v string
+		if rnd.Intn(2) == 0 {
+			v = "'" + pick("a", "dog", "é", "a b", `it\'s`) + "'"
+
+		} else {
+			v = `"` + pick("a", "dog", "é", `x\.y`, "blaue|grüne", "a b", "a.*", `\u00e9`) + `"`
+		}
+		return v + pick("", ws()+"/"+pick("i", "c", "l", "Il"))
+	}
+	var expr func(d int) string
+	expr = func(d int) string {
+		if d > 0 && rnd.Intn(3) == 0 {
+			return "(" + ws() + expr(d-1) + ws() + ")"
+		}
+		if d > 0 && rnd.Intn(4) == 0 {
+			return "!" + expr(d-1)
+		}
+		ans := pick("word", "lemma", "p:pos") + ws() + pick("=", "!=") + ws() + str()
+		if d > 0 && rnd.Intn(3) == 0 {
+			ans += ws() + pick("&", "|") + ws() + expr(d-1)
+		}
+		return ans
+	}
+	var basic func(d int) string
+	basic = func(d int) string {
+		var ans string
+		switch n := rnd.Intn(4); {
+		case n == 0 && d > 0:
+			ans = "(" + ws() + randomQuery(rnd, d-1) + ws() + ")"
+		case n == 1:
+			ans = "[" + ws() + "]"
+		case n == 2:
+			ans = "[" + ws() + expr(d) + ws() + "]"
+		default:
+			ans = str()
+		}
+		if rnd.Intn(3) == 0 {
+			ans += ws() + pick("+", "*", "?", "{2}", "{,3}", "{1,}", "{1,4}")
+		}
+		return ans
+	}
+	ans := basic(depth)
+	for i := rnd.Intn(3); i > 0; i-- {
+		if rnd.Intn(2) == 0 {
+			ans += " " + ws() + basic(depth)
+
+		} else {
+			ans += ws() + "|" + ws() + basic(depth)
+		}
+	}
+	return ans
+}
+
+func TestRoundTripRandomQueries(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	for i := 0; i < 500; i++ {
+		q := randomQuery(rnd, 2)
+		if rnd.Intn(4) == 0 {
+			q += fmt.Sprintf(" within %s", []string{"s", "sentence", "p", "text"}[rnd.Intn(4)])
+		}
+		assertRoundTrip(t, q)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package lexcql
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+)
+
+const (
+	relationEquals    = "="
+	relationExact     = "=="
+	relationIs        = "is"
+	relationExactWord = "exact"
+)
+
+// Query is a root of a LexCQL abstract syntax tree.
+// As each lexical entry is represented by a single token
+// in a searched corpus, the whole query is always translated
+// into a single token Manatee CQL query where individual
+// search clauses become attribute constraints.
+type Query struct {
+	booleanQuery *booleanQuery
+	lexFields    []corpus.LexField
+	errors       []error
+}
+
+func (q *Query) SetLexFields(fields []corpus.LexField) *Query {
+	q.lexFields = fields
+	return q
+}
+
+// TranslateWithinCtx is not supported by LexCQL
+// (there is no structural context within a lexical entry)
+func (q *Query) TranslateWithinCtx(v string) string {
+	q.AddError(fmt.Errorf("within context is not supported in lexical search"))
+	return "??"
+}
+
+// TranslatePosAttr translates a LexCQL index (i.e. a lexical field type
+// with an optional "lex." prefix) into a positional attribute
+// providing the field values. The qualifier is not used.
+func (q *Query) TranslatePosAttr(qualifier, name string) string {
+	lft := corpus.LexFieldType(strings.TrimPrefix(name, "lex."))
+	if name == "" {
+		lft = corpus.DefaultLexFieldType
+	}
+	for _, f := range q.lexFields {
+		if f.Type == lft {
+			return f.Attr
+		}
+	}
+	q.AddError(fmt.Errorf("unsupported index %s", name))
+	return ""
+}
+
+func (q *Query) AddError(err error) {
+	q.errors = append(q.errors, err)
+}
+
+func (q *Query) Errors() []error {
+	return q.errors
+}
+
+func (q *Query) Generate() string {
+	return "[" + q.booleanQuery.Generate(q) + "]"
+}
+
+// ----
+
+type booleanQueryRest struct {
+	operator     string
+	searchClause *searchClause
+}
+
+type booleanQuery struct {
+	searchClause *searchClause
+	rest         []*booleanQueryRest
+}
+
+func (bq *booleanQuery) AddRest(op string, sc *searchClause) {
+	bq.rest = append(bq.rest, &booleanQueryRest{operator: op, searchClause: sc})
+}
+
+// Generate creates a Manatee attribute expression. In CQL, all
+// the boolean operators have the same precedence and they are
+// left-associative so we have to wrap already processed clauses
+// in parentheses.
+func (bq *booleanQuery) Generate(ast *Query) string {
+	ans := bq.searchClause.Generate(ast)
+	for i, v := range bq.rest {
+		if i > 0 {
+			ans = "(" + ans + ")"
+		}
+		switch v.operator {
+		case "and":
+			ans = fmt.Sprintf("%s & %s", ans, v.searchClause.Generate(ast))
+		case "or":
+			ans = fmt.Sprintf("%s | %s", ans, v.searchClause.Generate(ast))
+		case "not":
+			ans = fmt.Sprintf("%s & !(%s)", ans, v.searchClause.Generate(ast))
+		default:
+			ast.AddError(fmt.Errorf("unknown boolean operator %s", v.operator))
+			return "??"
+		}
+	}
+	return ans
+}
+
+// ----
+
+type searchClause struct {
+	booleanQuery *booleanQuery
+	index        string
+	relation     string
+	term         string
+}
+
+func (sc *searchClause) Generate(ast *Query) string {
+	if sc.booleanQuery != nil {
+		return "(" + sc.booleanQuery.Generate(ast) + ")"
+	}
+	attr := ast.TranslatePosAttr("", sc.index)
+	if attr == "" {
+		return "??"
+	}
+	switch strings.ToLower(sc.relation) {
+	case "", relationEquals, relationIs:
+		return fmt.Sprintf(`%s="%s"`, attr, termToRegexp(sc.term, true))
+	case relationExact, relationExactWord:
+		return fmt.Sprintf(`%s="%s"`, attr, termToRegexp(sc.term, false))
+	}
+	ast.AddError(errors.New("unsupported relation " + sc.relation))
+	return "??"
+}
+
+// ----
+
+// termToRegexp converts a CQL search term into a regular expression
+// usable in a Manatee CQL string. With useMasks, the CQL masking
+// characters '*' and '?' are translated into their regexp
+// counterparts. A backslash always makes the following
+// character literal.
+func termToRegexp(term string, useMasks bool) string {
+	var ans strings.Builder
+	escaped := false
+	for _, c := range term {
+		if escaped {
+			ans.WriteString(regexp.QuoteMeta(string(c)))
+			escaped = false
+			continue
+		}
+		switch {
+		case c == '\\':
+			escaped = true
+		case c == '*' && useMasks:
+			ans.WriteString(".*")
+		case c == '?' && useMasks:
+			ans.WriteString(".")
+		default:
+			ans.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return strings.ReplaceAll(ans.String(), `"`, `\"`)
+}
+
+// -----
+
+func fromIdxOfUntypedSlice(arr any, idx int) any {
+	if arr == nil {
+		return nil
+	}
+	v := arr.([]any)
+	return v[idx]
+}
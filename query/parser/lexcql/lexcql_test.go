@@ -0,0 +1,64 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package lexcql
+
+import (
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/stretchr/testify/assert"
+)
+
+var testLexFields = []corpus.LexField{
+	{Type: corpus.LexFieldTypeLemma, Attr: "lemma"},
+	{Type: corpus.LexFieldTypePOS, Attr: "tag"},
+	{Type: corpus.LexFieldTypeDefinition, Attr: "gloss"},
+}
+
+func TestLexCQLParser(t *testing.T) {
+	queries := map[string]string{
+		`walk`:                         `[lemma="walk"]`,
+		`"walk out"`:                   `[lemma="walk out"]`,
+		`lemma = walk`:                 `[lemma="walk"]`,
+		`lex.lemma is "walk"`:          `[lemma="walk"]`,
+		`lemma == "wa*"`:               `[lemma="wa\*"]`,
+		`lemma = wa*`:                  `[lemma="wa.*"]`,
+		`lemma = wa?k AND pos = VERB`:  `[lemma="wa.k" & tag="VERB"]`,
+		`walk OR run NOT pos = NOUN`:   `[(lemma="walk" | lemma="run") & !(tag="NOUN")]`,
+		`definition = "to \"move\""`:   `[gloss="to \"move\""]`,
+		`(walk or run) and pos = VERB`: `[(lemma="walk" | lemma="run") & tag="VERB"]`,
+	}
+	for q, expected := range queries {
+		ast, err := ParseQuery(q, testLexFields)
+		assert.NoError(t, err, q)
+		if ast != nil {
+			assert.Equal(t, expected, ast.Generate(), q)
+			assert.Empty(t, ast.Errors(), q)
+		}
+	}
+}
+
+func TestLexCQLUnsupportedIndex(t *testing.T) {
+	ast, err := ParseQuery(`phonetic = "wɔːk"`, testLexFields)
+	assert.NoError(t, err)
+	if ast != nil {
+		ast.Generate()
+		assert.Len(t, ast.Errors(), 1)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package lexcql
+
+import (
+	"fmt"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query/compiler"
+)
+
+// ParseQuery parses a LexCQL query (a CQL dialect used by LexFCS)
+// and returns an abstract syntax tree which can be used
+// to generate a Manatee CQL query searching for lexical entries.
+func ParseQuery(q string, lexFields []corpus.LexField) (*Query, error) {
+	ans, err := Parse("query", []byte(q)) // Debug(true))
+	if err != nil {
+		return nil, newSyntaxError(q, err)
+	}
+	tAns, ok := ans.(*Query)
+	if !ok {
+		return nil, fmt.Errorf("invalid AST type produced by parser")
+	}
+	tAns.SetLexFields(lexFields)
+	return tAns, nil
+}
+
+// newSyntaxError transforms the first error reported by the generated
+// parser into a compiler.SyntaxError
+func newSyntaxError(q string, err error) error {
+	if errs, ok := err.(errList); ok && len(errs) > 0 {
+		err = errs[0]
+	}
+	if pErr, ok := err.(*parserError); ok {
+		return compiler.NewSyntaxError(q, pErr.pos.offset, pErr.expected, pErr.Inner)
+	}
+	return err
+}
@@ -0,0 +1,290 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	resultCacheKeyPrefix = "mquerysru:conc"
+	resultCacheStatsKey  = "mquerysru:concCacheStats"
+	cacheFieldConcSize   = "concSize"
+	cacheStatsFieldHits  = "hits"
+	cacheStatsFieldMiss  = "misses"
+
+	// concCacheWindowSize specifies how many lines are stored
+	// in a single field of a cached concordance
+	concCacheWindowSize = 100
+)
+
+// CacheStats provides numbers of concordance cache hits and misses
+// as counted by all the workers sharing the Redis database
+type CacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// HitRatio returns the ratio of hits to all cache lookups
+// (or zero if there were no lookups yet)
+func (cs CacheStats) HitRatio() float64 {
+	if cs.Hits+cs.Misses == 0 {
+		return 0
+	}
+	return float64(cs.Hits) / float64(cs.Hits+cs.Misses)
+}
+
+// concCacheKey creates a key identifying a concordance regardless
+// of a requested range of lines. All the windows of lines of
+// a concordance are stored as fields of a single Redis hash so they
+// share the concordance size and expire together.
+func concCacheKey(args ConcQueryArgs) string {
+	ident, _ := json.Marshal(
+		[]any{
+			args.CorpusPath,
+			args.Query,
+			args.Attrs,
+			args.MaxContext,
+			args.ViewContextStruct,
+			args.SampleSize,
+			args.SampleSeed,
+		},
+	)
+	sum := sha1.Sum(ident)
+	return fmt.Sprintf("%s:%s", resultCacheKeyPrefix, hex.EncodeToString(sum[:]))
+}
+
+func concCacheWindowField(idx int) string {
+	return fmt.Sprintf("lines:%d", idx)
+}
+
+// concCacheWindows returns indices of the first and the last
+// window containing lines requested by `args`
+func concCacheWindows(args ConcQueryArgs) (first, last int) {
+	first = args.StartLine / concCacheWindowSize
+	last = first
+	if args.MaxItems > 0 {
+		last = (args.StartLine + args.MaxItems - 1) / concCacheWindowSize
+	}
+	return
+}
+
+// CacheWindow extends the range of lines requested by `args`
+// to whole cache windows. To make following pages of a concordance
+// available in the cache, workers should search for the extended
+// range, store the result and then select the requested lines
+// using SliceCacheWindow. Requests for the concordance size only
+// (MaxItems == 0) are left unchanged.
+func CacheWindow(args ConcQueryArgs) ConcQueryArgs {
+	if args.MaxItems == 0 {
+		return args
+	}
+	first, last := concCacheWindows(args)
+	args.StartLine = first * concCacheWindowSize
+	args.MaxItems = (last - first + 1) * concCacheWindowSize
+	return args
+}
+
+// SliceCacheWindow selects lines requested by `args` from a result
+// obtained for CacheWindow(args). In case the requested lines are out
+// of the concordance, the result contains ErrRowsRangeOutOfConc.
+func SliceCacheWindow(args ConcQueryArgs, res *result.ConcResult) *result.ConcResult {
+	ans := *res
+	if ans.Error != nil {
+		return &ans
+	}
+	if args.StartLine > ans.ConcSize {
+		ans.Lines = []concordance.Line{}
+		ans.Error = mango.ErrRowsRangeOutOfConc
+		return &ans
+	}
+	offset := min(args.StartLine-CacheWindow(args).StartLine, len(ans.Lines))
+	ans.Lines = ans.Lines[offset:min(offset+args.MaxItems, len(ans.Lines))]
+	return &ans
+}
+
+// ResultCacheEnabled tells whether concordance results
+// should be cached.
+func (a *Adapter) ResultCacheEnabled() bool {
+	return a.resultCacheTTL > 0
+}
+
+// GetCachedConc looks for stored lines of a concordance matching
+// provided args. The lines can come from a search for a different page
+// of the same concordance as long as all the windows (see CacheWindow)
+// covering the requested range are stored. In case nothing is found,
+// nil is returned. Requests for the concordance size only (MaxItems == 0)
+// are served without any lines. If only the concordance size is known and the requested
+// lines are out of the concordance, a result with ErrRowsRangeOutOfConc
+// is returned (the same way a worker would return it).
+func (a *Adapter) GetCachedConc(args ConcQueryArgs) (*result.ConcResult, error) {
+	if !a.ResultCacheEnabled() {
+		return nil, nil
+	}
+	first, last := concCacheWindows(args)
+	fields := []string{cacheFieldConcSize}
+	if args.MaxItems > 0 {
+		for i := first; i <= last; i++ {
+			fields = append(fields, concCacheWindowField(i))
+		}
+	}
+	vals, err := a.redis.HMGet(a.ctx, concCacheKey(args), fields...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached concordance: %w", err)
+	}
+	var ans *result.ConcResult
+	if rawSize, ok := vals[0].(string); ok {
+		concSize, err := strconv.Atoi(rawSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cached concordance: %w", err)
+		}
+		if args.StartLine > concSize {
+			ans = &result.ConcResult{
+				Lines:    []concordance.Line{},
+				ConcSize: concSize,
+				Query:    args.Query,
+				Error:    mango.ErrRowsRangeOutOfConc,
+				CacheHit: true,
+			}
+
+		} else {
+			lines, err := decodeCacheWindows(first, concSize, vals[1:])
+			if err != nil {
+				return nil, err
+			}
+			if lines != nil {
+				ans = SliceCacheWindow(
+					args,
+					&result.ConcResult{
+						Lines:    lines,
+						ConcSize: concSize,
+						Query:    args.Query,
+						CacheHit: true,
+					},
+				)
+			}
+		}
+	}
+	statsField := cacheStatsFieldMiss
+	if ans != nil {
+		statsField = cacheStatsFieldHits
+	}
+	if err := a.redis.HIncrBy(a.ctx, resultCacheStatsKey, statsField, 1).Err(); err != nil {
+		return ans, fmt.Errorf("failed to update concordance cache stats: %w", err)
+	}
+	return ans, nil
+}
+
+// decodeCacheWindows joins lines of cached windows starting with
+// the `first` one. Windows past the end of the concordance are never
+// stored so they are ignored. In case any of the other windows is
+// missing, nil is returned.
+func decodeCacheWindows(first, concSize int, rawWindows []any) ([]concordance.Line, error) {
+	ans := make([]concordance.Line, 0, len(rawWindows)*concCacheWindowSize)
+	for i, v := range rawWindows {
+		if (first+i)*concCacheWindowSize >= concSize {
+			break
+		}
+		rawLines, ok := v.(string)
+		if !ok {
+			return nil, nil
+		}
+		var lines []concordance.Line
+		dec := gob.NewDecoder(bytes.NewBufferString(rawLines))
+		if err := dec.Decode(&lines); err != nil {
+			return nil, fmt.Errorf("failed to decode cached concordance: %w", err)
+		}
+		ans = append(ans, lines...)
+	}
+	return ans, nil
+}
+
+// StoreConcToCache stores lines of a concordance split into windows
+// along with the concordance size. The `args` are expected to be
+// extended by CacheWindow, lines of a range not aligned to windows
+// are not stored. Only complete windows (or the last window
+// of a concordance) are stored. Results with errors are not stored
+// except for ErrRowsRangeOutOfConc where at least the concordance
+// size is stored. For requests of the concordance size only
+// (MaxItems == 0), just the size is stored.
+func (a *Adapter) StoreConcToCache(args ConcQueryArgs, res *result.ConcResult) error {
+	if !a.ResultCacheEnabled() {
+		return nil
+	}
+	values := []any{cacheFieldConcSize, res.ConcSize}
+	if res.Error != nil {
+		if !errors.Is(res.Error, mango.ErrRowsRangeOutOfConc) {
+			return nil
+		}
+
+	} else if args.MaxItems > 0 && args.StartLine%concCacheWindowSize == 0 {
+		first := args.StartLine / concCacheWindowSize
+		for i := 0; i*concCacheWindowSize < len(res.Lines); i++ {
+			window := res.Lines[i*concCacheWindowSize : min((i+1)*concCacheWindowSize, len(res.Lines))]
+			windowEnd := args.StartLine + i*concCacheWindowSize + len(window)
+			if len(window) < concCacheWindowSize && windowEnd != res.ConcSize {
+				break
+			}
+			var buff bytes.Buffer
+			enc := gob.NewEncoder(&buff)
+			if err := enc.Encode(window); err != nil {
+				return fmt.Errorf("failed to store concordance to cache: %w", err)
+			}
+			values = append(values, concCacheWindowField(first+i), buff.String())
+		}
+	}
+	key := concCacheKey(args)
+	_, err := a.redis.TxPipelined(a.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(a.ctx, key, values...)
+		pipe.Expire(a.ctx, key, a.resultCacheTTL)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store concordance to cache: %w", err)
+	}
+	return nil
+}
+
+// ResultCacheStats returns current concordance cache statistics
+func (a *Adapter) ResultCacheStats() (CacheStats, error) {
+	vals, err := a.redis.HGetAll(a.ctx, resultCacheStatsKey).Result()
+	if err != nil {
+		return CacheStats{}, fmt.Errorf("failed to get concordance cache stats: %w", err)
+	}
+	var ans CacheStats
+	if v, ok := vals[cacheStatsFieldHits]; ok {
+		ans.Hits, _ = strconv.ParseInt(v, 10, 64)
+	}
+	if v, ok := vals[cacheStatsFieldMiss]; ok {
+		ans.Misses, _ = strconv.ParseInt(v, 10, 64)
+	}
+	return ans, nil
+}
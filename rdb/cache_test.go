@@ -0,0 +1,214 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcCacheKeyIgnoresLinesRange(t *testing.T) {
+	args := ConcQueryArgs{
+		CorpusPath: "/var/lib/manatee/registry/syn2020",
+		Query:      `[word="test"]`,
+		Attrs:      []string{"word", "lemma", "word"},
+		MaxItems:   50,
+		StartLine:  0,
+	}
+	args2 := args
+	args2.StartLine = 50
+	args2.MaxItems = 20
+	assert.Equal(t, concCacheKey(args), concCacheKey(args2))
+}
+
+func TestConcCacheKeyDiffersByQueryAndSample(t *testing.T) {
+	args := ConcQueryArgs{
+		CorpusPath: "/var/lib/manatee/registry/syn2020",
+		Query:      `[word="test"]`,
+		Attrs:      []string{"word", "lemma", "word"},
+	}
+	args2 := args
+	args2.Query = `[word="tests"]`
+	args3 := args
+	args3.SampleSize = 100
+	assert.NotEqual(t, concCacheKey(args), concCacheKey(args2))
+	assert.NotEqual(t, concCacheKey(args), concCacheKey(args3))
+}
+
+func TestCacheStatsHitRatio(t *testing.T) {
+	assert.Equal(t, 0.0, CacheStats{}.HitRatio())
+	assert.Equal(t, 0.75, CacheStats{Hits: 3, Misses: 1}.HitRatio())
+}
+
+func TestCacheWindow(t *testing.T) {
+	testCases := []struct {
+		startLine, maxItems int
+		expStart, expMax    int
+	}{
+		{startLine: 0, maxItems: 10, expStart: 0, expMax: 100},
+		{startLine: 10, maxItems: 10, expStart: 0, expMax: 100},
+		{startLine: 95, maxItems: 10, expStart: 0, expMax: 200},
+		{startLine: 100, maxItems: 100, expStart: 100, expMax: 100},
+		{startLine: 250, maxItems: 1, expStart: 200, expMax: 100},
+		{startLine: 0, maxItems: 0, expStart: 0, expMax: 0},
+	}
+	for _, tc := range testCases {
+		w := CacheWindow(ConcQueryArgs{StartLine: tc.startLine, MaxItems: tc.maxItems})
+		assert.Equal(t, tc.expStart, w.StartLine, "startLine %d", tc.startLine)
+		assert.Equal(t, tc.expMax, w.MaxItems, "startLine %d", tc.startLine)
+	}
+}
+
+// searchWindow emulates a worker searching for a cache window
+// of a concordance with `concSize` lines
+func searchWindow(args ConcQueryArgs, concSize int) *result.ConcResult {
+	ans := &result.ConcResult{ConcSize: concSize, Query: args.Query, Lines: []concordance.Line{}}
+	if args.StartLine > concSize {
+		ans.Error = mango.ErrRowsRangeOutOfConc
+		return ans
+	}
+	for i := args.StartLine; i < min(args.StartLine+args.MaxItems, concSize); i++ {
+		ans.Lines = append(ans.Lines, concordance.Line{Ref: fmt.Sprintf("#%d", i)})
+	}
+	return ans
+}
+
+func TestConcCacheServesNextPage(t *testing.T) {
+	adapter, _ := newFakeRedisAdapter(t)
+	page1 := ConcQueryArgs{
+		CorpusPath: "/var/lib/manatee/registry/syn2020",
+		Query:      `[word="test"]`,
+		Attrs:      []string{"word", "word"},
+		StartLine:  0,
+		MaxItems:   10,
+	}
+	cached, err := adapter.GetCachedConc(page1)
+	assert.NoError(t, err)
+	assert.Nil(t, cached)
+
+	window := CacheWindow(page1)
+	assert.NoError(t, adapter.StoreConcToCache(window, searchWindow(window, 250)))
+
+	page2 := page1
+	page2.StartLine = 10
+	cached, err = adapter.GetCachedConc(page2)
+	assert.NoError(t, err)
+	if assert.NotNil(t, cached) {
+		assert.True(t, cached.CacheHit)
+		assert.Equal(t, 250, cached.ConcSize)
+		if assert.Len(t, cached.Lines, 10) {
+			assert.Equal(t, "#10", cached.Lines[0].Ref)
+			assert.Equal(t, "#19", cached.Lines[9].Ref)
+		}
+	}
+
+	// a page crossing the window boundary needs the next window
+	page3 := page1
+	page3.StartLine = 95
+	cached, err = adapter.GetCachedConc(page3)
+	assert.NoError(t, err)
+	assert.Nil(t, cached)
+
+	stats, err := adapter.ResultCacheStats()
+	assert.NoError(t, err)
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 2}, stats)
+}
+
+func TestConcCacheLastWindow(t *testing.T) {
+	adapter, _ := newFakeRedisAdapter(t)
+	args := ConcQueryArgs{Query: `[word="test"]`, StartLine: 120, MaxItems: 20}
+	window := CacheWindow(args)
+	assert.NoError(t, adapter.StoreConcToCache(window, searchWindow(window, 130)))
+
+	// the last window of the concordance is shorter
+	args.StartLine = 110
+	cached, err := adapter.GetCachedConc(args)
+	assert.NoError(t, err)
+	if assert.NotNil(t, cached) {
+		assert.Len(t, cached.Lines, 20)
+	}
+	args.StartLine = 125
+	cached, err = adapter.GetCachedConc(args)
+	assert.NoError(t, err)
+	if assert.NotNil(t, cached) {
+		assert.Len(t, cached.Lines, 5)
+	}
+	args.StartLine = 140
+	cached, err = adapter.GetCachedConc(args)
+	assert.NoError(t, err)
+	if assert.NotNil(t, cached) {
+		assert.ErrorIs(t, cached.Error, mango.ErrRowsRangeOutOfConc)
+	}
+	// the previous window has not been stored
+	args.StartLine = 90
+	cached, err = adapter.GetCachedConc(args)
+	assert.NoError(t, err)
+	assert.Nil(t, cached)
+}
+
+func TestSliceCacheWindow(t *testing.T) {
+	args := ConcQueryArgs{StartLine: 105, MaxItems: 10}
+	window := CacheWindow(args)
+	ans := SliceCacheWindow(args, searchWindow(window, 150))
+	assert.NoError(t, ans.Error)
+	if assert.Len(t, ans.Lines, 10) {
+		assert.Equal(t, "#105", ans.Lines[0].Ref)
+	}
+	args.StartLine = 160
+	ans = SliceCacheWindow(args, searchWindow(CacheWindow(args), 150))
+	assert.ErrorIs(t, ans.Error, mango.ErrRowsRangeOutOfConc)
+	assert.Empty(t, ans.Lines)
+}
+
+func TestConcCacheSizeOnly(t *testing.T) {
+	adapter, _ := newFakeRedisAdapter(t)
+	args := ConcQueryArgs{Query: `[word="test"]`, StartLine: 0, MaxItems: 0}
+	window := CacheWindow(args)
+	assert.Equal(t, args, window)
+	assert.NoError(t, adapter.StoreConcToCache(window, searchWindow(window, 250)))
+
+	cached, err := adapter.GetCachedConc(args)
+	assert.NoError(t, err)
+	if assert.NotNil(t, cached) {
+		assert.NoError(t, cached.Error)
+		assert.Equal(t, 250, cached.ConcSize)
+		assert.Empty(t, cached.Lines)
+	}
+	// no lines have been stored
+	page := args
+	page.MaxItems = 10
+	cached, err = adapter.GetCachedConc(page)
+	assert.NoError(t, err)
+	assert.Nil(t, cached)
+
+	// the size is served without lines even if lines are cached
+	window = CacheWindow(page)
+	assert.NoError(t, adapter.StoreConcToCache(window, searchWindow(window, 250)))
+	cached, err = adapter.GetCachedConc(args)
+	assert.NoError(t, err)
+	if assert.NotNil(t, cached) {
+		assert.Equal(t, 250, cached.ConcSize)
+		assert.Empty(t, cached.Lines)
+	}
+}
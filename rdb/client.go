@@ -25,8 +25,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/czcorpus/mquery-sru/metrics"
 	"github.com/czcorpus/mquery-sru/result"
 
 	"github.com/google/uuid"
@@ -42,16 +47,86 @@ const (
 	DefaultQueryChannel        = "mqueryQueries"
 	DefaultResultExpiration    = 10 * time.Minute
 	DefaultQueryAnswerTimeout  = 60 * time.Second
+
+	FuncConcExample = "concExample"
+	FuncAttrValues  = "attrValues"
 )
 
 var (
-	ErrorEmptyQueue = errors.New("no queries in the queue")
+	ErrorEmptyQueue   = errors.New("no queries in the queue")
+	ErrQueryCancelled = errors.New("query cancelled")
+
+	ErrQueueStatsNotAvailable = errors.New("queue statistics not available for the streams backend")
 )
 
+// enqueueScript adds a query to a client's queue within a lane and
+// (if needed) adds the client to the lane's round-robin ring.
+// It also registers the lane weight so consumers need no scheduling
+// configuration.
+var enqueueScript = redis.NewScript(`
+redis.call('LPUSH', KEYS[1], ARGV[1])
+if redis.call('LLEN', KEYS[1]) == 1 then
+	redis.call('LPUSH', KEYS[2], ARGV[2])
+end
+redis.call('HSET', KEYS[3], ARGV[3], ARGV[4])
+return 1
+`)
+
+// dequeueScript takes a query from the first non-empty lane (KEYS contain
+// the lanes' rings, ARGV the respective client queue key prefixes).
+// The ring is rotated so the next call serves another client.
+var dequeueScript = redis.NewScript(`
+for i, ring in ipairs(KEYS) do
+	for j = 1, redis.call('LLEN', ring) do
+		local client = redis.call('RPOPLPUSH', ring, ring)
+		local qkey = ARGV[i] .. client
+		local msg = redis.call('RPOP', qkey)
+		if redis.call('LLEN', qkey) == 0 then
+			redis.call('LREM', ring, 0, client)
+		end
+		if msg then
+			return msg
+		end
+	end
+end
+return false
+`)
+
+// withdrawScript removes a query from a client's queue and removes
+// the client from the lane's ring in case there are no more queries.
+var withdrawScript = redis.NewScript(`
+redis.call('LREM', KEYS[1], 1, ARGV[1])
+if redis.call('LLEN', KEYS[1]) == 0 then
+	redis.call('LREM', KEYS[2], 0, ARGV[2])
+end
+return 1
+`)
+
+func laneWeightsKey() string {
+	return DefaultQueueKey + ":lanes"
+}
+
+func laneRingKey(lane string) string {
+	return fmt.Sprintf("%s:%s:ring", DefaultQueueKey, lane)
+}
+
+func laneQueueKeyPrefix(lane string) string {
+	return fmt.Sprintf("%s:%s:q:", DefaultQueueKey, lane)
+}
+
+// Query is a job description passed to workers.
+// The `Args` value depends on `Func` - for FuncConcExample
+// it is ConcQueryArgs, for FuncAttrValues it is AttrValuesQueryArgs.
+// (note: both types must be registered via gob.Register)
 type Query struct {
-	Channel string        `json:"channel"`
-	Func    string        `json:"func"`
-	Args    ConcQueryArgs `json:"args"`
+	Channel string `json:"channel"`
+	Func    string `json:"func"`
+	Args    any    `json:"args"`
+
+	// Lane and ClientID are used for scheduling of queued
+	// queries (see SchedulingConf)
+	Lane     string `json:"lane"`
+	ClientID string `json:"clientId"`
 }
 
 type ConcQueryArgs struct {
@@ -62,6 +137,23 @@ type ConcQueryArgs struct {
 	StartLine         int      `json:"startLine"`
 	MaxContext        int      `json:"maxContext"`
 	ViewContextStruct string   `json:"viewContextStruct"`
+
+	// SampleSize, if greater than zero, specifies a random sample
+	// of the concordance the lines are taken from
+	SampleSize int   `json:"sampleSize"`
+	SampleSeed int64 `json:"sampleSeed"`
+
+	// NoCache makes workers bypass the result cache
+	// (e.g. for health check queries)
+	NoCache bool `json:"noCache"`
+}
+
+type AttrValuesQueryArgs struct {
+	CorpusPath string `json:"corpusPath"`
+	Attr       string `json:"attr"`
+	FromValue  string `json:"fromValue"`
+	NumBefore  int    `json:"numBefore"`
+	NumAfter   int    `json:"numAfter"`
 }
 
 func (q Query) ToJSON() (string, error) {
@@ -100,6 +192,12 @@ func (err *TransmittedError) Error() string {
 	return fmt.Sprintf("TransmittedError(%s: %s)", err.Type, err.Message)
 }
 
+// Is allows for matching a transmitted error against its original
+// (e.g. `mango.ErrRowsRangeOutOfConc`) using `errors.Is`
+func (err *TransmittedError) Is(target error) bool {
+	return target != nil && err.Message == target.Error()
+}
+
 //
 
 // Adapter provides functions for query producers and consumers
@@ -112,6 +210,10 @@ type Adapter struct {
 	channelQuery        string
 	channelResultPrefix string
 	queryAnswerTimeout  time.Duration
+	resultCacheTTL      time.Duration
+
+	consumerGroupOnce sync.Once
+	consumerGroupErr  error
 }
 
 func (a *Adapter) TestConnection(totalTimeout time.Duration, timeoutPerTry time.Duration) error {
@@ -139,6 +241,11 @@ func (a *Adapter) TestConnection(totalTimeout time.Duration, timeoutPerTry time.
 	}
 }
 
+// Ping tests whether the Redis server responds
+func (a *Adapter) Ping(ctx context.Context) error {
+	return a.redis.Ping(ctx).Err()
+}
+
 // SomeoneListens tests if there is a listener for a channel
 // specified in the provided `query`. If false, then there
 // is nobody interested in the query anymore.
@@ -150,19 +257,49 @@ func (a *Adapter) SomeoneListens(query Query) (bool, error) {
 	return cmd.Val()[query.Channel] > 0, nil
 }
 
-// PublishQuery publishes a new query and returns a channel
+// PublishQuery publishes a new concordance query and returns a channel
 // by which a respective result will be returned. In case the
 // process fails during the calculation, a corresponding error
 // is added to the ConcResult value.
 // If the PublishQuery method itself returns an error, it means,
 // that the publishing itself failed and the client won't obtain
 // any information about the calculation (in which case it relies
-// on timeout)
-func (a *Adapter) PublishQuery(query Query) (<-chan result.ConcResult, error) {
+// on timeout).
+// Once the `ctx` is cancelled (e.g. the HTTP client disconnects), the query
+// is withdrawn from the queue (or a worker processing it finds out nobody
+// listens anymore) and the result contains ErrQueryCancelled.
+func (a *Adapter) PublishQuery(ctx context.Context, query Query) (<-chan result.ConcResult, error) {
+	return publishTypedQuery[result.ConcResult](a, ctx, query)
+}
+
+// PublishAttrValuesQuery publishes a new query for positional attribute
+// values. It behaves the same way as PublishQuery.
+func (a *Adapter) PublishAttrValuesQuery(ctx context.Context, query Query) (<-chan result.AttrValuesResult, error) {
+	return publishTypedQuery[result.AttrValuesResult](a, ctx, query)
+}
+
+type resultPtr[T any] interface {
+	*T
+	result.WorkerResult
+}
+
+func publishTypedQuery[T any, PT resultPtr[T]](
+	a *Adapter,
+	reqCtx context.Context,
+	query Query,
+) (<-chan T, error) {
 	query.Channel = fmt.Sprintf("%s:%s", a.channelResultPrefix, uuid.New().String())
+	origin := QueryOriginFromContext(reqCtx)
+	query.Lane = origin.Lane
+	if a.conf.Scheduling.lane(query.Lane) == nil {
+		query.Lane = LaneDefault
+	}
+	query.ClientID = origin.ClientID
 	log.Debug().
 		Str("channel", query.Channel).
 		Str("func", query.Func).
+		Str("lane", query.Lane).
+		Str("clientId", query.ClientID).
 		Any("args", query.Args).
 		Msg("publishing query")
 
@@ -173,96 +310,220 @@ func (a *Adapter) PublishQuery(query Query) (<-chan result.ConcResult, error) {
 		return nil, fmt.Errorf("failed to publish query: %w", err)
 	}
 
+	publishedAt := time.Now()
 	ctx2, cancel := context.WithTimeout(a.ctx, a.queryAnswerTimeout)
 	defer cancel()
 	sub := a.redis.Subscribe(ctx2, query.Channel)
-	if err := a.redis.LPush(ctx2, DefaultQueueKey, msg.String()).Err(); err != nil {
+	var streamMsgID string
+	if a.UsesStreams() {
+		streamMsgID, err = a.enqueueToStream(ctx2, msg.String())
+		if err != nil {
+			return nil, err
+		}
+
+	} else if err := a.enqueueToLane(ctx2, query, msg.String()); err != nil {
 		return nil, err
 	}
-	ansChan := make(chan result.ConcResult)
+	ansChan := make(chan T)
 
 	// now we wait for response and send result via `ans`
 	go func() {
 		defer func() {
+			// closing the subscription also tells a possibly running worker
+			// nobody listens anymore (see SomeoneListens)
 			sub.Close()
 			close(ansChan)
 		}()
 
 		ctx3, cancel := context.WithTimeout(a.ctx, a.queryAnswerTimeout)
 		defer cancel()
-		var ans result.ConcResult
+		var ans T
+
+		select {
+		case item, ok := <-sub.Channel():
+			log.Debug().
+				Str("channel", query.Channel).
+				Bool("closedChannel", !ok).
+				Msg("received result")
+			metrics.ObserveQueryWait(query.Func, time.Since(publishedAt))
+			cmd := a.redis.Get(ctx3, item.Payload)
+			if cmd.Err() != nil {
+				PT(&ans).SetError(cmd.Err())
 
-		for {
-			select {
-			case item, ok := <-sub.Channel():
+			} else {
+				var buf bytes.Buffer
+				buf.WriteString(cmd.Val())
+				dec := gob.NewDecoder(&buf)
+				err := dec.Decode(&ans)
+				if err != nil {
+					PT(&ans).SetError(err)
+				}
 				log.Debug().
 					Str("channel", query.Channel).
-					Bool("closedChannel", !ok).
-					Msg("received result")
-				cmd := a.redis.Get(ctx3, item.Payload)
-				if cmd.Err() != nil {
-					ans.Error = cmd.Err()
-
-				} else {
-					var buf bytes.Buffer
-					buf.WriteString(cmd.Val())
-					dec := gob.NewDecoder(&buf)
-					err := dec.Decode(&ans)
-					if err != nil {
-						ans.Error = err
-					}
-					log.Debug().
-						Str("channel", query.Channel).
-						Int("concSize", ans.ConcSize).
-						Str("query", ans.Query).
-						Msg("decoded result")
-				}
-				ansChan <- ans
-				return
-			case <-ctx3.Done():
-				ans.Error = fmt.Errorf("waiting for worker response timeout")
-				ansChan <- ans
-			case <-a.ctx.Done():
-				log.Warn().Msg("publishing query interrupted due to cancellation")
-				return
+					Str("func", query.Func).
+					Msg("decoded result")
 			}
+		case <-reqCtx.Done():
+			log.Warn().
+				Str("channel", query.Channel).
+				Str("func", query.Func).
+				Msg("query cancelled by client")
+			a.withdrawQuery(query, msg.String(), streamMsgID)
+			metrics.ObserveQueryCancellation(query.Func)
+			PT(&ans).SetError(fmt.Errorf("%w: %s", ErrQueryCancelled, reqCtx.Err()))
+		case <-a.ctx.Done():
+			log.Warn().Msg("publishing query interrupted due to cancellation")
+			return
+		case <-ctx3.Done():
+			a.withdrawQuery(query, msg.String(), streamMsgID)
+			metrics.ObserveQueryTimeout(query.Func)
+			PT(&ans).SetError(fmt.Errorf("waiting for worker response timeout"))
 		}
-
+		ansChan <- ans
 	}()
+	if a.UsesStreams() {
+		// workers block on the stream so there is no need for notification
+		return ansChan, nil
+	}
 	return ansChan, a.redis.Publish(ctx2, a.channelQuery, MsgNewQuery).Err()
 }
 
-// DequeueQuery looks for a query queued for processing.
+func (a *Adapter) enqueueToLane(ctx context.Context, query Query, msg string) error {
+	err := enqueueScript.Run(
+		ctx,
+		a.redis,
+		[]string{
+			laneQueueKeyPrefix(query.Lane) + query.ClientID,
+			laneRingKey(query.Lane),
+			laneWeightsKey(),
+		},
+		msg, query.ClientID, query.Lane, a.conf.Scheduling.LaneWeight(query.Lane),
+	).Err()
+	if err != nil {
+		return fmt.Errorf("failed to enqueue query: %w", err)
+	}
+	return nil
+}
+
+// withdrawQuery removes a query nobody waits for from the queue
+// so no worker will process it. In case a worker has already
+// obtained the query, nothing happens.
+func (a *Adapter) withdrawQuery(query Query, msg, streamMsgID string) {
+	var err error
+	if a.UsesStreams() {
+		err = a.redis.XDel(a.ctx, a.conf.Streams.Key, streamMsgID).Err()
+
+	} else {
+		err = withdrawScript.Run(
+			a.ctx,
+			a.redis,
+			[]string{laneQueueKeyPrefix(query.Lane) + query.ClientID, laneRingKey(query.Lane)},
+			msg, query.ClientID,
+		).Err()
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("failed to withdraw query")
+	}
+}
+
+// laneWeights returns weights of lanes registered by query publishers
+func (a *Adapter) laneWeights() (map[string]int, error) {
+	vals, err := a.redis.HGetAll(a.ctx, laneWeightsKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+	ans := make(map[string]int, len(vals))
+	for lane, v := range vals {
+		ans[lane], _ = strconv.Atoi(v)
+	}
+	return ans, nil
+}
+
+// DequeueQuery looks for a query queued for processing
+// (see SchedulingConf for the order of queries).
 // In case nothing is found, ErrorEmptyQueue is returned
 // as an error.
 func (a *Adapter) DequeueQuery() (Query, error) {
-	cmd := a.redis.RPop(a.ctx, DefaultQueueKey)
-
-	if cmd.Val() == "" {
+	weights, err := a.laneWeights()
+	if err != nil {
+		return Query{}, fmt.Errorf("failed to dequeue query: %w", err)
+	}
+	lanes := laneOrder(weights, rand.Float64)
+	if len(lanes) == 0 {
 		return Query{}, ErrorEmptyQueue
 	}
-	if cmd.Err() != nil {
-		return Query{}, fmt.Errorf("failed to dequeue query: %w", cmd.Err())
+	rings := make([]string, len(lanes))
+	prefixes := make([]any, len(lanes))
+	for i, lane := range lanes {
+		rings[i] = laneRingKey(lane)
+		prefixes[i] = laneQueueKeyPrefix(lane)
 	}
-	q, err := DecodeQuery(cmd.Val())
+	rawQuery, err := dequeueScript.Run(a.ctx, a.redis, rings, prefixes...).Text()
+	if err == redis.Nil {
+		return Query{}, ErrorEmptyQueue
+
+	} else if err != nil {
+		return Query{}, fmt.Errorf("failed to dequeue query: %w", err)
+	}
+	q, err := DecodeQuery(rawQuery)
 	if err != nil {
 		return Query{}, fmt.Errorf("failed to deserialize query: %w", err)
 	}
 	return q, nil
 }
 
+// QueueStats returns numbers of queued queries per lane and client.
+// The statistics are available only for the "list" queue backend.
+func (a *Adapter) QueueStats() (QueueStats, error) {
+	if a.UsesStreams() {
+		return QueueStats{}, ErrQueueStatsNotAvailable
+	}
+	weights, err := a.laneWeights()
+	if err != nil {
+		return QueueStats{}, fmt.Errorf("failed to get queue stats: %w", err)
+	}
+	// lanes configured for this instance are reported even if nothing
+	// has been published to them yet
+	for lane, w := range a.conf.Scheduling.LaneWeights() {
+		if _, ok := weights[lane]; !ok {
+			weights[lane] = w
+		}
+	}
+	ans := QueueStats{Lanes: make([]LaneStats, 0, len(weights))}
+	for lane, weight := range weights {
+		item := LaneStats{Name: lane, Weight: weight, Clients: make(map[string]int)}
+		clients, err := a.redis.LRange(a.ctx, laneRingKey(lane), 0, -1).Result()
+		if err != nil {
+			return QueueStats{}, fmt.Errorf("failed to get queue stats: %w", err)
+		}
+		for _, client := range clients {
+			n, err := a.redis.LLen(a.ctx, laneQueueKeyPrefix(lane)+client).Result()
+			if err != nil {
+				return QueueStats{}, fmt.Errorf("failed to get queue stats: %w", err)
+			}
+			item.Clients[client] = int(n)
+			item.NumQueued += int(n)
+		}
+		ans.Lanes = append(ans.Lanes, item)
+	}
+	sort.Slice(ans.Lanes, func(i, j int) bool {
+		return ans.Lanes[i].Name < ans.Lanes[j].Name
+	})
+	return ans, nil
+}
+
 // PublishResult sends notification via Redis PUBSUB mechanism
 // and also stores the result so a notified listener can retrieve
 // it.
-func (a *Adapter) PublishResult(channelName string, value *result.ConcResult) error {
+func (a *Adapter) PublishResult(channelName string, value result.WorkerResult) error {
 	log.Debug().
 		Str("channel", channelName).
-		Str("resultType", "concordance").
+		Str("resultType", fmt.Sprintf("%T", value)).
 		Msg("publishing result")
 
-	if value.Error != nil {
-		value.Error = &TransmittedError{
-			Message: value.Error.Error(), Type: fmt.Sprintf("%T", value.Error)}
+	if value.GetError() != nil {
+		value.SetError(&TransmittedError{
+			Message: value.GetError().Error(), Type: fmt.Sprintf("%T", value.GetError())})
 	}
 
 	var msg bytes.Buffer
@@ -276,9 +537,16 @@ func (a *Adapter) PublishResult(channelName string, value *result.ConcResult) er
 }
 
 // Subscribe subscribes to query queue.
-func (a *Adapter) Subscribe() <-chan *redis.Message {
+func (a *Adapter) Subscribe() <-chan string {
 	sub := a.redis.Subscribe(a.ctx, a.channelQuery)
-	return sub.Channel()
+	ans := make(chan string)
+	go func() {
+		defer close(ans)
+		for msg := range sub.Channel() {
+			ans <- msg.Payload
+		}
+	}()
+	return ans
 }
 
 // NewAdapter is a recommended factory function
@@ -316,6 +584,7 @@ func NewAdapter(ctx context.Context, conf *Conf) *Adapter {
 		channelQuery:        chQuery,
 		channelResultPrefix: chRes,
 		queryAnswerTimeout:  queryAnswerTimeout,
+		resultCacheTTL:      time.Duration(conf.ResultCacheTTLSecs) * time.Second,
 	}
 	return ans
 }
@@ -29,8 +29,82 @@ const (
 	dfltChannelQuery           = "mquerysru"
 	dfltChannelResultPrefix    = "res"
 	dfltQueryAnswerTimeoutSecs = 30
+	dfltResultCacheTTLSecs     = 600
+	dfltStreamKey              = "mquerysru:queries"
+	dfltStreamConsumerGroup    = "mquerysru-workers"
+	dfltStreamMaxRetries       = 3
+	dfltStreamClaimIdleSecs    = 60
+
+	QueueBackendList    QueueBackend = "list"
+	QueueBackendStreams QueueBackend = "streams"
 )
 
+// QueueBackend specifies how queries are passed to workers
+type QueueBackend string
+
+func (qb QueueBackend) Validate() error {
+	if qb == QueueBackendList || qb == QueueBackendStreams {
+		return nil
+	}
+	return fmt.Errorf("unknown queue backend: %s", qb)
+}
+
+// StreamsConf configures the Redis Streams based queue backend
+type StreamsConf struct {
+
+	// Key is a Redis key of the stream
+	Key string `json:"key"`
+
+	// ConsumerGroup is a name of a consumer group workers belong to
+	ConsumerGroup string `json:"consumerGroup"`
+
+	// MaxRetries specifies how many times a query not acknowledged
+	// by a worker (e.g. due to the worker's crash) is passed to another
+	// worker before it is discarded
+	MaxRetries int `json:"maxRetries"`
+
+	// ClaimIdleSecs specifies how long a query can stay unacknowledged
+	// before other workers consider it abandoned and reclaim it.
+	// Workers refresh queries they process so the value is not
+	// a limit of query processing time. But it must be greater than
+	// the query answer timeout (see Conf.QueryAnswerTimeoutSecs).
+	ClaimIdleSecs int `json:"claimIdleSecs"`
+}
+
+func (conf *StreamsConf) ValidateAndDefaults() error {
+	if conf.Key == "" {
+		conf.Key = dfltStreamKey
+		log.Warn().
+			Str("value", conf.Key).
+			Msg("redis.streams.key not specified, using default")
+	}
+	if conf.ConsumerGroup == "" {
+		conf.ConsumerGroup = dfltStreamConsumerGroup
+		log.Warn().
+			Str("value", conf.ConsumerGroup).
+			Msg("redis.streams.consumerGroup not specified, using default")
+	}
+	if conf.MaxRetries < 0 {
+		return fmt.Errorf("redis.streams.maxRetries is invalid (use a positive number)")
+
+	} else if conf.MaxRetries == 0 {
+		conf.MaxRetries = dfltStreamMaxRetries
+		log.Warn().
+			Int("value", conf.MaxRetries).
+			Msg("redis.streams.maxRetries not specified, using default")
+	}
+	if conf.ClaimIdleSecs < 0 {
+		return fmt.Errorf("redis.streams.claimIdleSecs is invalid (use a positive number)")
+
+	} else if conf.ClaimIdleSecs == 0 {
+		conf.ClaimIdleSecs = dfltStreamClaimIdleSecs
+		log.Warn().
+			Int("value", conf.ClaimIdleSecs).
+			Msg("redis.streams.claimIdleSecs not specified, using default")
+	}
+	return nil
+}
+
 type Conf struct {
 	Host                   string `json:"host"`
 	Port                   int    `json:"port"`
@@ -39,6 +113,24 @@ type Conf struct {
 	ChannelQuery           string `json:"channelQuery"`
 	ChannelResultPrefix    string `json:"channelResultPrefix"`
 	QueryAnswerTimeoutSecs int    `json:"queryAnswerTimeoutSecs"`
+
+	// ResultCacheTTLSecs specifies how long concordance results are
+	// cached. A negative value disables the cache.
+	ResultCacheTTLSecs int `json:"resultCacheTTLSecs"`
+
+	// QueueBackend specifies how queries are passed to workers.
+	// The "list" backend uses a Redis list along with PUBSUB notifications,
+	// the "streams" backend uses Redis Streams with a consumer group
+	// which allows for reclaiming queries of crashed workers.
+	QueueBackend QueueBackend `json:"queueBackend"`
+
+	// Streams configures the "streams" queue backend
+	Streams StreamsConf `json:"streams"`
+
+	// Scheduling configures priority lanes and per-client fairness
+	// of queued queries. It applies to the "list" queue backend
+	// (the "streams" backend passes queries in the FIFO order).
+	Scheduling SchedulingConf `json:"scheduling"`
 }
 
 func (conf *Conf) ServerInfo() string {
@@ -79,5 +171,37 @@ func (conf *Conf) Validate() error {
 			Int("value", conf.QueryAnswerTimeoutSecs).
 			Msg("redis.queryAnswerTimeoutSecs not specified, using default")
 	}
+	if conf.ResultCacheTTLSecs == 0 {
+		conf.ResultCacheTTLSecs = dfltResultCacheTTLSecs
+		log.Warn().
+			Int("value", conf.ResultCacheTTLSecs).
+			Msg("redis.resultCacheTTLSecs not specified, using default")
+
+	} else if conf.ResultCacheTTLSecs < 0 {
+		log.Warn().Msg("redis.resultCacheTTLSecs is negative, result cache is disabled")
+	}
+	if conf.QueueBackend == "" {
+		conf.QueueBackend = QueueBackendList
+		log.Warn().
+			Str("value", string(conf.QueueBackend)).
+			Msg("redis.queueBackend not specified, using default")
+
+	} else if err := conf.QueueBackend.Validate(); err != nil {
+		return fmt.Errorf("redis.queueBackend is invalid: %w", err)
+	}
+	if conf.QueueBackend == QueueBackendStreams {
+		if err := conf.Streams.ValidateAndDefaults(); err != nil {
+			return err
+		}
+		if conf.Streams.ClaimIdleSecs <= conf.QueryAnswerTimeoutSecs {
+			return fmt.Errorf(
+				"redis.streams.claimIdleSecs (%d) must be greater than redis.queryAnswerTimeoutSecs (%d)",
+				conf.Streams.ClaimIdleSecs, conf.QueryAnswerTimeoutSecs,
+			)
+		}
+	}
+	if err := conf.Scheduling.ValidateAndDefaults(); err != nil {
+		return err
+	}
 	return nil
 }
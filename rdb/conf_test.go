@@ -0,0 +1,68 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//
+//	              Faculty of Arts, Charles University
+//	 This file is part of MQUERY.
+//
+//	MQUERY is free software: you can redistribute it and/or modify
+//	it under the terms of the GNU General Public License as published by
+//	the Free Software Foundation, either version 3 of the License, or
+//	(at your option) any later version.
+//
+//	MQUERY is distributed in the hope that it will be useful,
+//	but WITHOUT ANY WARRANTY; without even the implied warranty of
+//	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//	GNU General Public License for more details.
+//
+//	You should have received a copy of the GNU General Public License
+//	along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+package rdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateQueueBackendDefaultsToList(t *testing.T) {
+	conf := Conf{Host: "localhost", DB: 1}
+	assert.NoError(t, conf.Validate())
+	assert.Equal(t, QueueBackendList, conf.QueueBackend)
+}
+
+func TestValidateUnknownQueueBackend(t *testing.T) {
+	conf := Conf{Host: "localhost", DB: 1, QueueBackend: "kafka"}
+	assert.Error(t, conf.Validate())
+}
+
+func TestValidateStreamsDefaults(t *testing.T) {
+	conf := Conf{Host: "localhost", DB: 1, QueueBackend: QueueBackendStreams}
+	assert.NoError(t, conf.Validate())
+	assert.Equal(t, dfltStreamKey, conf.Streams.Key)
+	assert.Equal(t, dfltStreamConsumerGroup, conf.Streams.ConsumerGroup)
+	assert.Equal(t, dfltStreamMaxRetries, conf.Streams.MaxRetries)
+	assert.Equal(t, dfltStreamClaimIdleSecs, conf.Streams.ClaimIdleSecs)
+}
+
+func TestValidateStreamsNegativeRetries(t *testing.T) {
+	conf := Conf{
+		Host:         "localhost",
+		DB:           1,
+		QueueBackend: QueueBackendStreams,
+		Streams:      StreamsConf{MaxRetries: -1},
+	}
+	assert.Error(t, conf.Validate())
+}
+
+func TestValidateStreamsClaimIdleExceedsAnswerTimeout(t *testing.T) {
+	conf := Conf{
+		Host:                   "localhost",
+		DB:                     1,
+		QueryAnswerTimeoutSecs: 60,
+		QueueBackend:           QueueBackendStreams,
+		Streams:                StreamsConf{ClaimIdleSecs: 60},
+	}
+	assert.Error(t, conf.Validate())
+	conf.Streams.ClaimIdleSecs = 90
+	assert.NoError(t, conf.Validate())
+}
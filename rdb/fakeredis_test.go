@@ -0,0 +1,426 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeRedis is an in-memory replacement of a Redis server implementing
+// a subset of commands used by the Adapter. It is attached to a client
+// as a hook so no connection is ever made.
+type fakeRedis struct {
+	mu      sync.Mutex
+	strings map[string]string
+	hashes  map[string]map[string]string
+	zsets   map[string]map[string]float64
+	ttls    map[string]time.Duration
+
+	// expires contains expiration times of string keys
+	expires map[string]time.Time
+
+	// streams support a single consumer group per stream
+	streams map[string]*fakeStream
+
+	// now allows for moving the time of the fake server
+	now func() time.Time
+}
+
+func (fr *fakeRedis) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, fmt.Errorf("fakeRedis does not support connections")
+	}
+}
+
+func (fr *fakeRedis) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		fr.mu.Lock()
+		defer fr.mu.Unlock()
+		return fr.process(cmd)
+	}
+}
+
+func (fr *fakeRedis) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		fr.mu.Lock()
+		defer fr.mu.Unlock()
+		for _, cmd := range cmds {
+			if err := fr.process(cmd); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (fr *fakeRedis) hash(key string) map[string]string {
+	h, ok := fr.hashes[key]
+	if !ok {
+		h = make(map[string]string)
+		fr.hashes[key] = h
+	}
+	return h
+}
+
+type fakePendingEntry struct {
+	consumer    string
+	deliveredAt time.Time
+	deliveries  int64
+}
+
+type fakeStream struct {
+	group         string
+	messages      []redis.XMessage
+	lastDelivered int
+	pending       map[string]*fakePendingEntry
+	seq           int
+}
+
+func (fs *fakeStream) message(id string) (redis.XMessage, bool) {
+	for _, msg := range fs.messages {
+		if msg.ID == id {
+			return msg, true
+		}
+	}
+	return redis.XMessage{}, false
+}
+
+func (fs *fakeStream) pendingIDs() []string {
+	ans := make([]string, 0, len(fs.pending))
+	for _, msg := range fs.messages {
+		if _, ok := fs.pending[msg.ID]; ok {
+			ans = append(ans, msg.ID)
+		}
+	}
+	return ans
+}
+
+func (fr *fakeRedis) stream(key string) *fakeStream {
+	st, ok := fr.streams[key]
+	if !ok {
+		st = &fakeStream{pending: make(map[string]*fakePendingEntry)}
+		fr.streams[key] = st
+	}
+	return st
+}
+
+func (fr *fakeRedis) processStreamCmd(cmd redis.Cmder, args []string) error {
+	switch strings.ToLower(args[0]) {
+	case "xgroup":
+		st := fr.stream(args[2])
+		if st.group != "" {
+			err := fmt.Errorf("BUSYGROUP Consumer Group name already exists")
+			cmd.SetErr(err)
+			return err
+		}
+		st.group = args[3]
+		cmd.(*redis.StatusCmd).SetVal("OK")
+	case "xadd":
+		st := fr.stream(args[1])
+		st.seq++
+		msg := redis.XMessage{ID: fmt.Sprintf("%d-0", st.seq), Values: make(map[string]any)}
+		for i := 3; i+1 < len(args); i += 2 {
+			msg.Values[args[i]] = args[i+1]
+		}
+		st.messages = append(st.messages, msg)
+		cmd.(*redis.StringCmd).SetVal(msg.ID)
+	case "xreadgroup":
+		consumer := args[3]
+		st := fr.stream(args[len(args)-2])
+		if st.lastDelivered >= len(st.messages) {
+			cmd.SetErr(redis.Nil)
+			return redis.Nil
+		}
+		msg := st.messages[st.lastDelivered]
+		st.lastDelivered++
+		st.pending[msg.ID] = &fakePendingEntry{consumer: consumer, deliveredAt: fr.now(), deliveries: 1}
+		cmd.(*redis.XStreamSliceCmd).SetVal(
+			[]redis.XStream{{Stream: args[len(args)-2], Messages: []redis.XMessage{msg}}})
+	case "xautoclaim":
+		st := fr.stream(args[1])
+		minIdle, _ := strconv.Atoi(args[4])
+		ans := make([]redis.XMessage, 0, len(st.pending))
+		for _, id := range st.pendingIDs() {
+			entry := st.pending[id]
+			if fr.now().Sub(entry.deliveredAt) < time.Duration(minIdle)*time.Millisecond {
+				continue
+			}
+			entry.consumer = args[3]
+			entry.deliveredAt = fr.now()
+			entry.deliveries++
+			msg, _ := st.message(id)
+			ans = append(ans, msg)
+		}
+		cmd.(*redis.XAutoClaimCmd).SetVal(ans, "0-0")
+	case "xclaim":
+		st := fr.stream(args[1])
+		minIdle, _ := strconv.Atoi(args[4])
+		justID := strings.ToLower(args[len(args)-1]) == "justid"
+		ans := make([]string, 0, 1)
+		for _, id := range args[5:] {
+			entry, ok := st.pending[id]
+			if !ok || fr.now().Sub(entry.deliveredAt) < time.Duration(minIdle)*time.Millisecond {
+				continue
+			}
+			entry.consumer = args[3]
+			entry.deliveredAt = fr.now()
+			if !justID {
+				entry.deliveries++
+			}
+			ans = append(ans, id)
+		}
+		cmd.(*redis.StringSliceCmd).SetVal(ans)
+	case "xpending":
+		st := fr.stream(args[1])
+		ans := make([]redis.XPendingExt, 0, 1)
+		for _, id := range st.pendingIDs() {
+			if id >= args[3] && id <= args[4] {
+				entry := st.pending[id]
+				ans = append(ans, redis.XPendingExt{
+					ID:         id,
+					Consumer:   entry.consumer,
+					Idle:       fr.now().Sub(entry.deliveredAt),
+					RetryCount: entry.deliveries,
+				})
+			}
+		}
+		cmd.(*redis.XPendingExtCmd).SetVal(ans)
+	case "xack":
+		st := fr.stream(args[1])
+		var n int64
+		for _, id := range args[3:] {
+			if _, ok := st.pending[id]; ok {
+				delete(st.pending, id)
+				n++
+			}
+		}
+		cmd.(*redis.IntCmd).SetVal(n)
+	case "xdel":
+		st := fr.stream(args[1])
+		var n int64
+		for _, id := range args[2:] {
+			for i, msg := range st.messages {
+				if msg.ID == id {
+					st.messages = append(st.messages[:i], st.messages[i+1:]...)
+					if i < st.lastDelivered {
+						st.lastDelivered--
+					}
+					n++
+					break
+				}
+			}
+		}
+		cmd.(*redis.IntCmd).SetVal(n)
+	default:
+		err := fmt.Errorf("fakeRedis: unsupported command %s", args[0])
+		cmd.SetErr(err)
+		return err
+	}
+	return nil
+}
+
+func (fr *fakeRedis) zset(key string) map[string]float64 {
+	z, ok := fr.zsets[key]
+	if !ok {
+		z = make(map[string]float64)
+		fr.zsets[key] = z
+	}
+	return z
+}
+
+func (fr *fakeRedis) getString(key string) (string, bool) {
+	if exp, ok := fr.expires[key]; ok && !fr.now().Before(exp) {
+		delete(fr.strings, key)
+		delete(fr.expires, key)
+	}
+	v, ok := fr.strings[key]
+	return v, ok
+}
+
+// parseScore parses a score boundary (e.g. `-inf`, `(10`) and tells
+// whether the boundary is exclusive
+func parseScore(v string) (float64, bool) {
+	exclusive := strings.HasPrefix(v, "(")
+	v = strings.TrimPrefix(v, "(")
+	switch v {
+	case "-inf":
+		return math.Inf(-1), exclusive
+	case "+inf", "inf":
+		return math.Inf(1), exclusive
+	}
+	ans, _ := strconv.ParseFloat(v, 64)
+	return ans, exclusive
+}
+
+func scoreInRange(score float64, minArg, maxArg string) bool {
+	minVal, minExcl := parseScore(minArg)
+	maxVal, maxExcl := parseScore(maxArg)
+	return (score > minVal || !minExcl && score == minVal) &&
+		(score < maxVal || !maxExcl && score == maxVal)
+}
+
+func (fr *fakeRedis) process(cmd redis.Cmder) error {
+	args := make([]string, len(cmd.Args()))
+	for i, v := range cmd.Args() {
+		if data, ok := v.([]byte); ok {
+			args[i] = string(data)
+
+		} else {
+			args[i] = fmt.Sprint(v)
+		}
+	}
+	switch strings.ToLower(args[0]) {
+	case "multi", "exec":
+	case "set":
+		fr.strings[args[1]] = args[2]
+		delete(fr.expires, args[1])
+		if len(args) > 4 && strings.ToLower(args[3]) == "ex" {
+			secs, _ := strconv.Atoi(args[4])
+			fr.expires[args[1]] = fr.now().Add(time.Duration(secs) * time.Second)
+		}
+		cmd.(*redis.StatusCmd).SetVal("OK")
+	case "get":
+		v, ok := fr.getString(args[1])
+		if !ok {
+			cmd.SetErr(redis.Nil)
+			return redis.Nil
+		}
+		cmd.(*redis.StringCmd).SetVal(v)
+	case "mget":
+		ans := make([]any, 0, len(args)-1)
+		for _, key := range args[1:] {
+			if v, ok := fr.getString(key); ok {
+				ans = append(ans, v)
+
+			} else {
+				ans = append(ans, nil)
+			}
+		}
+		cmd.(*redis.SliceCmd).SetVal(ans)
+	case "del":
+		var n int64
+		for _, key := range args[1:] {
+			if _, ok := fr.strings[key]; ok {
+				delete(fr.strings, key)
+				n++
+			}
+		}
+		cmd.(*redis.IntCmd).SetVal(n)
+	case "zadd":
+		z := fr.zset(args[1])
+		for i := 2; i+1 < len(args); i += 2 {
+			score, _ := strconv.ParseFloat(args[i], 64)
+			z[args[i+1]] = score
+		}
+		cmd.(*redis.IntCmd).SetVal(int64(len(args)-2) / 2)
+	case "zremrangebyscore":
+		var n int64
+		for member, score := range fr.zsets[args[1]] {
+			if scoreInRange(score, args[2], args[3]) {
+				delete(fr.zsets[args[1]], member)
+				n++
+			}
+		}
+		cmd.(*redis.IntCmd).SetVal(n)
+	case "zrangebyscore":
+		ans := make([]string, 0, len(fr.zsets[args[1]]))
+		for member, score := range fr.zsets[args[1]] {
+			if scoreInRange(score, args[2], args[3]) {
+				ans = append(ans, member)
+			}
+		}
+		sort.Slice(ans, func(i, j int) bool {
+			return fr.zsets[args[1]][ans[i]] < fr.zsets[args[1]][ans[j]]
+		})
+		cmd.(*redis.StringSliceCmd).SetVal(ans)
+	case "hset":
+		h := fr.hash(args[1])
+		for i := 2; i+1 < len(args); i += 2 {
+			h[args[i]] = args[i+1]
+		}
+		cmd.(*redis.IntCmd).SetVal(int64(len(args)-2) / 2)
+	case "hmget":
+		ans := make([]any, 0, len(args)-2)
+		for _, field := range args[2:] {
+			if v, ok := fr.hashes[args[1]][field]; ok {
+				ans = append(ans, v)
+
+			} else {
+				ans = append(ans, nil)
+			}
+		}
+		cmd.(*redis.SliceCmd).SetVal(ans)
+	case "hgetall":
+		ans := make(map[string]string)
+		for k, v := range fr.hashes[args[1]] {
+			ans[k] = v
+		}
+		cmd.(*redis.MapStringStringCmd).SetVal(ans)
+	case "hincrby":
+		h := fr.hash(args[1])
+		curr, _ := strconv.ParseInt(h[args[2]], 10, 64)
+		incr, _ := strconv.ParseInt(args[3], 10, 64)
+		h[args[2]] = strconv.FormatInt(curr+incr, 10)
+		cmd.(*redis.IntCmd).SetVal(curr + incr)
+	case "expire":
+		secs, _ := strconv.Atoi(args[2])
+		fr.ttls[args[1]] = time.Duration(secs) * time.Second
+		cmd.(*redis.BoolCmd).SetVal(true)
+	default:
+		return fr.processStreamCmd(cmd, args)
+	}
+	return nil
+}
+
+// newFakeRedisAdapter creates an Adapter backed by fakeRedis
+func newFakeRedisAdapter(t *testing.T) (*Adapter, *fakeRedis) {
+	fr := &fakeRedis{
+		strings: make(map[string]string),
+		hashes:  make(map[string]map[string]string),
+		zsets:   make(map[string]map[string]float64),
+		ttls:    make(map[string]time.Duration),
+		expires: make(map[string]time.Time),
+		streams: make(map[string]*fakeStream),
+		now:     time.Now,
+	}
+	client := redis.NewClient(&redis.Options{Addr: "fake-redis:6379"})
+	client.AddHook(fr)
+	t.Cleanup(func() { client.Close() })
+	ans := &Adapter{
+		ctx:                 context.Background(),
+		redis:               client,
+		conf:                &Conf{},
+		channelQuery:        "mquerysru",
+		channelResultPrefix: "res",
+		queryAnswerTimeout:  30 * time.Second,
+		resultCacheTTL:      10 * time.Minute,
+	}
+	return ans, fr
+}
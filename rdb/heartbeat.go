@@ -0,0 +1,170 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/czcorpus/mquery-sru/general"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	heartbeatsKey = "mquerysru:workers"
+
+	workerStatusKeyPrefix = "mquerysru:worker:"
+
+	// WorkerHeartbeatInterval specifies how often workers
+	// announce they are alive
+	WorkerHeartbeatInterval = 5 * time.Second
+
+	// WorkerHeartbeatMaxAge specifies how old a heartbeat can be
+	// so its worker is still considered alive
+	WorkerHeartbeatMaxAge = 3 * WorkerHeartbeatInterval
+
+	// heartbeatRetention specifies how long heartbeats of workers
+	// which stopped writing them are kept
+	heartbeatRetention = time.Hour
+)
+
+// WorkerJob describes a job running in a worker
+type WorkerJob struct {
+	Slot    int       `json:"slot"`
+	Func    string    `json:"func"`
+	Corpus  string    `json:"corpus"`
+	Query   string    `json:"query,omitempty"`
+	Lane    string    `json:"lane"`
+	Channel string    `json:"channel"`
+	Start   time.Time `json:"start"`
+}
+
+// WorkerStatus is a worker's self-reported state written
+// along with each of its heartbeats
+type WorkerStatus struct {
+	ID            string              `json:"id"`
+	Version       general.VersionInfo `json:"version"`
+	Started       time.Time           `json:"started"`
+	LastHeartbeat time.Time           `json:"lastHeartbeat"`
+	NumSlots      int                 `json:"numSlots"`
+
+	// Draining means the worker does not accept new queries
+	// and it waits for its running jobs to finish
+	Draining bool        `json:"draining"`
+	Jobs     []WorkerJob `json:"jobs"`
+}
+
+func workerStatusKey(workerID string) string {
+	return workerStatusKeyPrefix + workerID
+}
+
+// WriteHeartbeat marks the worker as alive at the current time
+// and stores its status. Heartbeats are stored in a sorted set
+// with scores representing times of the heartbeats, statuses
+// are stored as separate keys expiring along with the heartbeat.
+func (a *Adapter) WriteHeartbeat(status WorkerStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("failed to write heartbeat of worker %s: %w", status.ID, err)
+	}
+	_, err = a.redis.TxPipelined(a.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(a.ctx, workerStatusKey(status.ID), data, WorkerHeartbeatMaxAge)
+		pipe.ZAdd(
+			a.ctx,
+			heartbeatsKey,
+			redis.Z{Score: float64(status.LastHeartbeat.UnixMilli()), Member: status.ID},
+		)
+		pipe.ZRemRangeByScore(
+			a.ctx,
+			heartbeatsKey,
+			"-inf",
+			fmt.Sprintf("(%d", status.LastHeartbeat.Add(-heartbeatRetention).UnixMilli()),
+		)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write heartbeat of worker %s: %w", status.ID, err)
+	}
+	return nil
+}
+
+// WorkersStatus returns statuses of all the workers with
+// a heartbeat not older than WorkerHeartbeatMaxAge
+// (including draining ones) sorted by worker IDs
+func (a *Adapter) WorkersStatus() ([]WorkerStatus, error) {
+	workerIDs, err := a.redis.ZRangeByScore(a.ctx, heartbeatsKey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().Add(-WorkerHeartbeatMaxAge).UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workers status: %w", err)
+	}
+	ans := make([]WorkerStatus, 0, len(workerIDs))
+	if len(workerIDs) == 0 {
+		return ans, nil
+	}
+	keys := make([]string, len(workerIDs))
+	for i, workerID := range workerIDs {
+		keys[i] = workerStatusKey(workerID)
+	}
+	items, err := a.redis.MGet(a.ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workers status: %w", err)
+	}
+	for i, item := range items {
+		data, ok := item.(string)
+		if !ok {
+			// the status has just expired
+			continue
+		}
+		var status WorkerStatus
+		if err := json.Unmarshal([]byte(data), &status); err != nil {
+			return nil, fmt.Errorf("failed to get status of worker %s: %w", workerIDs[i], err)
+		}
+		ans = append(ans, status)
+	}
+	sort.Slice(ans, func(i, j int) bool { return ans[i].ID < ans[j].ID })
+	return ans, nil
+}
+
+// LiveWorkers returns IDs of workers accepting queries
+// with a heartbeat not older than `maxAge`
+func (a *Adapter) LiveWorkers(maxAge time.Duration) ([]string, error) {
+	workers, err := a.WorkersStatus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get live workers: %w", err)
+	}
+	return liveWorkers(workers, maxAge), nil
+}
+
+// liveWorkers filters IDs of workers accepting queries
+// with a heartbeat not older than `maxAge`
+func liveWorkers(workers []WorkerStatus, maxAge time.Duration) []string {
+	ans := make([]string, 0, len(workers))
+	for _, w := range workers {
+		if !w.Draining && time.Since(w.LastHeartbeat) <= maxAge {
+			ans = append(ans, w.ID)
+		}
+	}
+	return ans
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkersStatusOmitsOldHeartbeats(t *testing.T) {
+	adapter, _ := newFakeRedisAdapter(t)
+	now := time.Now()
+	assert.NoError(t, adapter.WriteHeartbeat(WorkerStatus{ID: "host-b-12", LastHeartbeat: now, NumSlots: 2}))
+	assert.NoError(t, adapter.WriteHeartbeat(WorkerStatus{ID: "host-a-11", LastHeartbeat: now, NumSlots: 4}))
+	assert.NoError(t, adapter.WriteHeartbeat(
+		WorkerStatus{ID: "host-c-13", LastHeartbeat: now.Add(-2 * WorkerHeartbeatMaxAge)}))
+
+	workers, err := adapter.WorkersStatus()
+	assert.NoError(t, err)
+	if assert.Len(t, workers, 2) {
+		assert.Equal(t, "host-a-11", workers[0].ID)
+		assert.Equal(t, 4, workers[0].NumSlots)
+		assert.Equal(t, "host-b-12", workers[1].ID)
+	}
+}
+
+func TestWorkersStatusOmitsExpiredStatus(t *testing.T) {
+	adapter, fr := newFakeRedisAdapter(t)
+	assert.NoError(t, adapter.WriteHeartbeat(WorkerStatus{ID: "w1", LastHeartbeat: time.Now()}))
+	fr.now = func() time.Time { return time.Now().Add(WorkerHeartbeatMaxAge + time.Second) }
+
+	workers, err := adapter.WorkersStatus()
+	assert.NoError(t, err)
+	assert.Empty(t, workers)
+}
+
+func TestWriteHeartbeatRemovesStaleWorkers(t *testing.T) {
+	adapter, fr := newFakeRedisAdapter(t)
+	now := time.Now()
+	assert.NoError(t, adapter.WriteHeartbeat(
+		WorkerStatus{ID: "w1", LastHeartbeat: now.Add(-heartbeatRetention - time.Minute)}))
+	assert.NoError(t, adapter.WriteHeartbeat(WorkerStatus{ID: "w2", LastHeartbeat: now}))
+	assert.NotContains(t, fr.zsets[heartbeatsKey], "w1")
+	assert.Contains(t, fr.zsets[heartbeatsKey], "w2")
+}
+
+func TestLiveWorkers(t *testing.T) {
+	now := time.Now()
+	workers := []WorkerStatus{
+		{ID: "w1", LastHeartbeat: now},
+		{ID: "w2", LastHeartbeat: now, Draining: true},
+		{ID: "w3", LastHeartbeat: now.Add(-time.Minute)},
+		{ID: "w4", LastHeartbeat: now.Add(-5 * time.Second)},
+	}
+	assert.Equal(t, []string{"w1", "w4"}, liveWorkers(workers, 10*time.Second))
+	assert.Equal(t, []string{"w1"}, liveWorkers(workers, time.Second))
+	assert.Empty(t, liveWorkers([]WorkerStatus{}, time.Second))
+
+	adapter, _ := newFakeRedisAdapter(t)
+	for _, w := range workers {
+		assert.NoError(t, adapter.WriteHeartbeat(w))
+	}
+	live, err := adapter.LiveWorkers(WorkerHeartbeatMaxAge)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"w1", "w4"}, live)
+}
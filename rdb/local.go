@@ -0,0 +1,269 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/mquery-sru/metrics"
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// InProcessQueue is a channel based queue backend allowing
+// the HTTP server and workers to run within a single process
+// without any Redis instance.
+type InProcessQueue struct {
+	ctx                context.Context
+	queryAnswerTimeout time.Duration
+
+	mu          sync.Mutex
+	queries     *fairQueue
+	waiting     map[string]chan result.WorkerResult
+	subscribers []chan string
+	heartbeats  map[string]WorkerStatus
+}
+
+// PublishQuery publishes a new concordance query and returns a channel
+// by which a respective result will be returned. Once the `ctx` is
+// cancelled, the query is withdrawn and the result contains
+// ErrQueryCancelled.
+func (q *InProcessQueue) PublishQuery(ctx context.Context, query Query) (<-chan result.ConcResult, error) {
+	return publishLocalQuery[result.ConcResult](q, ctx, query)
+}
+
+// PublishAttrValuesQuery publishes a new query for positional attribute
+// values. It behaves the same way as PublishQuery.
+func (q *InProcessQueue) PublishAttrValuesQuery(
+	ctx context.Context,
+	query Query,
+) (<-chan result.AttrValuesResult, error) {
+	return publishLocalQuery[result.AttrValuesResult](q, ctx, query)
+}
+
+func publishLocalQuery[T any, PT resultPtr[T]](
+	q *InProcessQueue,
+	reqCtx context.Context,
+	query Query,
+) (<-chan T, error) {
+	query.Channel = uuid.New().String()
+	origin := QueryOriginFromContext(reqCtx)
+	query.Lane = origin.Lane
+	query.ClientID = origin.ClientID
+	log.Debug().
+		Str("channel", query.Channel).
+		Str("func", query.Func).
+		Str("lane", query.Lane).
+		Str("clientId", query.ClientID).
+		Any("args", query.Args).
+		Msg("publishing query")
+
+	publishedAt := time.Now()
+	resChan := make(chan result.WorkerResult, 1)
+	q.mu.Lock()
+	q.waiting[query.Channel] = resChan
+	q.queries.push(query)
+	subscribers := q.subscribers
+	q.mu.Unlock()
+
+	for _, sub := range subscribers {
+		select {
+		case sub <- MsgNewQuery:
+		default:
+			// the subscriber has a pending notification already
+		}
+	}
+
+	ansChan := make(chan T)
+	go func() {
+		defer func() {
+			q.mu.Lock()
+			delete(q.waiting, query.Channel)
+			q.mu.Unlock()
+			close(ansChan)
+		}()
+		ctx, cancel := context.WithTimeout(q.ctx, q.queryAnswerTimeout)
+		defer cancel()
+		var ans T
+		select {
+		case res := <-resChan:
+			metrics.ObserveQueryWait(query.Func, time.Since(publishedAt))
+			if typedRes, ok := res.(PT); ok {
+				ans = *typedRes
+
+			} else {
+				PT(&ans).SetError(fmt.Errorf("unexpected result type %T", res))
+			}
+		case <-reqCtx.Done():
+			log.Warn().
+				Str("channel", query.Channel).
+				Str("func", query.Func).
+				Msg("query cancelled by client")
+			q.withdrawQuery(query.Channel)
+			metrics.ObserveQueryCancellation(query.Func)
+			PT(&ans).SetError(fmt.Errorf("%w: %s", ErrQueryCancelled, reqCtx.Err()))
+		case <-ctx.Done():
+			if q.ctx.Err() != nil {
+				log.Warn().Msg("publishing query interrupted due to cancellation")
+				return
+			}
+			q.withdrawQuery(query.Channel)
+			metrics.ObserveQueryTimeout(query.Func)
+			PT(&ans).SetError(fmt.Errorf("waiting for worker response timeout"))
+		}
+		ansChan <- ans
+	}()
+	return ansChan, nil
+}
+
+// withdrawQuery removes a query nobody waits for from the queue
+// so no worker will process it.
+func (q *InProcessQueue) withdrawQuery(channel string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.queries.remove(channel)
+}
+
+// Subscribe returns a channel notifying about new queries.
+// Each subscriber (typically a worker) must use its own channel.
+func (q *InProcessQueue) Subscribe() <-chan string {
+	ans := make(chan string, 1)
+	q.mu.Lock()
+	q.subscribers = append(q.subscribers, ans)
+	q.mu.Unlock()
+	return ans
+}
+
+// DequeueQuery looks for a query queued for processing
+// (see SchedulingConf for the order of queries).
+// In case nothing is found, ErrorEmptyQueue is returned
+// as an error.
+func (q *InProcessQueue) DequeueQuery() (Query, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ans, ok := q.queries.pop(rand.Float64)
+	if !ok {
+		return Query{}, ErrorEmptyQueue
+	}
+	return ans, nil
+}
+
+// QueueStats returns numbers of queued queries per lane and client
+func (q *InProcessQueue) QueueStats() (QueueStats, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.queries.stats(), nil
+}
+
+// SomeoneListens tests if someone still waits for
+// the result of the query.
+func (q *InProcessQueue) SomeoneListens(query Query) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, ok := q.waiting[query.Channel]
+	return ok, nil
+}
+
+// WriteHeartbeat marks the worker as alive at the time
+// of the status and stores the status
+func (q *InProcessQueue) WriteHeartbeat(status WorkerStatus) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.heartbeats[status.ID] = status
+	return nil
+}
+
+// WorkersStatus returns statuses of all the workers with
+// a heartbeat not older than WorkerHeartbeatMaxAge
+// (including draining ones) sorted by worker IDs
+func (q *InProcessQueue) WorkersStatus() ([]WorkerStatus, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ans := make([]WorkerStatus, 0, len(q.heartbeats))
+	for _, status := range q.heartbeats {
+		if time.Since(status.LastHeartbeat) <= WorkerHeartbeatMaxAge {
+			ans = append(ans, status)
+		}
+	}
+	sort.Slice(ans, func(i, j int) bool { return ans[i].ID < ans[j].ID })
+	return ans, nil
+}
+
+// LiveWorkers returns IDs of workers accepting queries
+// with a heartbeat not older than `maxAge`
+func (q *InProcessQueue) LiveWorkers(maxAge time.Duration) ([]string, error) {
+	workers, err := q.WorkersStatus()
+	if err != nil {
+		return nil, err
+	}
+	return liveWorkers(workers, maxAge), nil
+}
+
+// PublishResult passes the result to the publisher of the respective query.
+// In case nobody waits for the result anymore, the result is dropped.
+func (q *InProcessQueue) PublishResult(channelName string, value result.WorkerResult) error {
+	log.Debug().
+		Str("channel", channelName).
+		Str("resultType", fmt.Sprintf("%T", value)).
+		Msg("publishing result")
+	q.mu.Lock()
+	resChan, ok := q.waiting[channelName]
+	q.mu.Unlock()
+	if !ok {
+		log.Warn().
+			Str("channel", channelName).
+			Msg("nobody waits for the result anymore, dropping")
+		return nil
+	}
+	select {
+	case resChan <- value:
+	default:
+		return fmt.Errorf("result for channel %s already published", channelName)
+	}
+	return nil
+}
+
+// NewInProcessQueue is a recommended factory function
+// for creating new `InProcessQueue` instances. In case `scheduling`
+// is nil, DefaultSchedulingConf is used.
+func NewInProcessQueue(
+	ctx context.Context,
+	queryAnswerTimeout time.Duration,
+	scheduling *SchedulingConf,
+) *InProcessQueue {
+	if queryAnswerTimeout == 0 {
+		queryAnswerTimeout = DefaultQueryAnswerTimeout
+	}
+	if scheduling == nil {
+		scheduling = DefaultSchedulingConf()
+	}
+	return &InProcessQueue{
+		ctx:                ctx,
+		queryAnswerTimeout: queryAnswerTimeout,
+		queries:            newFairQueue(scheduling),
+		waiting:            make(map[string]chan result.WorkerResult),
+		heartbeats:         make(map[string]WorkerStatus),
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//
+//	              Faculty of Arts, Charles University
+//	 This file is part of MQUERY.
+//
+//	MQUERY is free software: you can redistribute it and/or modify
+//	it under the terms of the GNU General Public License as published by
+//	the Free Software Foundation, either version 3 of the License, or
+//	(at your option) any later version.
+//
+//	MQUERY is distributed in the hope that it will be useful,
+//	but WITHOUT ANY WARRANTY; without even the implied warranty of
+//	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//	GNU General Public License for more details.
+//
+//	You should have received a copy of the GNU General Public License
+//	along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+package rdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInProcessQueuePassesResult(t *testing.T) {
+	queue := NewInProcessQueue(context.Background(), time.Second, nil)
+	notifications := queue.Subscribe()
+	wait, err := queue.PublishQuery(context.Background(), Query{Func: FuncConcExample, Args: ConcQueryArgs{Query: "[word=\"x\"]"}})
+	assert.NoError(t, err)
+	assert.Equal(t, MsgNewQuery, <-notifications)
+
+	query, err := queue.DequeueQuery()
+	assert.NoError(t, err)
+	assert.Equal(t, FuncConcExample, query.Func)
+	isActive, err := queue.SomeoneListens(query)
+	assert.NoError(t, err)
+	assert.True(t, isActive)
+
+	_, err = queue.DequeueQuery()
+	assert.Equal(t, ErrorEmptyQueue, err)
+
+	err = queue.PublishResult(query.Channel, &result.ConcResult{ConcSize: 42, Query: "[word=\"x\"]"})
+	assert.NoError(t, err)
+	res := <-wait
+	assert.NoError(t, res.Error)
+	assert.Equal(t, 42, res.ConcSize)
+}
+
+func TestInProcessQueueKeepsOrder(t *testing.T) {
+	queue := NewInProcessQueue(context.Background(), time.Second, nil)
+	_, err := queue.PublishQuery(context.Background(), Query{Func: FuncConcExample})
+	assert.NoError(t, err)
+	_, err = queue.PublishAttrValuesQuery(context.Background(), Query{Func: FuncAttrValues})
+	assert.NoError(t, err)
+
+	q1, err := queue.DequeueQuery()
+	assert.NoError(t, err)
+	q2, err := queue.DequeueQuery()
+	assert.NoError(t, err)
+	assert.Equal(t, FuncConcExample, q1.Func)
+	assert.Equal(t, FuncAttrValues, q2.Func)
+}
+
+func TestInProcessQueueTimeout(t *testing.T) {
+	queue := NewInProcessQueue(context.Background(), 10*time.Millisecond, nil)
+	wait, err := queue.PublishAttrValuesQuery(context.Background(), Query{Func: FuncAttrValues})
+	assert.NoError(t, err)
+	query, err := queue.DequeueQuery()
+	assert.NoError(t, err)
+
+	res := <-wait
+	assert.Error(t, res.Error)
+	isActive, err := queue.SomeoneListens(query)
+	assert.NoError(t, err)
+	assert.False(t, isActive)
+	// a late result is just dropped
+	assert.NoError(t, queue.PublishResult(query.Channel, &result.AttrValuesResult{}))
+}
+
+func TestInProcessQueueResultTypeMismatch(t *testing.T) {
+	queue := NewInProcessQueue(context.Background(), time.Second, nil)
+	wait, err := queue.PublishQuery(context.Background(), Query{Func: FuncConcExample})
+	assert.NoError(t, err)
+	query, err := queue.DequeueQuery()
+	assert.NoError(t, err)
+	err = queue.PublishResult(query.Channel, &result.AttrValuesResult{Error: errors.New("foo")})
+	assert.NoError(t, err)
+	res := <-wait
+	assert.Error(t, res.Error)
+}
+
+func TestInProcessQueueCancellation(t *testing.T) {
+	queue := NewInProcessQueue(context.Background(), time.Second, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	wait, err := queue.PublishQuery(ctx, Query{Func: FuncConcExample})
+	assert.NoError(t, err)
+	cancel()
+
+	res := <-wait
+	assert.ErrorIs(t, res.Error, ErrQueryCancelled)
+	_, err = queue.DequeueQuery()
+	assert.Equal(t, ErrorEmptyQueue, err)
+}
+
+func TestInProcessQueueLiveWorkers(t *testing.T) {
+	queue := NewInProcessQueue(context.Background(), time.Second, nil)
+	now := time.Now()
+	assert.NoError(t, queue.WriteHeartbeat(WorkerStatus{ID: "w2", LastHeartbeat: now}))
+	assert.NoError(t, queue.WriteHeartbeat(WorkerStatus{ID: "w1", LastHeartbeat: now}))
+	assert.NoError(t, queue.WriteHeartbeat(WorkerStatus{ID: "w3", LastHeartbeat: now.Add(-time.Minute)}))
+	assert.NoError(t, queue.WriteHeartbeat(WorkerStatus{ID: "w4", LastHeartbeat: now, Draining: true}))
+
+	workers, err := queue.LiveWorkers(WorkerHeartbeatMaxAge)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"w1", "w2"}, workers)
+
+	statuses, err := queue.WorkersStatus()
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 3)
+	assert.Equal(t, "w4", statuses[2].ID)
+	assert.True(t, statuses[2].Draining)
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/czcorpus/mquery-sru/result"
+)
+
+// QueryPublisher passes queries to workers and provides
+// their results. It is used by the HTTP server.
+type QueryPublisher interface {
+
+	// PublishQuery publishes a new concordance query and returns a channel
+	// by which a respective result will be returned. Once the `ctx` is
+	// cancelled, the query is withdrawn and the result contains
+	// ErrQueryCancelled.
+	PublishQuery(ctx context.Context, query Query) (<-chan result.ConcResult, error)
+
+	// PublishAttrValuesQuery publishes a new query for positional
+	// attribute values. It behaves the same way as PublishQuery.
+	PublishAttrValuesQuery(ctx context.Context, query Query) (<-chan result.AttrValuesResult, error)
+}
+
+// QueryConsumer provides queries for workers and passes
+// their results back to respective publishers.
+type QueryConsumer interface {
+
+	// Subscribe returns a channel notifying about new queries
+	// (using the MsgNewQuery message)
+	Subscribe() <-chan string
+
+	// DequeueQuery looks for a query queued for processing.
+	// In case nothing is found, ErrorEmptyQueue is returned.
+	DequeueQuery() (Query, error)
+
+	// SomeoneListens tests whether there is still someone
+	// waiting for the query result.
+	SomeoneListens(query Query) (bool, error)
+
+	// PublishResult passes a result to a publisher of a respective query
+	PublishResult(channelName string, value result.WorkerResult) error
+}
+
+// Queue is a complete queue backend used by both
+// the HTTP server and workers.
+type Queue interface {
+	QueryPublisher
+	QueryConsumer
+}
+
+// StreamQueryConsumer is an optional extension of QueryConsumer
+// for backends able to reclaim queries of crashed workers.
+type StreamQueryConsumer interface {
+	UsesStreams() bool
+	StreamsClaimIdle() time.Duration
+	ReadStreamQuery(consumer string, block time.Duration) (StreamQuery, error)
+	ReclaimStreamQueries(consumer string) (retry, expired []StreamQuery, err error)
+	RefreshStreamQuery(consumer string, q StreamQuery) error
+	AckStreamQuery(q StreamQuery) error
+}
+
+// WorkerHeartbeats is an optional extension of queue backends
+// allowing workers to announce they are alive and what they do.
+type WorkerHeartbeats interface {
+
+	// WriteHeartbeat marks the worker as alive at the time
+	// of the status and stores the status
+	WriteHeartbeat(status WorkerStatus) error
+
+	// WorkersStatus returns statuses of all the workers with
+	// a heartbeat not older than WorkerHeartbeatMaxAge
+	// (including draining ones) sorted by worker IDs
+	WorkersStatus() ([]WorkerStatus, error)
+
+	// LiveWorkers returns IDs of workers accepting queries
+	// with a heartbeat not older than `maxAge`
+	LiveWorkers(maxAge time.Duration) ([]string, error)
+}
+
+// ConcCache is an optional extension of QueryConsumer
+// for backends able to cache concordance results.
+type ConcCache interface {
+	GetCachedConc(args ConcQueryArgs) (*result.ConcResult, error)
+	StoreConcToCache(args ConcQueryArgs, res *result.ConcResult) error
+}
@@ -0,0 +1,381 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// LaneDefault is a lane for queries not matching any configured lane
+	LaneDefault = "default"
+
+	// LaneWatchdog is a lane for queries of a monitoring watchdog
+	// (see the `watchdogReqFilter` configuration)
+	LaneWatchdog = "watchdog"
+
+	// UnknownClientID is used for queries without any client identification
+	UnknownClientID = "-"
+
+	dfltLaneWeight = 1
+)
+
+type queryOriginCtxKey struct{}
+
+// QueryOrigin describes who sent a query and to which lane
+// of the queue the query belongs.
+type QueryOrigin struct {
+	Lane     string
+	ClientID string
+}
+
+// WithQueryOrigin attaches the query origin to a context
+// (typically to an HTTP request context) so a query publisher
+// can schedule the respective queries.
+func WithQueryOrigin(ctx context.Context, origin QueryOrigin) context.Context {
+	return context.WithValue(ctx, queryOriginCtxKey{}, origin)
+}
+
+// QueryOriginFromContext returns a query origin attached to the context.
+// In case there is none, the default lane and an unknown client are returned.
+func QueryOriginFromContext(ctx context.Context) QueryOrigin {
+	ans, _ := ctx.Value(queryOriginCtxKey{}).(QueryOrigin)
+	if ans.Lane == "" {
+		ans.Lane = LaneDefault
+	}
+	if ans.ClientID == "" {
+		ans.ClientID = UnknownClientID
+	}
+	return ans
+}
+
+// LaneConf defines a lane of the query queue along with rules
+// for assigning requests to the lane.
+type LaneConf struct {
+	Name string `json:"name"`
+
+	// Weight specifies the lane's share of workers' capacity
+	// relative to other lanes with queued queries
+	Weight int `json:"weight"`
+
+	// Clients lists client identifiers (see SchedulingConf.ClientIDHeader)
+	// assigned to the lane
+	Clients []string `json:"clients"`
+
+	// Header and HeaderValue assign requests with a matching HTTP header
+	// to the lane. With empty HeaderValue, any non-empty value matches.
+	Header      string `json:"header"`
+	HeaderValue string `json:"headerValue"`
+}
+
+func (lane *LaneConf) matches(getHeader func(string) string, clientID string) bool {
+	if lane.Header != "" {
+		v := getHeader(lane.Header)
+		if v != "" && (lane.HeaderValue == "" || v == lane.HeaderValue) {
+			return true
+		}
+	}
+	for _, c := range lane.Clients {
+		if c == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// SchedulingConf configures how queued queries are passed to workers.
+// Each query belongs to a lane. Lanes with queued queries are served
+// proportionally to their weights and within a lane, clients are served
+// in a round-robin manner so a single busy client cannot starve others.
+type SchedulingConf struct {
+
+	// ClientIDHeader is an HTTP header identifying a client (typically
+	// set by a trusted proxy). If empty or missing in a request,
+	// the client's IP address is used.
+	ClientIDHeader string `json:"clientIdHeader"`
+
+	// Lanes are evaluated in the order of definition, the first
+	// lane matching a request is used. The "default" and "watchdog"
+	// lanes are always available (with weight 1 unless configured).
+	Lanes []LaneConf `json:"lanes"`
+}
+
+func (conf *SchedulingConf) addDefaultLanes() {
+	for _, name := range []string{LaneDefault, LaneWatchdog} {
+		if conf.lane(name) == nil {
+			conf.Lanes = append(conf.Lanes, LaneConf{Name: name, Weight: dfltLaneWeight})
+		}
+	}
+}
+
+func (conf *SchedulingConf) lane(name string) *LaneConf {
+	for i := range conf.Lanes {
+		if conf.Lanes[i].Name == name {
+			return &conf.Lanes[i]
+		}
+	}
+	return nil
+}
+
+func (conf *SchedulingConf) ValidateAndDefaults() error {
+	names := make(map[string]bool)
+	for i := range conf.Lanes {
+		lane := &conf.Lanes[i]
+		if lane.Name == "" {
+			return fmt.Errorf("redis.scheduling.lanes[%d].name is missing", i)
+		}
+		if strings.Contains(lane.Name, ":") {
+			return fmt.Errorf("redis.scheduling.lanes[%d].name must not contain ':'", i)
+		}
+		if names[lane.Name] {
+			return fmt.Errorf("redis.scheduling.lanes[%d]: duplicate lane %s", i, lane.Name)
+		}
+		names[lane.Name] = true
+		if lane.Weight < 0 {
+			return fmt.Errorf(
+				"redis.scheduling.lanes[%d].weight is invalid (use a positive number)", i)
+
+		} else if lane.Weight == 0 {
+			lane.Weight = dfltLaneWeight
+			log.Warn().
+				Int("value", lane.Weight).
+				Str("lane", lane.Name).
+				Msg("redis.scheduling.lanes[].weight not specified, using default")
+		}
+	}
+	conf.addDefaultLanes()
+	return nil
+}
+
+// LaneWeight returns weight of a lane. For unknown lanes,
+// weight of the default lane is returned.
+func (conf *SchedulingConf) LaneWeight(name string) int {
+	if lane := conf.lane(name); lane != nil {
+		return lane.Weight
+	}
+	if lane := conf.lane(LaneDefault); lane != nil {
+		return lane.Weight
+	}
+	return dfltLaneWeight
+}
+
+// LaneWeights returns weights of all the configured lanes
+func (conf *SchedulingConf) LaneWeights() map[string]int {
+	ans := make(map[string]int)
+	for _, lane := range conf.Lanes {
+		ans[lane.Name] = lane.Weight
+	}
+	return ans
+}
+
+// Classify determines the origin of a request based on its headers
+// (`getHeader`), client IP address and whether it is a watchdog request.
+func (conf *SchedulingConf) Classify(
+	getHeader func(string) string,
+	clientIP string,
+	isWatchdog bool,
+) QueryOrigin {
+	ans := QueryOrigin{Lane: LaneDefault, ClientID: clientIP}
+	if conf.ClientIDHeader != "" {
+		if v := getHeader(conf.ClientIDHeader); v != "" {
+			ans.ClientID = v
+		}
+	}
+	if ans.ClientID == "" {
+		ans.ClientID = UnknownClientID
+	}
+	if isWatchdog {
+		ans.Lane = LaneWatchdog
+		return ans
+	}
+	for i := range conf.Lanes {
+		if conf.Lanes[i].matches(getHeader, ans.ClientID) {
+			ans.Lane = conf.Lanes[i].Name
+			break
+		}
+	}
+	return ans
+}
+
+// DefaultSchedulingConf creates a scheduling configuration
+// with just the "default" and "watchdog" lanes.
+func DefaultSchedulingConf() *SchedulingConf {
+	ans := &SchedulingConf{}
+	ans.addDefaultLanes()
+	return ans
+}
+
+// laneOrder creates a weighted random permutation of lanes. A consumer
+// then takes a query from the first non-empty lane in the order so each
+// lane with queued queries obtains a share of queries proportional
+// to its weight (and no lane starves). The `random` function must
+// return numbers from [0, 1).
+func laneOrder(weights map[string]int, random func() float64) []string {
+	lanes := make([]string, 0, len(weights))
+	for lane, w := range weights {
+		if w > 0 {
+			lanes = append(lanes, lane)
+		}
+	}
+	sort.Strings(lanes)
+	keys := make(map[string]float64, len(lanes))
+	for _, lane := range lanes {
+		// Efraimidis-Spirakis sampling; the smaller the key, the sooner the lane
+		keys[lane] = -math.Log(1-random()) / float64(weights[lane])
+	}
+	sort.SliceStable(lanes, func(i, j int) bool {
+		return keys[lanes[i]] < keys[lanes[j]]
+	})
+	return lanes
+}
+
+// LaneStats describes queries queued in a lane
+type LaneStats struct {
+	Name      string `json:"name"`
+	Weight    int    `json:"weight"`
+	NumQueued int    `json:"numQueued"`
+
+	// Clients maps clients to numbers of their queued queries
+	Clients map[string]int `json:"clients"`
+}
+
+// QueueStats describes the current state of the query queue
+type QueueStats struct {
+	Lanes []LaneStats `json:"lanes"`
+}
+
+// clientQueues holds queries of a single lane. Clients with queued
+// queries are served in a round-robin manner.
+type clientQueues struct {
+	ring    []string
+	queries map[string][]Query
+}
+
+func (cq *clientQueues) pop() (Query, bool) {
+	if len(cq.ring) == 0 {
+		return Query{}, false
+	}
+	client := cq.ring[0]
+	ans := cq.queries[client][0]
+	cq.queries[client] = cq.queries[client][1:]
+	cq.ring = cq.ring[1:]
+	if len(cq.queries[client]) > 0 {
+		cq.ring = append(cq.ring, client)
+
+	} else {
+		delete(cq.queries, client)
+	}
+	return ans, true
+}
+
+func (cq *clientQueues) remove(channel string) bool {
+	for client, queries := range cq.queries {
+		for i, q := range queries {
+			if q.Channel != channel {
+				continue
+			}
+			cq.queries[client] = append(queries[:i], queries[i+1:]...)
+			if len(cq.queries[client]) == 0 {
+				delete(cq.queries, client)
+				for j, c := range cq.ring {
+					if c == client {
+						cq.ring = append(cq.ring[:j], cq.ring[j+1:]...)
+						break
+					}
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// fairQueue is an in-memory implementation of the lane
+// and client based scheduling (see SchedulingConf).
+// It is not thread safe.
+type fairQueue struct {
+	weights map[string]int
+	lanes   map[string]*clientQueues
+}
+
+func (fq *fairQueue) push(q Query) {
+	if _, ok := fq.weights[q.Lane]; !ok {
+		q.Lane = LaneDefault
+	}
+	lane, ok := fq.lanes[q.Lane]
+	if !ok {
+		lane = &clientQueues{queries: make(map[string][]Query)}
+		fq.lanes[q.Lane] = lane
+	}
+	if len(lane.queries[q.ClientID]) == 0 {
+		lane.ring = append(lane.ring, q.ClientID)
+	}
+	lane.queries[q.ClientID] = append(lane.queries[q.ClientID], q)
+}
+
+func (fq *fairQueue) pop(random func() float64) (Query, bool) {
+	for _, name := range laneOrder(fq.weights, random) {
+		if lane, ok := fq.lanes[name]; ok {
+			if q, ok := lane.pop(); ok {
+				return q, true
+			}
+		}
+	}
+	return Query{}, false
+}
+
+func (fq *fairQueue) remove(channel string) bool {
+	for _, lane := range fq.lanes {
+		if lane.remove(channel) {
+			return true
+		}
+	}
+	return false
+}
+
+func (fq *fairQueue) stats() QueueStats {
+	ans := QueueStats{Lanes: make([]LaneStats, 0, len(fq.weights))}
+	for name, weight := range fq.weights {
+		item := LaneStats{Name: name, Weight: weight, Clients: make(map[string]int)}
+		if lane, ok := fq.lanes[name]; ok {
+			for client, queries := range lane.queries {
+				item.Clients[client] = len(queries)
+				item.NumQueued += len(queries)
+			}
+		}
+		ans.Lanes = append(ans.Lanes, item)
+	}
+	sort.Slice(ans.Lanes, func(i, j int) bool {
+		return ans.Lanes[i].Name < ans.Lanes[j].Name
+	})
+	return ans
+}
+
+func newFairQueue(conf *SchedulingConf) *fairQueue {
+	return &fairQueue{
+		weights: conf.LaneWeights(),
+		lanes:   make(map[string]*clientQueues),
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulingConfAddsDefaultLanes(t *testing.T) {
+	conf := SchedulingConf{Lanes: []LaneConf{{Name: "portal", Weight: 5}}}
+	assert.NoError(t, conf.ValidateAndDefaults())
+	assert.Equal(t, map[string]int{"portal": 5, LaneDefault: 1, LaneWatchdog: 1}, conf.LaneWeights())
+}
+
+func TestSchedulingConfRejectsInvalidLanes(t *testing.T) {
+	conf := SchedulingConf{Lanes: []LaneConf{{Name: "a"}, {Name: "a"}}}
+	assert.Error(t, conf.ValidateAndDefaults())
+	conf = SchedulingConf{Lanes: []LaneConf{{Name: "a:b"}}}
+	assert.Error(t, conf.ValidateAndDefaults())
+	conf = SchedulingConf{Lanes: []LaneConf{{Name: "a", Weight: -1}}}
+	assert.Error(t, conf.ValidateAndDefaults())
+}
+
+func TestSchedulingConfClassify(t *testing.T) {
+	conf := SchedulingConf{
+		ClientIDHeader: "X-Client-Id",
+		Lanes: []LaneConf{
+			{Name: "portal", Weight: 8, Header: "X-Portal", HeaderValue: "kontext"},
+			{Name: "aggregator", Weight: 2, Clients: []string{"10.0.0.5"}},
+		},
+	}
+	assert.NoError(t, conf.ValidateAndDefaults())
+	header := http.Header{}
+	origin := conf.Classify(header.Get, "10.0.0.5", false)
+	assert.Equal(t, QueryOrigin{Lane: "aggregator", ClientID: "10.0.0.5"}, origin)
+
+	header.Set("X-Portal", "kontext")
+	header.Set("X-Client-Id", "user42")
+	origin = conf.Classify(header.Get, "10.0.0.5", false)
+	assert.Equal(t, QueryOrigin{Lane: "portal", ClientID: "user42"}, origin)
+
+	origin = conf.Classify(header.Get, "10.0.0.5", true)
+	assert.Equal(t, LaneWatchdog, origin.Lane)
+
+	origin = conf.Classify(http.Header{}.Get, "", false)
+	assert.Equal(t, QueryOrigin{Lane: LaneDefault, ClientID: UnknownClientID}, origin)
+}
+
+func TestQueryOriginFromEmptyContext(t *testing.T) {
+	origin := QueryOriginFromContext(context.Background())
+	assert.Equal(t, QueryOrigin{Lane: LaneDefault, ClientID: UnknownClientID}, origin)
+}
+
+func TestLaneOrderFollowsWeights(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	first := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		order := laneOrder(map[string]int{"a": 3, "b": 1, "c": 0}, rnd.Float64)
+		assert.Len(t, order, 2)
+		first[order[0]]++
+	}
+	assert.InDelta(t, 0.75, float64(first["a"])/10000, 0.03)
+}
+
+func TestFairQueueRoundRobinsClients(t *testing.T) {
+	fq := newFairQueue(DefaultSchedulingConf())
+	fq.push(Query{Channel: "a1", ClientID: "a", Lane: LaneDefault})
+	fq.push(Query{Channel: "a2", ClientID: "a", Lane: LaneDefault})
+	fq.push(Query{Channel: "a3", ClientID: "a", Lane: LaneDefault})
+	fq.push(Query{Channel: "b1", ClientID: "b", Lane: "unknown"})
+	fq.push(Query{Channel: "b2", ClientID: "b", Lane: LaneDefault})
+
+	stats := fq.stats()
+	assert.Equal(t, LaneDefault, stats.Lanes[0].Name)
+	assert.Equal(t, 5, stats.Lanes[0].NumQueued)
+	assert.Equal(t, map[string]int{"a": 3, "b": 2}, stats.Lanes[0].Clients)
+
+	assert.True(t, fq.remove("a2"))
+	assert.False(t, fq.remove("a2"))
+
+	var channels []string
+	for {
+		q, ok := fq.pop(rand.Float64)
+		if !ok {
+			break
+		}
+		channels = append(channels, q.Channel)
+	}
+	assert.Equal(t, []string{"a1", "b1", "a3", "b2"}, channels)
+}
+
+func TestFairQueuePrefersHeavierLane(t *testing.T) {
+	conf := SchedulingConf{Lanes: []LaneConf{{Name: "portal", Weight: 9}}}
+	assert.NoError(t, conf.ValidateAndDefaults())
+	fq := newFairQueue(&conf)
+	for i := 0; i < 100; i++ {
+		fq.push(Query{ClientID: "aggregator", Lane: LaneDefault})
+		fq.push(Query{ClientID: "portal", Lane: "portal"})
+	}
+	rnd := rand.New(rand.NewSource(1))
+	numPortal := 0
+	for i := 0; i < 50; i++ {
+		q, ok := fq.pop(rnd.Float64)
+		assert.True(t, ok)
+		if q.Lane == "portal" {
+			numPortal++
+		}
+	}
+	assert.Greater(t, numPortal, 35)
+}
@@ -0,0 +1,215 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	streamFieldQuery = "query"
+
+	// maxReclaimedQueries limits number of abandoned queries
+	// a worker reclaims at once
+	maxReclaimedQueries = 10
+)
+
+// StreamQuery is a query obtained from the "streams" queue backend.
+// Once processed, it must be acknowledged via AckStreamQuery.
+type StreamQuery struct {
+	Query
+
+	// MsgID is an ID of the respective stream entry
+	MsgID string
+
+	// Deliveries is a number of times the query has been passed
+	// to a worker (including the current delivery)
+	Deliveries int64
+}
+
+// UsesStreams tells whether the adapter passes queries
+// to workers via Redis Streams
+func (a *Adapter) UsesStreams() bool {
+	return a.conf.QueueBackend == QueueBackendStreams
+}
+
+// StreamsClaimIdle returns the time after which an unacknowledged
+// query is considered abandoned
+func (a *Adapter) StreamsClaimIdle() time.Duration {
+	return time.Duration(a.conf.Streams.ClaimIdleSecs) * time.Second
+}
+
+// enqueueToStream adds the query to the stream and returns
+// ID of the respective stream entry
+func (a *Adapter) enqueueToStream(ctx context.Context, msg string) (string, error) {
+	return a.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: a.conf.Streams.Key,
+		Values: map[string]any{streamFieldQuery: msg},
+	}).Result()
+}
+
+// ensureConsumerGroup creates the configured consumer group (and the stream
+// itself) in case it does not exist yet.
+func (a *Adapter) ensureConsumerGroup() error {
+	err := a.redis.XGroupCreateMkStream(
+		a.ctx, a.conf.Streams.Key, a.conf.Streams.ConsumerGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group: %w", err)
+	}
+	return nil
+}
+
+func (a *Adapter) decodeStreamMessage(msg redis.XMessage) (StreamQuery, error) {
+	ans := StreamQuery{MsgID: msg.ID, Deliveries: 1}
+	rawQuery, ok := msg.Values[streamFieldQuery].(string)
+	if !ok {
+		return ans, fmt.Errorf("invalid stream entry %s", msg.ID)
+	}
+	q, err := DecodeQuery(rawQuery)
+	if err != nil {
+		return ans, fmt.Errorf("failed to deserialize query: %w", err)
+	}
+	ans.Query = q
+	return ans, nil
+}
+
+// ReadStreamQuery waits (at most for the `block` duration) for a new query
+// in the stream. The query is assigned to the `consumer` until acknowledged.
+// In case nothing is found, ErrorEmptyQueue is returned.
+func (a *Adapter) ReadStreamQuery(consumer string, block time.Duration) (StreamQuery, error) {
+	a.consumerGroupOnce.Do(func() {
+		a.consumerGroupErr = a.ensureConsumerGroup()
+	})
+	if a.consumerGroupErr != nil {
+		return StreamQuery{}, a.consumerGroupErr
+	}
+	streams, err := a.redis.XReadGroup(a.ctx, &redis.XReadGroupArgs{
+		Group:    a.conf.Streams.ConsumerGroup,
+		Consumer: consumer,
+		Streams:  []string{a.conf.Streams.Key, ">"},
+		Count:    1,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return StreamQuery{}, ErrorEmptyQueue
+
+	} else if err != nil {
+		return StreamQuery{}, fmt.Errorf("failed to read query from stream: %w", err)
+	}
+	if len(streams) == 0 || len(streams[0].Messages) == 0 {
+		return StreamQuery{}, ErrorEmptyQueue
+	}
+	msg := streams[0].Messages[0]
+	q, err := a.decodeStreamMessage(msg)
+	if err != nil {
+		// an invalid entry would be reclaimed over and over so we remove it
+		if err2 := a.AckStreamQuery(q); err2 != nil {
+			log.Error().Err(err2).Str("msgId", msg.ID).Msg("failed to remove invalid stream entry")
+		}
+		return StreamQuery{}, err
+	}
+	return q, nil
+}
+
+// ReclaimStreamQueries takes over queries which have not been acknowledged
+// for a configured time (typically because their worker crashed).
+// Queries which can still be retried are returned as `retry`, queries
+// exceeding the configured max. number of retries are returned as `expired`.
+// Expired queries are expected to be acknowledged by the caller after
+// their clients are notified about the failure.
+func (a *Adapter) ReclaimStreamQueries(consumer string) (retry, expired []StreamQuery, err error) {
+	msgs, _, err := a.redis.XAutoClaim(a.ctx, &redis.XAutoClaimArgs{
+		Stream:   a.conf.Streams.Key,
+		Group:    a.conf.Streams.ConsumerGroup,
+		MinIdle:  a.StreamsClaimIdle(),
+		Start:    "0-0",
+		Count:    maxReclaimedQueries,
+		Consumer: consumer,
+	}).Result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reclaim stream queries: %w", err)
+	}
+	for _, msg := range msgs {
+		q, err := a.decodeStreamMessage(msg)
+		if err != nil {
+			log.Error().Err(err).Str("msgId", msg.ID).Msg("removing invalid stream entry")
+			if err2 := a.AckStreamQuery(q); err2 != nil {
+				log.Error().Err(err2).Str("msgId", msg.ID).Msg("failed to remove invalid stream entry")
+			}
+			continue
+		}
+		pending, err := a.redis.XPendingExt(a.ctx, &redis.XPendingExtArgs{
+			Stream: a.conf.Streams.Key,
+			Group:  a.conf.Streams.ConsumerGroup,
+			Start:  msg.ID,
+			End:    msg.ID,
+			Count:  1,
+		}).Result()
+		if err != nil {
+			return retry, expired, fmt.Errorf("failed to reclaim stream queries: %w", err)
+		}
+		if len(pending) > 0 {
+			q.Deliveries = pending[0].RetryCount
+		}
+		if q.Deliveries-1 > int64(a.conf.Streams.MaxRetries) {
+			expired = append(expired, q)
+
+		} else {
+			retry = append(retry, q)
+		}
+	}
+	return
+}
+
+// RefreshStreamQuery resets idle time of a query being processed
+// by the `consumer` so other workers do not consider it abandoned
+// (see StreamsClaimIdle). Unlike reclaiming, refreshing does not
+// increase the number of the query's deliveries.
+func (a *Adapter) RefreshStreamQuery(consumer string, q StreamQuery) error {
+	err := a.redis.XClaimJustID(a.ctx, &redis.XClaimArgs{
+		Stream:   a.conf.Streams.Key,
+		Group:    a.conf.Streams.ConsumerGroup,
+		Consumer: consumer,
+		Messages: []string{q.MsgID},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to refresh stream query %s: %w", q.MsgID, err)
+	}
+	return nil
+}
+
+// AckStreamQuery confirms a query has been processed and removes it
+// from the stream.
+func (a *Adapter) AckStreamQuery(q StreamQuery) error {
+	_, err := a.redis.TxPipelined(a.ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(a.ctx, a.conf.Streams.Key, a.conf.Streams.ConsumerGroup, q.MsgID)
+		pipe.XDel(a.ctx, a.conf.Streams.Key, q.MsgID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to acknowledge stream query %s: %w", q.MsgID, err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFakeStreamsAdapter(t *testing.T) (*Adapter, *fakeRedis) {
+	adapter, fr := newFakeRedisAdapter(t)
+	adapter.conf = &Conf{
+		QueueBackend: QueueBackendStreams,
+		Streams: StreamsConf{
+			Key:           "mquerysru:queries",
+			ConsumerGroup: "mquerysru-workers",
+			MaxRetries:    2,
+			ClaimIdleSecs: 60,
+		},
+	}
+	return adapter, fr
+}
+
+func enqueueTestStreamQuery(t *testing.T, adapter *Adapter, channel string) string {
+	var msg bytes.Buffer
+	assert.NoError(t, gob.NewEncoder(&msg).Encode(Query{Channel: channel, Func: FuncConcExample}))
+	msgID, err := adapter.enqueueToStream(context.Background(), msg.String())
+	assert.NoError(t, err)
+	return msgID
+}
+
+// moveTime moves the time of the fake Redis server by `d`
+func moveTime(fr *fakeRedis, d time.Duration) {
+	now := fr.now()
+	fr.now = func() time.Time { return now.Add(d) }
+}
+
+func TestReadStreamQuery(t *testing.T) {
+	adapter, _ := newFakeStreamsAdapter(t)
+	_, err := adapter.ReadStreamQuery("w1", time.Second)
+	assert.ErrorIs(t, err, ErrorEmptyQueue)
+
+	msgID := enqueueTestStreamQuery(t, adapter, "ch1")
+	q, err := adapter.ReadStreamQuery("w1", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, msgID, q.MsgID)
+	assert.Equal(t, "ch1", q.Channel)
+	assert.Equal(t, int64(1), q.Deliveries)
+
+	_, err = adapter.ReadStreamQuery("w2", time.Second)
+	assert.ErrorIs(t, err, ErrorEmptyQueue)
+}
+
+func TestReclaimStreamQueries(t *testing.T) {
+	adapter, fr := newFakeStreamsAdapter(t)
+	enqueueTestStreamQuery(t, adapter, "ch1")
+	_, err := adapter.ReadStreamQuery("w1", time.Second)
+	assert.NoError(t, err)
+
+	// the query is not idle long enough yet
+	retry, expired, err := adapter.ReclaimStreamQueries("w2")
+	assert.NoError(t, err)
+	assert.Empty(t, retry)
+	assert.Empty(t, expired)
+
+	moveTime(fr, adapter.StreamsClaimIdle())
+	retry, expired, err = adapter.ReclaimStreamQueries("w2")
+	assert.NoError(t, err)
+	assert.Empty(t, expired)
+	if assert.Len(t, retry, 1) {
+		assert.Equal(t, "ch1", retry[0].Channel)
+		assert.Equal(t, int64(2), retry[0].Deliveries)
+	}
+}
+
+func TestReclaimStreamQueriesRetryCount(t *testing.T) {
+	adapter, fr := newFakeStreamsAdapter(t)
+	enqueueTestStreamQuery(t, adapter, "ch1")
+	_, err := adapter.ReadStreamQuery("w1", time.Second)
+	assert.NoError(t, err)
+
+	// MaxRetries is 2, i.e. the query can be delivered 3 times
+	for i := 0; i < adapter.conf.Streams.MaxRetries; i++ {
+		moveTime(fr, adapter.StreamsClaimIdle())
+		retry, expired, err := adapter.ReclaimStreamQueries("w2")
+		assert.NoError(t, err)
+		assert.Len(t, retry, 1)
+		assert.Empty(t, expired)
+	}
+	moveTime(fr, adapter.StreamsClaimIdle())
+	retry, expired, err := adapter.ReclaimStreamQueries("w2")
+	assert.NoError(t, err)
+	assert.Empty(t, retry)
+	if assert.Len(t, expired, 1) {
+		assert.Equal(t, int64(4), expired[0].Deliveries)
+		assert.NoError(t, adapter.AckStreamQuery(expired[0]))
+	}
+	moveTime(fr, adapter.StreamsClaimIdle())
+	retry, expired, err = adapter.ReclaimStreamQueries("w2")
+	assert.NoError(t, err)
+	assert.Empty(t, retry)
+	assert.Empty(t, expired)
+}
+
+func TestRefreshStreamQueryPreventsReclaim(t *testing.T) {
+	adapter, fr := newFakeStreamsAdapter(t)
+	enqueueTestStreamQuery(t, adapter, "ch1")
+	q, err := adapter.ReadStreamQuery("w1", time.Second)
+	assert.NoError(t, err)
+
+	moveTime(fr, adapter.StreamsClaimIdle()/2)
+	assert.NoError(t, adapter.RefreshStreamQuery("w1", q))
+	moveTime(fr, adapter.StreamsClaimIdle()/2+time.Second)
+	retry, expired, err := adapter.ReclaimStreamQueries("w2")
+	assert.NoError(t, err)
+	assert.Empty(t, retry)
+	assert.Empty(t, expired)
+
+	// refreshing does not count as another delivery
+	moveTime(fr, adapter.StreamsClaimIdle())
+	retry, _, err = adapter.ReclaimStreamQueries("w2")
+	assert.NoError(t, err)
+	if assert.Len(t, retry, 1) {
+		assert.Equal(t, int64(2), retry[0].Deliveries)
+	}
+}
+
+func TestAckStreamQuery(t *testing.T) {
+	adapter, fr := newFakeStreamsAdapter(t)
+	enqueueTestStreamQuery(t, adapter, "ch1")
+	q, err := adapter.ReadStreamQuery("w1", time.Second)
+	assert.NoError(t, err)
+	assert.NoError(t, adapter.AckStreamQuery(q))
+
+	st := fr.streams[adapter.conf.Streams.Key]
+	assert.Empty(t, st.pending)
+	assert.Empty(t, st.messages)
+	moveTime(fr, adapter.StreamsClaimIdle())
+	retry, expired, err := adapter.ReclaimStreamQueries("w2")
+	assert.NoError(t, err)
+	assert.Empty(t, retry)
+	assert.Empty(t, expired)
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package result
+
+import (
+	"sort"
+
+	"github.com/czcorpus/mquery-sru/mango"
+)
+
+// MergeAttrValues merges attribute values obtained from multiple
+// corpora (via mango.GetAttrValues with the same `fromValue`, `numBefore`
+// and `numAfter`). Frequencies of matching values are summed up
+// and the result is again limited to at most `numBefore` values lower
+// than `fromValue` followed by at most `numAfter` values greater
+// or equal to `fromValue`.
+func MergeAttrValues(
+	fromValue string,
+	numBefore, numAfter int,
+	values ...[]mango.GoAttrValue,
+) []mango.GoAttrValue {
+	freqs := make(map[string]int64)
+	for _, vals := range values {
+		for _, v := range vals {
+			freqs[v.Value] += v.Freq
+		}
+	}
+	ans := make([]mango.GoAttrValue, 0, len(freqs))
+	for v, f := range freqs {
+		ans = append(ans, mango.GoAttrValue{Value: v, Freq: f})
+	}
+	sort.Slice(ans, func(i, j int) bool {
+		return ans[i].Value < ans[j].Value
+	})
+	split := sort.Search(len(ans), func(i int) bool {
+		return ans[i].Value >= fromValue
+	})
+	return ans[max(0, split-numBefore):min(len(ans), split+numAfter)]
+}
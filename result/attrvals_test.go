@@ -0,0 +1,61 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package result
+
+import (
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeAttrValuesSumsFrequencies(t *testing.T) {
+	ans := MergeAttrValues(
+		"",
+		0,
+		10,
+		[]mango.GoAttrValue{{Value: "ADJ", Freq: 3}, {Value: "NOUN", Freq: 10}},
+		[]mango.GoAttrValue{{Value: "NOUN", Freq: 5}, {Value: "VERB", Freq: 7}},
+	)
+	assert.Equal(
+		t,
+		[]mango.GoAttrValue{{Value: "ADJ", Freq: 3}, {Value: "NOUN", Freq: 15}, {Value: "VERB", Freq: 7}},
+		ans,
+	)
+}
+
+func TestMergeAttrValuesWindow(t *testing.T) {
+	ans := MergeAttrValues(
+		"c",
+		1,
+		2,
+		[]mango.GoAttrValue{{Value: "a", Freq: 1}, {Value: "b", Freq: 1}, {Value: "d", Freq: 1}},
+		[]mango.GoAttrValue{{Value: "b", Freq: 1}, {Value: "c", Freq: 1}, {Value: "e", Freq: 1}},
+	)
+	assert.Equal(
+		t,
+		[]mango.GoAttrValue{{Value: "b", Freq: 2}, {Value: "c", Freq: 1}, {Value: "d", Freq: 1}},
+		ans,
+	)
+}
+
+func TestMergeAttrValuesNoSources(t *testing.T) {
+	ans := MergeAttrValues("foo", 5, 5)
+	assert.Empty(t, ans)
+}
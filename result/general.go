@@ -29,10 +29,14 @@ const (
 
 type JobLog struct {
 	WorkerID string    `json:"workerId"`
+	Slot     int       `json:"slot"`
+	NumSlots int       `json:"numSlots"`
+	Lane     string    `json:"lane"`
 	Func     string    `json:"func"`
 	Begin    time.Time `json:"begin"`
 	End      time.Time `json:"end"`
 	Err      error     `json:"error"`
+	CacheHit bool      `json:"cacheHit"`
 }
 
 func (jl *JobLog) ToJSON() (string, error) {
@@ -0,0 +1,210 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package result
+
+import (
+	"errors"
+
+	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/query"
+)
+
+// ConcFetcher publishes a concordance query for a resource
+// and returns a channel the result will be sent to
+type ConcFetcher func(rsc string, fromLine, maxItems int) (<-chan ConcResult, error)
+
+// RscMergeInfo describes a resource involved in a merged result
+type RscMergeInfo struct {
+	Rsc      string
+	ConcSize int
+	Query    string
+	Err      error
+}
+
+type MergedLine struct {
+	Rsc  string
+	Line *concordance.Line
+}
+
+// MergedConc is a page of concordance lines merged from
+// multiple resources.
+type MergedConc struct {
+	Lines []MergedLine
+
+	// Resources contains information about individual
+	// resources in the order they were specified
+	Resources []RscMergeInfo
+
+	// TotalSize is a sum of concordance sizes of all the
+	// resources which have been searched successfully
+	TotalSize int
+}
+
+// HasFatalError means that each resource has an error and thus
+// there is no source we can load lines from.
+func (mc *MergedConc) HasFatalError() bool {
+	for _, v := range mc.Resources {
+		if v.Err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (mc *MergedConc) GetFirstError() error {
+	for _, v := range mc.Resources {
+		if v.Err != nil {
+			return v.Err
+		}
+	}
+	return nil
+}
+
+// ----
+
+type fetchedLines struct {
+	from  int
+	lines []concordance.Line
+}
+
+func (fl fetchedLines) covers(rng query.LineRange) bool {
+	return fl.from <= rng.From && rng.To <= fl.from+len(fl.lines)
+}
+
+func (fl fetchedLines) slice(rng query.LineRange) []concordance.Line {
+	return fl.lines[rng.From-fl.from : rng.To-fl.from]
+}
+
+// FetchMergedConc obtains a page of a result merged from multiple resources
+// according to the specified strategy. As the merge strategies require
+// concordance sizes to calculate line ranges of individual resources,
+// the search is performed in two phases:
+//  1. concordance sizes are obtained. For the "round robin" strategy,
+//     lines are fetched along with the sizes using ranges calculated by
+//     CalculatePartialRanges (which are exact for resources of sufficient
+//     sizes). Other strategies fetch the sizes only.
+//  2. exact ranges are calculated and lines are fetched only for resources
+//     where the first phase does not cover the required range.
+//
+// The returned error means that it was not possible to publish a query
+// (errors of individual resources are reported via MergedConc.Resources).
+func FetchMergedConc(
+	strategy query.MergeStrategy,
+	rscList []string,
+	offset, limit int,
+	fetch ConcFetcher,
+) (*MergedConc, error) {
+	ans := &MergedConc{
+		Lines:     make([]MergedLine, 0, limit),
+		Resources: make([]RscMergeInfo, len(rscList)),
+	}
+	rscIdx := make(map[string]int)
+	for i, rsc := range rscList {
+		rscIdx[rsc] = i
+		ans.Resources[i].Rsc = rsc
+	}
+
+	// phase 1
+	fetched := make([]fetchedLines, len(rscList))
+	var ranges query.LineRangeList
+	var numPhase1Lines int
+	if strategy == query.MergeRoundRobin {
+		// each resource of a sufficient size provides
+		// at most one line per round
+		ranges = query.CalculatePartialRanges(rscList, offset, limit)
+		numPhase1Lines = (limit + len(rscList) - 1) / len(rscList)
+
+	} else {
+		ranges = make(query.LineRangeList, len(rscList))
+		for i, rsc := range rscList {
+			ranges[i] = query.LineRange{Rsc: rsc}
+		}
+	}
+	waits := make([]<-chan ConcResult, len(ranges))
+	for i, rng := range ranges {
+		wait, err := fetch(rng.Rsc, rng.From, numPhase1Lines)
+		if err != nil {
+			return nil, err
+		}
+		waits[i] = wait
+	}
+	sizes := make([]int, len(rscList))
+	for i, wait := range waits {
+		res := <-wait
+		idx := rscIdx[ranges[i].Rsc]
+		ans.Resources[idx].Query = res.Query
+		if res.Error != nil && !errors.Is(res.Error, mango.ErrRowsRangeOutOfConc) {
+			ans.Resources[idx].Err = res.Error
+			continue
+		}
+		ans.Resources[idx].ConcSize = res.ConcSize
+		sizes[idx] = res.ConcSize
+		fetched[idx] = fetchedLines{from: ranges[i].From, lines: res.Lines}
+	}
+
+	// phase 2
+	plan := query.PlanMerge(strategy, rscList, sizes, offset, limit)
+	waits = make([]<-chan ConcResult, len(rscList))
+	for i, rng := range plan.Ranges {
+		if rng.From == rng.To || fetched[i].covers(rng) {
+			continue
+		}
+		wait, err := fetch(rng.Rsc, rng.From, rng.To-rng.From)
+		if err != nil {
+			return nil, err
+		}
+		waits[i] = wait
+	}
+	rscLines := make([][]concordance.Line, len(rscList))
+	for i, rng := range plan.Ranges {
+		if waits[i] == nil {
+			if rng.From < rng.To {
+				rscLines[i] = fetched[i].slice(rng)
+			}
+			continue
+		}
+		res := <-waits[i]
+		if res.Error != nil {
+			ans.Resources[i].Err = res.Error
+			continue
+		}
+		rscLines[i] = res.Lines
+	}
+	// resources failing in any of the phases are not counted
+	for _, rsc := range ans.Resources {
+		if rsc.Err == nil {
+			ans.TotalSize += rsc.ConcSize
+		}
+	}
+
+	// merging
+	nextLine := make([]int, len(rscList))
+	for _, rsc := range plan.Order {
+		idx := rscIdx[rsc]
+		if nextLine[idx] < len(rscLines[idx]) {
+			ans.Lines = append(
+				ans.Lines,
+				MergedLine{Rsc: rsc, Line: &rscLines[idx][nextLine[idx]]},
+			)
+		}
+		nextLine[idx]++
+	}
+	return ans, nil
+}
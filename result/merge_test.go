@@ -0,0 +1,160 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package result
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/query"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeCorpora struct {
+	sizes   map[string]int
+	failing map[string]bool
+
+	// failingLines contains resources where only fetching
+	// lines fails (i.e. searches for sizes work)
+	failingLines map[string]bool
+
+	numCalled int
+	numLines  int
+}
+
+// fetch behaves like mango.GetConcordance - i.e. it returns
+// the ErrRowsRangeOutOfConc error along with a valid concordance size
+func (fc *fakeCorpora) fetch(rsc string, fromLine, maxItems int) (<-chan ConcResult, error) {
+	fc.numCalled++
+	ans := make(chan ConcResult, 1)
+	res := ConcResult{ConcSize: fc.sizes[rsc], Lines: []concordance.Line{}}
+	if fc.failing[rsc] || fc.failingLines[rsc] && maxItems > 0 {
+		res.Error = errors.New("search failed")
+
+	} else if fromLine > fc.sizes[rsc] {
+		res.Error = mango.ErrRowsRangeOutOfConc
+
+	} else {
+		for i := fromLine; i < min(fromLine+maxItems, fc.sizes[rsc]); i++ {
+			res.Lines = append(res.Lines, concordance.Line{Ref: fmt.Sprintf("%s:%d", rsc, i)})
+		}
+	}
+	fc.numLines += len(res.Lines)
+	ans <- res
+	close(ans)
+	return ans, nil
+}
+
+func mergedRefs(mc *MergedConc) []string {
+	ans := make([]string, len(mc.Lines))
+	for i, v := range mc.Lines {
+		ans[i] = v.Line.Ref
+	}
+	return ans
+}
+
+func TestFetchMergedConcFirstPageSinglePhase(t *testing.T) {
+	fc := &fakeCorpora{sizes: map[string]int{"c1": 2, "c2": 10}}
+	ans, err := FetchMergedConc(query.MergeRoundRobin, []string{"c1", "c2"}, 0, 5, fc.fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c1:0", "c2:0", "c1:1", "c2:1", "c2:2"}, mergedRefs(ans))
+	assert.Equal(t, 12, ans.TotalSize)
+	assert.Equal(t, 2, fc.numCalled)
+}
+
+func TestFetchMergedConcPagesAreContinuous(t *testing.T) {
+	fc := &fakeCorpora{sizes: map[string]int{"c1": 3, "c2": 0, "c3": 8}}
+	for _, strategy := range []query.MergeStrategy{
+		query.MergeRoundRobin, query.MergeSequential, query.MergeProportional} {
+		all := make([]string, 0, 11)
+		for offset := 0; offset < 11; offset += 4 {
+			ans, err := FetchMergedConc(strategy, []string{"c1", "c2", "c3"}, offset, 4, fc.fetch)
+			assert.NoError(t, err)
+			all = append(all, mergedRefs(ans)...)
+		}
+		assert.Len(t, all, 11, strategy)
+		assert.ElementsMatch(
+			t,
+			[]string{
+				"c1:0", "c1:1", "c1:2",
+				"c3:0", "c3:1", "c3:2", "c3:3", "c3:4", "c3:5", "c3:6", "c3:7",
+			},
+			all,
+			strategy,
+		)
+	}
+}
+
+func TestFetchMergedConcSequential(t *testing.T) {
+	fc := &fakeCorpora{sizes: map[string]int{"c1": 3, "c2": 10}}
+	ans, err := FetchMergedConc(query.MergeSequential, []string{"c1", "c2"}, 2, 3, fc.fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c1:2", "c2:0", "c2:1"}, mergedRefs(ans))
+}
+
+func TestFetchMergedConcFailedResource(t *testing.T) {
+	fc := &fakeCorpora{
+		sizes:   map[string]int{"c1": 3, "c2": 10},
+		failing: map[string]bool{"c1": true},
+	}
+	ans, err := FetchMergedConc(query.MergeRoundRobin, []string{"c1", "c2"}, 0, 3, fc.fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c2:0", "c2:1", "c2:2"}, mergedRefs(ans))
+	assert.Error(t, ans.Resources[0].Err)
+	assert.False(t, ans.HasFatalError())
+	assert.Equal(t, 10, ans.TotalSize)
+}
+
+func TestFetchMergedConcFailedSecondPhase(t *testing.T) {
+	fc := &fakeCorpora{
+		sizes:        map[string]int{"c1": 3, "c2": 10},
+		failingLines: map[string]bool{"c2": true},
+	}
+	ans, err := FetchMergedConc(query.MergeSequential, []string{"c1", "c2"}, 0, 5, fc.fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c1:0", "c1:1", "c1:2"}, mergedRefs(ans))
+	assert.NoError(t, ans.Resources[0].Err)
+	assert.Error(t, ans.Resources[1].Err)
+	assert.False(t, ans.HasFatalError())
+	assert.Equal(t, 3, ans.TotalSize)
+}
+
+func TestFetchMergedConcFetchesOnlyNeededLines(t *testing.T) {
+	for _, strategy := range []query.MergeStrategy{
+		query.MergeRoundRobin, query.MergeSequential, query.MergeProportional} {
+		fc := &fakeCorpora{sizes: map[string]int{"c1": 100, "c2": 100, "c3": 100}}
+		ans, err := FetchMergedConc(strategy, []string{"c1", "c2", "c3"}, 20, 10, fc.fetch)
+		assert.NoError(t, err)
+		assert.Len(t, ans.Lines, 10, strategy)
+		assert.Equal(t, 300, ans.TotalSize, strategy)
+		if strategy == query.MergeRoundRobin {
+			// the first phase covers all the resources
+			assert.Equal(t, 3, fc.numCalled, strategy)
+			assert.Equal(t, 12, fc.numLines, strategy)
+
+		} else {
+			// the first phase fetches the sizes only
+			assert.LessOrEqual(t, fc.numCalled, 6, strategy)
+			assert.Equal(t, 10, fc.numLines, strategy)
+		}
+	}
+}
@@ -20,6 +20,7 @@ package result
 
 import (
 	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/mango"
 )
 
 const (
@@ -31,13 +32,51 @@ const (
 	ResultTypeError        = "Error"
 )
 
+// WorkerResult is implemented by all the result types
+// a worker is able to produce
+type WorkerResult interface {
+	GetError() error
+	SetError(err error)
+}
+
+// ----
+
 type ConcResult struct {
 	Lines    []concordance.Line `json:"lines"`
 	ConcSize int                `json:"concSize"`
 	Query    string             `json:"query"`
 	Error    error              `json:"error"`
+
+	// CacheHit is true if the result has been
+	// obtained from a cache (see rdb.ConcCache)
+	CacheHit bool `json:"cacheHit"`
 }
 
 func (res *ConcResult) NumLines() int {
 	return len(res.Lines)
 }
+
+func (res *ConcResult) GetError() error {
+	return res.Error
+}
+
+func (res *ConcResult) SetError(err error) {
+	res.Error = err
+}
+
+// ----
+
+// AttrValuesResult contains values of a positional
+// attribute as obtained for the "scan" operation
+type AttrValuesResult struct {
+	Values []mango.GoAttrValue `json:"values"`
+	Error  error               `json:"error"`
+}
+
+func (res *AttrValuesResult) GetError() error {
+	return res.Error
+}
+
+func (res *AttrValuesResult) SetError(err error) {
+	res.Error = err
+}
@@ -22,20 +22,33 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"path/filepath"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/general"
 	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/metrics"
 	"github.com/czcorpus/mquery-sru/rdb"
 	"github.com/czcorpus/mquery-sru/result"
 
-	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog/log"
 )
 
 const (
 	DefaultTickerInterval = 2 * time.Second
-	MaxFreqResultItems    = 100
+
+	// listenerCheckInterval specifies how often a worker checks
+	// whether someone still waits for a result of a running job
+	listenerCheckInterval = time.Second
+
+	// streamRefreshesPerClaimIdle specifies how many times a worker
+	// refreshes a running stream query within the claim idle time
+	streamRefreshesPerClaimIdle = 3
+
+	MaxFreqResultItems = 100
 )
 
 type jobLogger interface {
@@ -43,39 +56,136 @@ type jobLogger interface {
 }
 
 type Worker struct {
-	ID         string
-	messages   <-chan *redis.Message
-	radapter   *rdb.Adapter
-	ctx        context.Context
-	ticker     *time.Ticker
-	jobLogger  jobLogger
-	currJobLog *result.JobLog
-}
-
-func (w *Worker) publishResult(res *result.ConcResult, channel string) error {
-	w.currJobLog.End = time.Now()
-	w.currJobLog.Err = res.Error
-	w.jobLogger.Log(*w.currJobLog)
-	w.currJobLog = nil
-	return w.radapter.PublishResult(channel, res)
-}
-
-func (w *Worker) tryNextQuery() error {
-	time.Sleep(time.Duration(rand.Intn(40)) * time.Millisecond)
-	query, err := w.radapter.DequeueQuery()
-	if err == rdb.ErrorEmptyQueue {
-		return nil
+	ID       string
+	version  general.VersionInfo
+	started  time.Time
+	messages <-chan string
+	queue    rdb.QueryConsumer
 
-	} else if err != nil {
-		return err
+	// streams is set only if the queue backend
+	// uses Redis Streams
+	streams rdb.StreamQueryConsumer
+
+	// cache is set only if the queue backend
+	// is able to cache results
+	cache rdb.ConcCache
+
+	// heartbeats is set only if the queue backend
+	// supports worker heartbeats
+	heartbeats rdb.WorkerHeartbeats
+
+	// ctx controls accepting of new queries. Once cancelled,
+	// the worker waits for its running jobs to finish (see Listen)
+	ctx       context.Context
+	ticker    *time.Ticker
+	jobLogger jobLogger
+
+	// freeSlots contains IDs of job slots available for new jobs.
+	// The number of slots limits the number of concurrent jobs.
+	freeSlots chan int
+
+	// slotReleased notifies about a finished job so the worker
+	// can look for another queued query immediately
+	slotReleased chan struct{}
+
+	// runningJobs tracks jobs in progress
+	runningJobs sync.WaitGroup
+
+	// jobs describes running jobs by their slots
+	// (reported along with heartbeats)
+	jobs   map[int]rdb.WorkerJob
+	jobsMu sync.Mutex
+}
+
+func (w *Worker) publishResult(jobLog *result.JobLog, res result.WorkerResult, channel string) error {
+	jobLog.End = time.Now()
+	jobLog.Err = res.GetError()
+	if concRes, ok := res.(*result.ConcResult); ok {
+		jobLog.CacheHit = concRes.CacheHit
+	}
+	w.jobLogger.Log(*jobLog)
+	metrics.ObserveJob(jobLog.WorkerID, jobLog.Func, jobLog.End.Sub(jobLog.Begin), jobLog.Err)
+	return w.queue.PublishResult(channel, res)
+}
+
+// NumSlots returns the number of concurrent jobs the worker can run
+func (w *Worker) NumSlots() int {
+	return cap(w.freeSlots)
+}
+
+// NumRunningJobs returns the number of jobs currently in progress
+func (w *Worker) NumRunningJobs() int {
+	return cap(w.freeSlots) - len(w.freeSlots)
+}
+
+// acquireSlot waits for a free job slot. In case the worker
+// is stopped meanwhile, false is returned.
+func (w *Worker) acquireSlot() (int, bool) {
+	select {
+	case slot := <-w.freeSlots:
+		return slot, true
+	case <-w.ctx.Done():
+		return 0, false
+	}
+}
+
+// startJob runs the `job` in a separate goroutine using an already
+// acquired slot. Once the job is finished, the slot is released.
+func (w *Worker) startJob(slot int, job func()) {
+	w.runningJobs.Add(1)
+	go func() {
+		defer func() {
+			w.freeSlots <- slot
+			w.runningJobs.Done()
+			select {
+			case w.slotReleased <- struct{}{}:
+			default:
+			}
+		}()
+		job()
+	}()
+}
+
+// dispatchQueries starts queued queries in free slots
+// until there are either no free slots or no queued queries.
+func (w *Worker) dispatchQueries() {
+	for {
+		var slot int
+		select {
+		case slot = <-w.freeSlots:
+		default:
+			// all the slots are busy - once a job finishes,
+			// we will be notified via slotReleased
+			return
+		}
+		time.Sleep(time.Duration(rand.Intn(40)) * time.Millisecond)
+		query, err := w.queue.DequeueQuery()
+		if err != nil {
+			w.freeSlots <- slot
+			if err != rdb.ErrorEmptyQueue {
+				log.Error().Err(err).Msg("failed to process query")
+			}
+			return
+		}
+		w.startJob(slot, func() {
+			if err := w.processQuery(slot, query); err != nil {
+				log.Error().
+					Err(err).
+					Int("slot", slot).
+					Msg("failed to process query")
+			}
+		})
 	}
+}
+
+func (w *Worker) processQuery(slot int, query rdb.Query) error {
 	log.Debug().
 		Str("channel", query.Channel).
 		Str("func", query.Func).
 		Any("args", query.Args).
 		Msg("received query")
 
-	isActive, err := w.radapter.SomeoneListens(query)
+	isActive, err := w.queue.SomeoneListens(query)
 	if err != nil {
 		return err
 	}
@@ -88,44 +198,305 @@ func (w *Worker) tryNextQuery() error {
 		return nil
 	}
 
-	w.currJobLog = &result.JobLog{
+	jobLog := &result.JobLog{
 		WorkerID: w.ID,
+		Slot:     slot,
+		NumSlots: w.NumSlots(),
+		Lane:     query.Lane,
 		Func:     query.Func,
 		Begin:    time.Now(),
 	}
-	ans := w.ConcResult(query.Args)
-	if err := w.publishResult(ans, query.Channel); err != nil {
+	// the job context is intentionally not derived from the worker's
+	// context so a stopped worker can finish its running jobs
+	jobCtx, cancelJob := context.WithCancel(context.Background())
+	defer cancelJob()
+	w.registerJob(slot, query, jobLog.Begin)
+	defer w.unregisterJob(slot)
+	go w.watchListeners(jobCtx, cancelJob, query)
+	if err := w.publishResult(jobLog, w.runQuery(jobCtx, query), query.Channel); err != nil {
 		return fmt.Errorf("failed to publish result: %w", err)
 	}
 	return nil
 }
 
-func (w *Worker) Listen() {
+// registerJob makes the running job visible
+// in the worker's status
+func (w *Worker) registerJob(slot int, query rdb.Query, start time.Time) {
+	job := rdb.WorkerJob{
+		Slot:    slot,
+		Func:    query.Func,
+		Lane:    query.Lane,
+		Channel: query.Channel,
+		Start:   start,
+	}
+	switch args := query.Args.(type) {
+	case rdb.ConcQueryArgs:
+		job.Corpus = filepath.Base(args.CorpusPath)
+		job.Query = args.Query
+	case rdb.AttrValuesQueryArgs:
+		job.Corpus = filepath.Base(args.CorpusPath)
+	}
+	w.jobsMu.Lock()
+	w.jobs[slot] = job
+	w.jobsMu.Unlock()
+}
+
+func (w *Worker) unregisterJob(slot int) {
+	w.jobsMu.Lock()
+	delete(w.jobs, slot)
+	w.jobsMu.Unlock()
+}
+
+// Status returns the current state of the worker
+func (w *Worker) Status() rdb.WorkerStatus {
+	w.jobsMu.Lock()
+	jobs := make([]rdb.WorkerJob, 0, len(w.jobs))
+	for _, job := range w.jobs {
+		jobs = append(jobs, job)
+	}
+	w.jobsMu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Slot < jobs[j].Slot })
+	return rdb.WorkerStatus{
+		ID:            w.ID,
+		Version:       w.version,
+		Started:       w.started,
+		LastHeartbeat: time.Now(),
+		NumSlots:      w.NumSlots(),
+		Draining:      w.ctx.Err() != nil,
+		Jobs:          jobs,
+	}
+}
+
+// watchListeners periodically checks whether someone still waits
+// for the query result and if not, it cancels the job.
+func (w *Worker) watchListeners(jobCtx context.Context, cancelJob context.CancelFunc, query rdb.Query) {
+	ticker := time.NewTicker(listenerCheckInterval)
+	defer ticker.Stop()
 	for {
 		select {
-		case <-w.ticker.C:
-			if err := w.tryNextQuery(); err != nil {
-				log.Error().
-					Err(err).
-					Msg("failed to process query")
+		case <-jobCtx.Done():
+			return
+		case <-ticker.C:
+			isActive, err := w.queue.SomeoneListens(query)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to check query listeners")
+
+			} else if !isActive {
+				log.Warn().
+					Str("func", query.Func).
+					Str("channel", query.Channel).
+					Msg("nobody waits for the result anymore, cancelling the job")
+				cancelJob()
+				return
+			}
+		}
+	}
+}
+
+func (w *Worker) runQuery(ctx context.Context, query rdb.Query) result.WorkerResult {
+	var ans result.WorkerResult
+	switch query.Func {
+	case rdb.FuncConcExample:
+		args, ok := query.Args.(rdb.ConcQueryArgs)
+		if !ok {
+			ans = &result.ConcResult{Error: fmt.Errorf("invalid arguments for %s", query.Func)}
+			break
+		}
+		ans = w.ConcResult(ctx, args)
+	case rdb.FuncAttrValues:
+		args, ok := query.Args.(rdb.AttrValuesQueryArgs)
+		if !ok {
+			ans = &result.AttrValuesResult{Error: fmt.Errorf("invalid arguments for %s", query.Func)}
+			break
+		}
+		ans = w.AttrValues(args)
+	default:
+		ans = &result.ConcResult{Error: fmt.Errorf("unknown worker function %s", query.Func)}
+	}
+	return ans
+}
+
+// errorResult creates an empty result of a type matching
+// the query function with the provided error
+func errorResult(query rdb.Query, err error) result.WorkerResult {
+	if query.Func == rdb.FuncAttrValues {
+		return &result.AttrValuesResult{Error: err}
+	}
+	return &result.ConcResult{Error: err}
+}
+
+// processStreamQuery processes a query obtained from the "streams"
+// queue backend. The query is acknowledged only if its result has
+// been published. Otherwise it stays pending and it will be reclaimed
+// by another worker.
+func (w *Worker) processStreamQuery(slot int, query rdb.StreamQuery) {
+	stopRefresh := make(chan struct{})
+	go w.refreshStreamQuery(query, stopRefresh)
+	err := w.processQuery(slot, query.Query)
+	close(stopRefresh)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Int("slot", slot).
+			Str("msgId", query.MsgID).
+			Msg("failed to process query")
+		return
+	}
+	if err := w.streams.AckStreamQuery(query); err != nil {
+		log.Error().Err(err).Msg("failed to process query")
+	}
+}
+
+// refreshStreamQuery periodically confirms the query is still being
+// processed (until the `stop` channel is closed) so other workers
+// do not reclaim it in case it runs longer than the claim idle time
+func (w *Worker) refreshStreamQuery(query rdb.StreamQuery, stop <-chan struct{}) {
+	ticker := time.NewTicker(w.streams.StreamsClaimIdle() / streamRefreshesPerClaimIdle)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := w.streams.RefreshStreamQuery(w.ID, query); err != nil {
+				log.Error().Err(err).Str("msgId", query.MsgID).Msg("failed to refresh query")
 			}
+		}
+	}
+}
+
+// reclaimStreamQueries takes over queries abandoned by other
+// (probably crashed) workers. Queries which were retried too many
+// times are answered with an error.
+func (w *Worker) reclaimStreamQueries() {
+	retry, expired, err := w.streams.ReclaimStreamQueries(w.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to reclaim abandoned queries")
+	}
+	for _, query := range expired {
+		log.Warn().
+			Str("msgId", query.MsgID).
+			Str("func", query.Func).
+			Int64("deliveries", query.Deliveries).
+			Msg("discarding query exceeding max. number of retries")
+		err := w.queue.PublishResult(
+			query.Channel,
+			errorResult(query.Query, fmt.Errorf("query failed after %d attempts", query.Deliveries)),
+		)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to publish result of a discarded query")
+		}
+		if err := w.streams.AckStreamQuery(query); err != nil {
+			log.Error().Err(err).Msg("failed to discard query")
+		}
+	}
+	for _, query := range retry {
+		log.Warn().
+			Str("msgId", query.MsgID).
+			Str("func", query.Func).
+			Int64("deliveries", query.Deliveries).
+			Msg("retrying abandoned query")
+		slot, ok := w.acquireSlot()
+		if !ok {
+			// the query stays pending and another worker will reclaim it
+			return
+		}
+		w.startJob(slot, func() { w.processStreamQuery(slot, query) })
+	}
+}
+
+func (w *Worker) listenStreams() {
+	reclaimTicker := time.NewTicker(w.streams.StreamsClaimIdle())
+	defer reclaimTicker.Stop()
+	for {
+		var slot int
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-reclaimTicker.C:
+			w.reclaimStreamQueries()
+			continue
+		case slot = <-w.freeSlots:
+		}
+		query, err := w.streams.ReadStreamQuery(w.ID, DefaultTickerInterval)
+		if err == rdb.ErrorEmptyQueue {
+			w.freeSlots <- slot
+			continue
+
+		} else if err != nil {
+			w.freeSlots <- slot
+			log.Error().Err(err).Msg("failed to read query")
+			time.Sleep(DefaultTickerInterval)
+			continue
+		}
+		w.startJob(slot, func() { w.processStreamQuery(slot, query) })
+	}
+}
+
+func (w *Worker) listenList() {
+	defer w.ticker.Stop()
+	for {
+		select {
+		case <-w.ticker.C:
+			w.dispatchQueries()
+		case <-w.slotReleased:
+			w.dispatchQueries()
 		case <-w.ctx.Done():
-			w.ticker.Stop()
-			log.Info().Msg("worker exiting due to cancellation")
 			return
 		case msg := <-w.messages:
-			if msg.Payload == rdb.MsgNewQuery {
-				if err := w.tryNextQuery(); err != nil {
-					log.Error().
-						Err(err).
-						Msg("failed to process query")
-				}
+			if msg == rdb.MsgNewQuery {
+				w.dispatchQueries()
 			}
 		}
 	}
 }
 
-func (w *Worker) ConcResult(args rdb.ConcQueryArgs) (ans *result.ConcResult) {
+// Listen processes incoming queries until the worker's context
+// is cancelled. Then it stops accepting new queries and waits
+// for running jobs to finish.
+func (w *Worker) Listen() {
+	log.Info().Int("slots", w.NumSlots()).Msg("worker listening for queries")
+	if w.heartbeats != nil {
+		stopHeartbeats := make(chan struct{})
+		defer close(stopHeartbeats)
+		go w.writeHeartbeats(stopHeartbeats)
+	}
+	if w.streams != nil {
+		w.listenStreams()
+
+	} else {
+		w.listenList()
+	}
+	log.Info().
+		Int("runningJobs", w.NumRunningJobs()).
+		Msg("worker stopped accepting queries, waiting for running jobs to finish")
+	w.runningJobs.Wait()
+	log.Info().Msg("worker exiting due to cancellation")
+}
+
+// writeHeartbeats announces the worker is alive along with its status
+// until the `stop` channel is closed. Please note that the heartbeats
+// are written also while the worker is draining (see Status).
+func (w *Worker) writeHeartbeats(stop <-chan struct{}) {
+	ticker := time.NewTicker(rdb.WorkerHeartbeatInterval)
+	defer ticker.Stop()
+	// once the worker starts draining, the status is written immediately
+	draining := w.ctx.Done()
+	for {
+		if err := w.heartbeats.WriteHeartbeat(w.Status()); err != nil {
+			log.Error().Err(err).Msg("failed to write worker heartbeat")
+		}
+		select {
+		case <-stop:
+			return
+		case <-draining:
+			draining = nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) ConcResult(ctx context.Context, args rdb.ConcQueryArgs) (ans *result.ConcResult) {
 	ans = &result.ConcResult{Query: args.Query}
 	defer func() {
 		if r := recover(); r != nil {
@@ -135,45 +506,142 @@ func (w *Worker) ConcResult(args rdb.ConcQueryArgs) (ans *result.ConcResult) {
 			}
 		}
 	}()
+	cached, err := w.getCachedConc(args)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to use concordance cache")
+
+	} else if cached != nil {
+		log.Debug().
+			Str("query", args.Query).
+			Int("concSize", cached.ConcSize).
+			Bool("cacheHit", true).
+			Msg("obtained concordance result")
+		return cached
+	}
+	useCache := w.cache != nil && !args.NoCache
+	srchArgs := args
+	if useCache {
+		// search for whole cache windows so following
+		// pages can be served from the cache
+		srchArgs = rdb.CacheWindow(args)
+	}
 	concEx, err := mango.GetConcordance(
-		args.CorpusPath,
-		args.Query,
-		args.Attrs,
+		ctx,
+		srchArgs.CorpusPath,
+		srchArgs.Query,
+		srchArgs.Attrs,
 		[]string{},
 		[]string{},
-		args.StartLine,
-		args.MaxItems,
-		args.MaxContext,
-		args.ViewContextStruct,
+		srchArgs.StartLine,
+		srchArgs.MaxItems,
+		srchArgs.MaxContext,
+		srchArgs.ViewContextStruct,
+		mango.SampleArgs{Size: srchArgs.SampleSize, Seed: srchArgs.SampleSeed},
 	)
 	log.Debug().
 		Str("query", args.Query).
 		Int("concSize", concEx.ConcSize).
+		Bool("cacheHit", false).
 		Err(err).
 		Msg("obtained concordance result")
+	// the size is available even in case the requested lines
+	// are out of the concordance range
+	ans.ConcSize = concEx.ConcSize
+	if err != nil {
+		ans.Error = err
+
+	} else {
+		parser := concordance.NewLineParser(args.Attrs)
+		ans.Lines = parser.Parse(concEx.Lines)
+	}
+	if useCache {
+		if err := w.cache.StoreConcToCache(srchArgs, ans); err != nil {
+			log.Error().Err(err).Msg("failed to store concordance to cache")
+		}
+		ans = rdb.SliceCacheWindow(args, ans)
+	}
+	return
+}
+
+func (w *Worker) AttrValues(args rdb.AttrValuesQueryArgs) (ans *result.AttrValuesResult) {
+	ans = &result.AttrValuesResult{}
+	defer func() {
+		if r := recover(); r != nil {
+			ans = &result.AttrValuesResult{
+				Error:  fmt.Errorf("%v", r),
+				Values: make([]mango.GoAttrValue, 0),
+			}
+		}
+	}()
+	values, err := mango.GetAttrValues(
+		args.CorpusPath,
+		args.Attr,
+		args.FromValue,
+		args.NumBefore,
+		args.NumAfter,
+	)
+	log.Debug().
+		Str("attr", args.Attr).
+		Str("fromValue", args.FromValue).
+		Int("numValues", len(values)).
+		Err(err).
+		Msg("obtained attribute values")
 	if err != nil {
 		ans.Error = err
 		return
 	}
-	parser := concordance.NewLineParser(args.Attrs)
-	ans.Lines = parser.Parse(concEx.Lines)
-	ans.ConcSize = concEx.ConcSize
+	ans.Values = values
 	return
 }
 
+func (w *Worker) getCachedConc(args rdb.ConcQueryArgs) (*result.ConcResult, error) {
+	if w.cache == nil || args.NoCache {
+		return nil, nil
+	}
+	return w.cache.GetCachedConc(args)
+}
+
+// NewWorker creates a new worker processing queries from the `queue`
+// using `numSlots` concurrent jobs.
+// In case the queue supports Redis Streams, caching and/or heartbeats
+// (see rdb.StreamQueryConsumer, rdb.ConcCache, rdb.WorkerHeartbeats),
+// the features are used automatically.
 func NewWorker(
 	ctx context.Context,
 	workerID string,
-	radapter *rdb.Adapter,
-	messages <-chan *redis.Message,
+	version general.VersionInfo,
+	queue rdb.QueryConsumer,
+	messages <-chan string,
 	jobLogger jobLogger,
+	numSlots int,
 ) *Worker {
-	return &Worker{
-		ID:        workerID,
-		radapter:  radapter,
-		messages:  messages,
-		ctx:       ctx,
-		ticker:    time.NewTicker(DefaultTickerInterval),
-		jobLogger: jobLogger,
+	if numSlots < 1 {
+		numSlots = 1
+	}
+	ans := &Worker{
+		ID:           workerID,
+		version:      version,
+		started:      time.Now(),
+		queue:        queue,
+		messages:     messages,
+		ctx:          ctx,
+		ticker:       time.NewTicker(DefaultTickerInterval),
+		jobLogger:    jobLogger,
+		freeSlots:    make(chan int, numSlots),
+		slotReleased: make(chan struct{}, 1),
+		jobs:         make(map[int]rdb.WorkerJob),
+	}
+	for i := 0; i < numSlots; i++ {
+		ans.freeSlots <- i
+	}
+	if streams, ok := queue.(rdb.StreamQueryConsumer); ok && streams.UsesStreams() {
+		ans.streams = streams
+	}
+	if cache, ok := queue.(rdb.ConcCache); ok {
+		ans.cache = cache
+	}
+	if heartbeats, ok := queue.(rdb.WorkerHeartbeats); ok {
+		ans.heartbeats = heartbeats
 	}
+	return ans
 }
@@ -0,0 +1,204 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/stretchr/testify/assert"
+)
+
+// noopFunc is a worker function unknown to workers so a query
+// is answered with an error without touching any corpus
+const noopFunc = "noop"
+
+type fakeJobLogger struct {
+	mu   sync.Mutex
+	recs []result.JobLog
+}
+
+func (l *fakeJobLogger) Log(rec result.JobLog) {
+	l.mu.Lock()
+	l.recs = append(l.recs, rec)
+	l.mu.Unlock()
+}
+
+func (l *fakeJobLogger) numRecords() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.recs)
+}
+
+func newTestWorker(ctx context.Context, queue *rdb.InProcessQueue, numSlots int) (*Worker, *fakeJobLogger) {
+	logger := &fakeJobLogger{}
+	w := NewWorker(
+		ctx, "test-worker", general.VersionInfo{}, queue, queue.Subscribe(), logger, numSlots)
+	return w, logger
+}
+
+func waitForResult(t *testing.T, ch <-chan result.ConcResult) result.ConcResult {
+	select {
+	case res := <-ch:
+		return res
+	case <-time.After(5 * time.Second):
+		t.Fatal("no result received")
+	}
+	return result.ConcResult{}
+}
+
+func TestSlotPool(t *testing.T) {
+	queue := rdb.NewInProcessQueue(context.Background(), time.Minute, nil)
+	w, _ := newTestWorker(context.Background(), queue, 2)
+	assert.Equal(t, 2, w.NumSlots())
+	assert.Equal(t, 0, w.NumRunningJobs())
+
+	release := make(chan struct{})
+	for i := 0; i < w.NumSlots(); i++ {
+		slot, ok := w.acquireSlot()
+		assert.True(t, ok)
+		w.startJob(slot, func() { <-release })
+	}
+	assert.Equal(t, 2, w.NumRunningJobs())
+
+	// no free slot is available until a job finishes
+	acquired := make(chan int)
+	go func() {
+		slot, _ := w.acquireSlot()
+		acquired <- slot
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("slot acquired while all the slots are busy")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release <- struct{}{}
+	select {
+	case <-w.slotReleased:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slot release not notified")
+	}
+	select {
+	case slot := <-acquired:
+		w.startJob(slot, func() {})
+	case <-time.After(5 * time.Second):
+		t.Fatal("released slot not acquired")
+	}
+	close(release)
+	w.runningJobs.Wait()
+	assert.Equal(t, 0, w.NumRunningJobs())
+}
+
+func TestAcquireSlotCancelled(t *testing.T) {
+	queue := rdb.NewInProcessQueue(context.Background(), time.Minute, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	w, _ := newTestWorker(ctx, queue, 1)
+	slot, ok := w.acquireSlot()
+	assert.True(t, ok)
+	cancel()
+	_, ok = w.acquireSlot()
+	assert.False(t, ok)
+	w.freeSlots <- slot
+}
+
+func TestDispatchQueries(t *testing.T) {
+	queue := rdb.NewInProcessQueue(context.Background(), time.Minute, nil)
+	w, logger := newTestWorker(context.Background(), queue, 2)
+	results := make([]<-chan result.ConcResult, 3)
+	for i := range results {
+		ch, err := queue.PublishQuery(context.Background(), rdb.Query{Func: noopFunc})
+		assert.NoError(t, err)
+		results[i] = ch
+	}
+	// each dispatch runs at most as many queries as there are
+	// free slots, the rest stays queued for the next dispatch
+	for i := 0; i < len(results); i++ {
+		w.dispatchQueries()
+		w.runningJobs.Wait()
+	}
+	stats, err := queue.QueueStats()
+	assert.NoError(t, err)
+	for _, lane := range stats.Lanes {
+		assert.Equal(t, 0, lane.NumQueued)
+	}
+	for _, ch := range results {
+		res := waitForResult(t, ch)
+		assert.ErrorContains(t, res.Error, "unknown worker function noop")
+	}
+	assert.Equal(t, 3, logger.numRecords())
+	w.dispatchQueries()
+	assert.Equal(t, 0, w.NumRunningJobs())
+}
+
+func TestListenProcessesQueries(t *testing.T) {
+	queue := rdb.NewInProcessQueue(context.Background(), time.Minute, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	w, _ := newTestWorker(ctx, queue, 1)
+	stopped := make(chan struct{})
+	go func() {
+		w.Listen()
+		close(stopped)
+	}()
+	ch, err := queue.PublishQuery(context.Background(), rdb.Query{Func: noopFunc})
+	assert.NoError(t, err)
+	res := waitForResult(t, ch)
+	assert.Error(t, res.Error)
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker not stopped")
+	}
+	assert.True(t, w.Status().Draining)
+}
+
+func TestListenDrainsRunningJobs(t *testing.T) {
+	queue := rdb.NewInProcessQueue(context.Background(), time.Minute, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	w, _ := newTestWorker(ctx, queue, 1)
+	slot, ok := w.acquireSlot()
+	assert.True(t, ok)
+	release := make(chan struct{})
+	w.startJob(slot, func() { <-release })
+
+	stopped := make(chan struct{})
+	go func() {
+		w.Listen()
+		close(stopped)
+	}()
+	cancel()
+	select {
+	case <-stopped:
+		t.Fatal("worker stopped before its running job finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.True(t, w.Status().Draining)
+	close(release)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker not stopped after its running job finished")
+	}
+}